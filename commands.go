@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/iot-for-all/starling/pkg/config"
+	"github.com/iot-for-all/starling/pkg/storing"
+)
+
+// passphraseEnv is the environment variable the backup passphrase is read from when not given as a flag.
+const passphraseEnv = "STARLING_BACKUP_PASSPHRASE"
+
+// runCommand runs a maintenance command against the configured database instead of starting the server.
+// Starling must not be running, since the database can only be opened once. It returns the process exit code.
+func runCommand(cfg *config.GlobalConfig, name string, args []string) int {
+	var err error
+	switch name {
+	case "backup":
+		err = backupCommand(cfg, args)
+	case "restore":
+		err = restoreCommand(cfg, args)
+	case "migrate":
+		err = migrateCommand(cfg, args)
+	default:
+		fmt.Printf("unknown command '%s'\n", name)
+		fmt.Printf("usage: %s [backup|restore|migrate] [flags]\n", os.Args[0])
+		return 2
+	}
+
+	if err != nil {
+		fmt.Printf("%s failed: %s\n", name, err)
+		return 1
+	}
+
+	return 0
+}
+
+// backupCommand writes a backup of the database to a file.
+func backupCommand(cfg *config.GlobalConfig, args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	excludeSecrets := flags.Bool("exclude-secrets", true, "leave out target keys, API tokens and cached device connection strings, defaults to true without a passphrase")
+	passphrase := flags.String("passphrase", os.Getenv(passphraseEnv), "encrypt the secrets with this passphrase, defaults to $"+passphraseEnv)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: backup [-exclude-secrets=false] [-passphrase <passphrase>] <file>")
+	}
+
+	// secrets are only backed up encrypted with a passphrase, or in plain text when asked for explicitly
+	explicit := false
+	flags.Visit(func(f *flag.Flag) {
+		explicit = explicit || f.Name == "exclude-secrets"
+	})
+	if !explicit {
+		*excludeSecrets = len(*passphrase) == 0
+	}
+
+	if err := storing.Open(&cfg.Data); err != nil {
+		return fmt.Errorf("failed to open the database. %w", err)
+	}
+	defer storing.Close()
+
+	file, err := os.OpenFile(flags.Arg(0), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err = storing.Backup(file, storing.BackupOptions{ExcludeSecrets: *excludeSecrets, Passphrase: *passphrase}); err != nil {
+		return err
+	}
+
+	fmt.Printf("backed up the database to %s\n", flags.Arg(0))
+	return file.Close()
+}
+
+// restoreCommand restores a backup file into the empty database.
+func restoreCommand(cfg *config.GlobalConfig, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	passphrase := flags.String("passphrase", os.Getenv(passphraseEnv), "decrypt the secrets with this passphrase, defaults to $"+passphraseEnv)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: restore [-passphrase <passphrase>] <file>")
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := storing.Open(&cfg.Data); err != nil {
+		return fmt.Errorf("failed to open the database. %w", err)
+	}
+	defer storing.Close()
+
+	restored, err := storing.Restore(file, *passphrase)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("restored %d records from %s\n", restored, flags.Arg(0))
+	return nil
+}
+
+// migrateCommand upgrades the database to the current schema version, or logs the changes of a dry run.
+func migrateCommand(cfg *config.GlobalConfig, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "log the changes without applying them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg.Data.MigrationDryRun = *dryRun
+	if err := storing.Open(&cfg.Data); err != nil {
+		return fmt.Errorf("failed to open the database. %w", err)
+	}
+
+	return storing.Close()
+}
@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/iot-for-all/starling/pkg/config"
+	"github.com/iot-for-all/starling/pkg/consuming"
 	"github.com/iot-for-all/starling/pkg/controlling"
+	"github.com/iot-for-all/starling/pkg/exporting"
 	"github.com/iot-for-all/starling/pkg/serving"
 	"github.com/iot-for-all/starling/pkg/storing"
+	"github.com/iot-for-all/starling/pkg/tracing"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"gopkg.in/natefinch/lumberjack.v2"
@@ -40,20 +43,59 @@ func main() {
 	}
 	initLogger(cfg)
 
+	// run a maintenance command such as backup or restore instead of the server
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(cfg, os.Args[1], os.Args[2:]))
+	}
+
+	// initialize tracing of device operations
+	shutdownTracing, err := tracing.Init(ctx, &cfg.Tracing)
+	if err != nil {
+		panic(fmt.Errorf("failed to initialize tracing. %w", err))
+	}
+
 	// initialize database
 	err = storing.Open(&cfg.Data)
 	if err != nil {
 		panic(fmt.Errorf("failed to open the database. %w", err))
 	}
 
+	// a dry run of the schema migrations leaves the data unmigrated, so it must not be served
+	if cfg.Data.MigrationDryRun {
+		log.Info().Msg("finished the dry run of the database schema migrations, unset migrationDryRun to start Starling")
+		_ = storing.Close()
+		_ = shutdownTracing(context.Background())
+		return
+	}
+
 	// Initialize the controller.
 	controller := controlling.NewController(ctx, cfg)
-	controller.ResetSimulationStatus()
+	if err = controller.ResetSimulationStatus(); err != nil {
+		log.Error().Err(err).Msg("failed to reset the simulations and resume interrupted jobs")
+	}
+
+	// Start consuming the telemetry exported from IoT Central to measure end-to-end latency
+	if cfg.Consumer.Enabled {
+		go func() {
+			if err := consuming.Start(ctx, &cfg.Consumer); err != nil {
+				log.Error().Err(err).Msg("failed to consume exported telemetry")
+			}
+		}()
+	}
 
 	// Start the admin and metrics http endpoints
 	go serving.StartAdmin(cfg, controller)
 	go serving.StartMetrics(&cfg.HTTP)
 
+	// Push the metrics when Prometheus can't scrape them e.g. on ephemeral build agents
+	exported := make(chan struct{})
+	go func() {
+		defer close(exported)
+		if err := exporting.Start(ctx, &cfg.Export); err != nil {
+			log.Error().Err(err).Msg("failed to push metrics")
+		}
+	}()
+
 	// open web browser serving the Starling website
 	url := fmt.Sprintf("http://localhost:%d", cfg.HTTP.AdminPort)
 	err = openWebBrowser(url)
@@ -65,6 +107,9 @@ func main() {
 	<-sig
 
 	cancel() // todo: Wait for simulator to completely shut down.
+	controller.WaitForJobs()
+	<-exported
+	_ = shutdownTracing(context.Background())
 	_ = storing.Close()
 }
 
@@ -0,0 +1,340 @@
+package central
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iot-for-all/starling/pkg/models"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// apiVersion is the version of the IoT Central REST API used by the client.
+	apiVersion = "1.0"
+
+	// queryAPIVersion is the version of the IoT Central REST API providing the query API.
+	queryAPIVersion = "2022-10-31-preview"
+
+	// defaultTimeout is the timeout of a single request.
+	defaultTimeout = 10 * time.Second
+
+	// defaultMaxAttempts is the number of times a request is attempted before giving up.
+	defaultMaxAttempts = 5
+
+	// defaultBaseDelay is the delay before the first retry, doubled with every attempt.
+	defaultBaseDelay = 1 * time.Second
+
+	// maxDelay caps the delay between retries.
+	maxDelay = 60 * time.Second
+)
+
+type (
+	// Client calls the IoT Central REST API of a target application. Throttled and failed requests are retried with
+	// exponential backoff honoring the Retry-After header, and paged results are followed through their next links.
+	Client struct {
+		target      *models.SimulationTarget // target application to call.
+		httpClient  *http.Client             // client used to send the requests.
+		maxAttempts int                      // number of times a request is attempted.
+		baseDelay   time.Duration            // delay before the first retry.
+	}
+
+	// page is a page of items returned by the IoT Central REST API.
+	page struct {
+		Value    []json.RawMessage `json:"value"`              // items in this page.
+		NextLink string            `json:"nextLink,omitempty"` // URL of the next page, empty for the last page.
+	}
+
+	// queryResult is the result of a query sent to the IoT Central query API.
+	queryResult struct {
+		Results []map[string]interface{} `json:"results"` // rows matching the query.
+	}
+)
+
+// NewClient creates a new IoT Central REST API client for the target application.
+func NewClient(target *models.SimulationTarget) *Client {
+	return &Client{
+		target: target,
+		httpClient: &http.Client{
+			Timeout: defaultTimeout,
+		},
+		maxAttempts: defaultMaxAttempts,
+		baseDelay:   defaultBaseDelay,
+	}
+}
+
+// ListDevices lists all devices in the application.
+func (c *Client) ListDevices(ctx context.Context) ([]models.CentralDevice, error) {
+	devices := make([]models.CentralDevice, 0)
+	err := c.list(ctx, "devices", "/api/devices", func(item json.RawMessage) error {
+		var device models.CentralDevice
+		if err := json.Unmarshal(item, &device); err != nil {
+			return err
+		}
+		devices = append(devices, device)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return devices, nil
+}
+
+// GetDevice gets a device from the application.
+func (c *Client) GetDevice(ctx context.Context, deviceID string) (*models.CentralDevice, error) {
+	var device models.CentralDevice
+	err := c.Do(ctx, "device", http.MethodGet, fmt.Sprintf("/api/devices/%s", url.PathEscape(deviceID)), nil, &device)
+	if err != nil {
+		return nil, err
+	}
+
+	return &device, nil
+}
+
+// DeleteDevice deletes a device from the application.
+func (c *Client) DeleteDevice(ctx context.Context, deviceID string) error {
+	return c.Do(ctx, "device", http.MethodDelete, fmt.Sprintf("/api/devices/%s", url.PathEscape(deviceID)), nil, nil)
+}
+
+// EnableDevice unblocks a device in the application.
+func (c *Client) EnableDevice(ctx context.Context, deviceID string) error {
+	body := map[string]bool{"enabled": true}
+	return c.Do(ctx, "device", http.MethodPatch, fmt.Sprintf("/api/devices/%s", url.PathEscape(deviceID)), body, nil)
+}
+
+// ListDeviceTemplates lists all device templates in the application.
+func (c *Client) ListDeviceTemplates(ctx context.Context) ([]map[string]interface{}, error) {
+	templates := make([]map[string]interface{}, 0)
+	err := c.list(ctx, "deviceTemplates", "/api/deviceTemplates", func(item json.RawMessage) error {
+		var template map[string]interface{}
+		if err := json.Unmarshal(item, &template); err != nil {
+			return err
+		}
+		templates = append(templates, template)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+// GetDeviceTemplate gets a device template from the application by its DTMI.
+func (c *Client) GetDeviceTemplate(ctx context.Context, templateID string) (map[string]interface{}, error) {
+	var template map[string]interface{}
+	err := c.Do(ctx, "deviceTemplate", http.MethodGet, fmt.Sprintf("/api/deviceTemplates/%s", url.PathEscape(templateID)), nil, &template)
+	if err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+// PutDeviceTemplate creates or updates a device template in the application.
+func (c *Client) PutDeviceTemplate(ctx context.Context, templateID string, template map[string]interface{}) (map[string]interface{}, error) {
+	var result map[string]interface{}
+	err := c.Do(ctx, "deviceTemplate", http.MethodPut, fmt.Sprintf("/api/deviceTemplates/%s", url.PathEscape(templateID)), template, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Query runs a query against the telemetry and properties of the devices in the application and returns the rows found.
+func (c *Client) Query(ctx context.Context, query string) ([]map[string]interface{}, error) {
+	var result queryResult
+	body := map[string]string{"query": query}
+	err := c.do(ctx, "query", http.MethodPost, c.versionURL("/api/query", queryAPIVersion), body, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Results, nil
+}
+
+// Do sends a request to the given path of the IoT Central REST API and decodes the response into result.
+// The endpoint names the API in the metrics and logs. Body and result are encoded as JSON and may be nil.
+func (c *Client) Do(ctx context.Context, endpoint string, method string, path string, body interface{}, result interface{}) error {
+	return c.do(ctx, endpoint, method, c.url(path), body, result)
+}
+
+// list pages through all items returned by the given path and hands each of them to the callback.
+func (c *Client) list(ctx context.Context, endpoint string, path string, onItem func(item json.RawMessage) error) error {
+	next := c.url(path)
+	for len(next) > 0 {
+		var p page
+		if err := c.do(ctx, endpoint, http.MethodGet, next, nil, &p); err != nil {
+			return err
+		}
+
+		for _, item := range p.Value {
+			if err := onItem(item); err != nil {
+				return fmt.Errorf("error reading %s from Central: %w", endpoint, err)
+			}
+		}
+
+		// only follow links back to the same application so the token is not sent anywhere else
+		next = p.NextLink
+		if len(next) > 0 {
+			u, err := url.Parse(next)
+			base, _ := url.Parse(c.baseURL())
+			if err != nil || base == nil || u.Host != base.Host {
+				return fmt.Errorf("unexpected next page link '%s' while listing %s in Central", next, endpoint)
+			}
+		}
+	}
+
+	return nil
+}
+
+// do sends the request, retrying throttled and failed attempts.
+func (c *Client) do(ctx context.Context, endpoint string, method string, path string, body interface{}, result interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("error encoding %s request: %w", endpoint, err)
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		delay, err := c.attempt(ctx, endpoint, method, path, payload, result, attempt)
+		if err == nil {
+			return nil
+		}
+		if delay < 0 || attempt >= c.maxAttempts {
+			return err
+		}
+
+		retriesTotal.WithLabelValues(c.target.ID, endpoint, method).Inc()
+		log.Debug().
+			Err(err).
+			Str("target", c.target.ID).
+			Str("endpoint", endpoint).
+			Int("attempt", attempt).
+			Dur("delay", delay).
+			Msg("retrying Central request")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// attempt sends the request once. On failure it returns how long to wait before retrying, or -1 if retrying is pointless.
+func (c *Client) attempt(ctx context.Context, endpoint string, method string, path string, payload []byte, result interface{}, attempt int) (time.Duration, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, path, reader)
+	if err != nil {
+		return -1, fmt.Errorf("error creating %s request: %w", endpoint, err)
+	}
+
+	req.Header.Add("Authorization", c.target.AppToken)
+	if payload != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+
+	start := time.Now()
+	res, err := c.httpClient.Do(req)
+	requestLatency.WithLabelValues(c.target.ID, endpoint, method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		requestsTotal.WithLabelValues(c.target.ID, endpoint, method, "error").Inc()
+		if ctx.Err() != nil {
+			return -1, ctx.Err()
+		}
+		return c.backoff(attempt), fmt.Errorf("error sending %s request: %w", endpoint, err)
+	}
+	defer func() { _ = res.Body.Close() }()
+	requestsTotal.WithLabelValues(c.target.ID, endpoint, method, strconv.Itoa(res.StatusCode)).Inc()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		body, _ := ioutil.ReadAll(res.Body)
+		e := newError(req, res, body)
+		switch {
+		case res.StatusCode == http.StatusTooManyRequests:
+			throttlingTotal.WithLabelValues(c.target.ID, endpoint, method).Inc()
+			return c.retryAfter(res, attempt), e
+		case res.StatusCode >= http.StatusInternalServerError:
+			return c.retryAfter(res, attempt), e
+		default:
+			return -1, e
+		}
+	}
+
+	if result != nil {
+		if err := json.NewDecoder(res.Body).Decode(result); err != nil {
+			return -1, fmt.Errorf("error reading %s response: %w", endpoint, err)
+		}
+	}
+
+	return 0, nil
+}
+
+// retryAfter returns how long to wait before retrying as requested by the Retry-After header,
+// falling back to exponential backoff when the header is missing.
+func (c *Client) retryAfter(res *http.Response, attempt int) time.Duration {
+	if value := res.Header.Get("Retry-After"); len(value) > 0 {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			return capDelay(time.Duration(seconds) * time.Second)
+		}
+		if at, err := http.ParseTime(value); err == nil {
+			if delay := time.Until(at); delay > 0 {
+				return capDelay(delay)
+			}
+			return 0
+		}
+	}
+
+	return c.backoff(attempt)
+}
+
+// backoff returns the delay before retrying the given attempt, doubling the base delay with every attempt.
+func (c *Client) backoff(attempt int) time.Duration {
+	return capDelay(c.baseDelay << uint(attempt-1))
+}
+
+// url builds the full URL of a path of the IoT Central REST API.
+func (c *Client) url(path string) string {
+	return c.versionURL(path, apiVersion)
+}
+
+// versionURL builds the full URL of a path of the given version of the IoT Central REST API.
+func (c *Client) versionURL(path string, version string) string {
+	return fmt.Sprintf("%s%s?api-version=%s", c.baseURL(), path, version)
+}
+
+// baseURL returns the URL of the application. Application URLs with a scheme are used as they are,
+// which allows pointing a target at a local stand-in for the IoT Central REST API.
+func (c *Client) baseURL() string {
+	if strings.Contains(c.target.AppUrl, "://") {
+		return strings.TrimSuffix(c.target.AppUrl, "/")
+	}
+
+	return "https://" + c.target.AppUrl
+}
+
+// capDelay limits the delay between retries.
+func capDelay(delay time.Duration) time.Duration {
+	if delay > maxDelay {
+		return maxDelay
+	}
+
+	return delay
+}
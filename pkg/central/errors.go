@@ -0,0 +1,82 @@
+package central
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// ErrNotFound is matched by errors returned for resources that do not exist in IoT Central.
+	ErrNotFound = errors.New("not found")
+	// ErrUnauthorized is matched by errors returned when the API token is invalid or lacks permissions.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrThrottled is matched by errors returned when IoT Central kept throttling the request.
+	ErrThrottled = errors.New("throttled")
+	// ErrUnavailable is matched by errors returned when IoT Central kept failing to process the request.
+	ErrUnavailable = errors.New("unavailable")
+)
+
+type (
+	// Error is returned when the IoT Central REST API responds with an error status code.
+	Error struct {
+		Method     string // method of the failed request.
+		Path       string // path of the failed request.
+		StatusCode int    // HTTP status code of the response.
+		Status     string // HTTP status of the response.
+		Code       string // error code reported by IoT Central, if any.
+		Message    string // error message reported by IoT Central, if any.
+	}
+
+	// errorResponse is the body of an error response from the IoT Central REST API.
+	errorResponse struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+)
+
+// newError creates an error from an error response of the IoT Central REST API.
+func newError(req *http.Request, res *http.Response, body []byte) *Error {
+	e := &Error{
+		Method:     req.Method,
+		Path:       req.URL.Path,
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+	}
+
+	var er errorResponse
+	if json.Unmarshal(body, &er) == nil {
+		e.Code = er.Error.Code
+		e.Message = er.Error.Message
+	}
+
+	return e
+}
+
+// Error returns the description of the error.
+func (e *Error) Error() string {
+	if len(e.Message) > 0 {
+		return fmt.Sprintf("%s %s returned %s: %s", e.Method, e.Path, e.Status, e.Message)
+	}
+
+	return fmt.Sprintf("%s %s returned %s", e.Method, e.Path, e.Status)
+}
+
+// Is matches the error against the sentinel errors of this package based on its status code.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrThrottled:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrUnavailable:
+		return e.StatusCode >= http.StatusInternalServerError
+	default:
+		return false
+	}
+}
@@ -0,0 +1,61 @@
+package central
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	requestsTotal   *prometheus.CounterVec
+	requestLatency  *prometheus.HistogramVec
+	retriesTotal    *prometheus.CounterVec
+	throttlingTotal *prometheus.CounterVec
+)
+
+// init initializes the metrics used by the IoT Central REST API client
+func init() {
+	requestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "starling",
+			Subsystem: "central",
+			Name:      "requests_total",
+			Help:      "Total number of requests sent to the IoT Central REST API",
+		},
+		[]string{"target", "endpoint", "method", "code"},
+	)
+
+	requestLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "starling",
+			Subsystem: "central",
+			Name:      "request_latency_seconds",
+			Help:      "Latency of requests sent to the IoT Central REST API",
+			Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 20, 30},
+		},
+		[]string{"target", "endpoint", "method"},
+	)
+
+	retriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "starling",
+			Subsystem: "central",
+			Name:      "retries_total",
+			Help:      "Total number of requests to the IoT Central REST API that were retried",
+		},
+		[]string{"target", "endpoint", "method"},
+	)
+
+	throttlingTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "starling",
+			Subsystem: "central",
+			Name:      "throttled_total",
+			Help:      "Total number of requests to the IoT Central REST API that were throttled",
+		},
+		[]string{"target", "endpoint", "method"},
+	)
+
+	prometheus.MustRegister(
+		requestsTotal,
+		requestLatency,
+		retriesTotal,
+		throttlingTotal,
+	)
+}
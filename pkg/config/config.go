@@ -7,7 +7,10 @@ type (
 	}
 
 	StoreConfig struct {
-		DataDirectory string `yaml:"path" json:"path"`
+		Backend         string `yaml:"backend" json:"backend"`                 // badger (default), memory or sqlite
+		DataDirectory   string `yaml:"path" json:"path"`                       // directory of the badger database
+		SQLiteFile      string `yaml:"sqliteFile" json:"sqliteFile"`           // SQLite database file, starling.db in the data directory if empty
+		MigrationDryRun bool   `yaml:"migrationDryRun" json:"migrationDryRun"` // log the schema migrations at startup without applying them
 	}
 
 	HTTPConfig struct {
@@ -33,6 +36,41 @@ type (
 		EnableTwinUpdateAcks       bool         `yaml:"enableTwinUpdateAcks" json:"enableTwinUpdateAcks"`
 		EnableCommandAcks          bool         `yaml:"enableCommandAcks" json:"enableCommandAcks"`
 		GeopointData               [][3]float64 `yaml:"geopointData" json:"geopointData"`
+		DeviceJournalSize          int          `yaml:"deviceJournalSize" json:"deviceJournalSize"`
+		DeviceJournalFile          string       `yaml:"deviceJournalFile" json:"deviceJournalFile"`
+		MetricsRetention           int          `yaml:"metricsRetention" json:"metricsRetention"`
+	}
+
+	ConsumerConfig struct {
+		Enabled     bool     `yaml:"enabled" json:"enabled"`         // consume the telemetry exported from IoT Central
+		Brokers     []string `yaml:"brokers" json:"brokers"`         // Kafka brokers e.g. <namespace>.servicebus.windows.net:9093 for Event Hubs
+		Topic       string   `yaml:"topic" json:"topic"`             // topic (event hub) the telemetry is exported to
+		GroupID     string   `yaml:"groupId" json:"groupId"`         // consumer group used to read the topic
+		Username    string   `yaml:"username" json:"username"`       // SASL PLAIN user name, $ConnectionString for Event Hubs
+		Password    string   `yaml:"password" json:"password"`       // SASL PLAIN password, the connection string for Event Hubs
+		TLS         bool     `yaml:"tls" json:"tls"`                 // connect to the brokers using TLS
+		MatchWindow int      `yaml:"matchWindow" json:"matchWindow"` // seconds after which sent telemetry not consumed is counted as lost
+	}
+
+	TracingConfig struct {
+		Enabled     bool    `yaml:"enabled" json:"enabled"`         // trace device lifecycle operations with OpenTelemetry
+		Exporter    string  `yaml:"exporter" json:"exporter"`       // otlp to export to a collector, file to write to a local file
+		Endpoint    string  `yaml:"endpoint" json:"endpoint"`       // host:port of the OTLP/HTTP collector
+		Insecure    bool    `yaml:"insecure" json:"insecure"`       // export to the collector without TLS
+		File        string  `yaml:"file" json:"file"`               // file the spans are written to by the file exporter
+		SampleRatio float64 `yaml:"sampleRatio" json:"sampleRatio"` // fraction of devices traced, between 0 and 1
+		ServiceName string  `yaml:"serviceName" json:"serviceName"` // service name reported with the spans
+	}
+
+	ExportConfig struct {
+		Enabled        bool   `yaml:"enabled" json:"enabled"`               // push the starling metrics to a Pushgateway and/or remote-write endpoint
+		PushgatewayURL string `yaml:"pushgatewayUrl" json:"pushgatewayUrl"` // URL of the Prometheus Pushgateway, empty to not push to a Pushgateway
+		RemoteWriteURL string `yaml:"remoteWriteUrl" json:"remoteWriteUrl"` // URL of the Prometheus remote-write endpoint, empty to not remote-write
+		Interval       int    `yaml:"interval" json:"interval"`             // seconds between pushes
+		Job            string `yaml:"job" json:"job"`                       // job label of the pushed metrics
+		Instance       string `yaml:"instance" json:"instance"`             // instance label of the pushed metrics, the host name if empty
+		Username       string `yaml:"username" json:"username"`             // basic auth user name, empty to push without authentication
+		Password       string `yaml:"password" json:"password"`             // basic auth password
 	}
 
 	GlobalConfig struct {
@@ -40,6 +78,9 @@ type (
 		Data       StoreConfig      `yaml:"data" json:"data"`
 		HTTP       HTTPConfig       `yaml:"http" json:"http"`
 		Simulation SimulationConfig `yaml:"simulation" json:"simulation"`
+		Consumer   ConsumerConfig   `yaml:"consumer" json:"consumer"`
+		Tracing    TracingConfig    `yaml:"tracing" json:"tracing"`
+		Export     ExportConfig     `yaml:"export" json:"export"`
 	}
 )
 
@@ -50,6 +91,7 @@ func NewConfig() *GlobalConfig {
 			LogsDir:  "./logs",
 		},
 		Data: StoreConfig{
+			Backend:       "badger",
 			DataDirectory: "./data",
 		},
 		HTTP: HTTPConfig{
@@ -73,6 +115,7 @@ func NewConfig() *GlobalConfig {
 			EnableReportedProps:        true,
 			EnableTwinUpdateAcks:       true,
 			EnableCommandAcks:          true,
+			MetricsRetention:           300,
 			GeopointData: [][3]float64{
 				{47.645804, -122.132337, 0.0},
 				{47.644799, -122.132291, 0.0},
@@ -97,5 +140,26 @@ func NewConfig() *GlobalConfig {
 				{47.646069, -122.132164, 0.0},
 			},
 		},
+		Consumer: ConsumerConfig{
+			Enabled:     false,
+			GroupID:     "starling",
+			Username:    "$ConnectionString",
+			TLS:         true,
+			MatchWindow: 300,
+		},
+		Tracing: TracingConfig{
+			Enabled:     false,
+			Exporter:    "otlp",
+			Endpoint:    "localhost:4318",
+			Insecure:    true,
+			File:        "./traces/starling.json",
+			SampleRatio: 0.01,
+			ServiceName: "starling",
+		},
+		Export: ExportConfig{
+			Enabled:  false,
+			Interval: 15,
+			Job:      "starling",
+		},
 	}
 }
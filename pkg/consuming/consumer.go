@@ -0,0 +1,210 @@
+package consuming
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/iot-for-all/starling/pkg/config"
+	"github.com/rs/zerolog/log"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+)
+
+const (
+	// defaultMatchWindow is the time after which sent telemetry not consumed is counted as lost when not configured.
+	defaultMatchWindow = 300 * time.Second
+
+	// expireInterval is the interval at which sent telemetry is checked for expiry.
+	expireInterval = 10 * time.Second
+)
+
+var (
+	// messageIDKeys are the names under which the message id of exported telemetry may be found.
+	messageIDKeys = []string{"messageId", "message-id", "iothub-message-id"}
+	// correlationIDKeys are the names under which the correlation id of exported telemetry may be found.
+	correlationIDKeys = []string{"correlationId", "correlation-id", "iothub-correlation-id"}
+)
+
+// Start consumes the telemetry exported from IoT Central to a Kafka compatible endpoint such as Event Hubs
+// and matches it with the telemetry sent by the simulated devices until the context is cancelled.
+func Start(ctx context.Context, cfg *config.ConsumerConfig) error {
+	if len(cfg.Brokers) == 0 || len(cfg.Topic) == 0 {
+		return errors.New("consumer requires brokers and a topic")
+	}
+
+	dialer := &kafka.Dialer{
+		Timeout:   10 * time.Second,
+		DualStack: true,
+	}
+	if cfg.TLS {
+		dialer.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if len(cfg.Username) > 0 {
+		dialer.SASLMechanism = plain.Mechanism{Username: cfg.Username, Password: cfg.Password}
+	}
+
+	groupID := cfg.GroupID
+	if len(groupID) == 0 {
+		groupID = "starling"
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     cfg.Brokers,
+		Topic:       cfg.Topic,
+		GroupID:     groupID,
+		Dialer:      dialer,
+		StartOffset: kafka.LastOffset,
+		MinBytes:    1,
+		MaxBytes:    10e6,
+	})
+	defer func() { _ = reader.Close() }()
+
+	window := time.Duration(cfg.MatchWindow) * time.Second
+	if window <= 0 {
+		window = defaultMatchWindow
+	}
+
+	sent.setEnabled(true)
+	defer sent.setEnabled(false)
+	go expire(ctx, window)
+
+	log.Info().
+		Strs("brokers", cfg.Brokers).
+		Str("topic", cfg.Topic).
+		Str("groupID", groupID).
+		Msg("consuming exported telemetry")
+
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			consumerErrorsTotal.Inc()
+			log.Error().Err(err).Str("topic", cfg.Topic).Msg("error consuming exported telemetry")
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		handle(msg, time.Now())
+	}
+}
+
+// handle matches an exported message with the telemetry sent by the simulated devices and records its latency.
+func handle(msg kafka.Message, received time.Time) {
+	messageID, correlationID := messageIDs(msg)
+	if len(messageID) == 0 && len(correlationID) == 0 {
+		consumedTotal.WithLabelValues("invalid").Inc()
+		return
+	}
+
+	sm := sent.match(messageID, correlationID)
+	if sm == nil {
+		// exported again, by other devices or sent before starling started
+		consumedTotal.WithLabelValues("unmatched").Inc()
+		if deviceID, seq, ok := sequenceNumber(msg); ok {
+			observeDevice(SinkConsumer, deviceID, seq)
+		}
+		return
+	}
+
+	consumedTotal.WithLabelValues("matched").Inc()
+	Observe(SinkConsumer, sm.simulationID, sm.deviceID, sm.sequence)
+	endToEndReceivedTotal.WithLabelValues(sm.simulationID, sm.targetID, sm.modelID).Inc()
+	endToEndLatency.WithLabelValues(sm.simulationID, sm.targetID, sm.modelID).Observe(received.Sub(sm.sentTime).Seconds())
+}
+
+// expire periodically counts the telemetry not consumed within the match window as lost.
+func expire(ctx context.Context, window time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(expireInterval):
+			for _, sm := range sent.expire(time.Now().Add(-window)) {
+				endToEndLostTotal.WithLabelValues(sm.simulationID, sm.targetID, sm.modelID).Inc()
+			}
+		}
+	}
+}
+
+// messageIDs finds the message and correlation ids of an exported message. They are looked up in the Kafka headers
+// and in the JSON body, either at the top level or in the message or system properties added by the export.
+func messageIDs(msg kafka.Message) (messageID string, correlationID string) {
+	for _, h := range msg.Headers {
+		if len(messageID) == 0 && hasKey(messageIDKeys, h.Key) {
+			messageID = string(h.Value)
+		}
+		if len(correlationID) == 0 && hasKey(correlationIDKeys, h.Key) {
+			correlationID = string(h.Value)
+		}
+	}
+	if len(messageID) > 0 {
+		return messageID, correlationID
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(msg.Value, &body); err != nil {
+		return messageID, correlationID
+	}
+
+	sections := []map[string]interface{}{body}
+	for _, key := range []string{"messageProperties", "systemProperties", "properties"} {
+		if section, ok := body[key].(map[string]interface{}); ok {
+			sections = append(sections, section)
+		}
+	}
+	for _, section := range sections {
+		for key, value := range section {
+			s, ok := value.(string)
+			if !ok {
+				continue
+			}
+			if len(messageID) == 0 && hasKey(messageIDKeys, key) {
+				messageID = s
+			}
+			if len(correlationID) == 0 && hasKey(correlationIDKeys, key) {
+				correlationID = s
+			}
+		}
+	}
+
+	return messageID, correlationID
+}
+
+// sequenceNumber finds the device id and the telemetry sequence number of an exported message.
+func sequenceNumber(msg kafka.Message) (deviceID string, seq int, ok bool) {
+	var body struct {
+		DeviceID  string                 `json:"deviceId"`
+		Telemetry map[string]interface{} `json:"telemetry"`
+	}
+	if err := json.Unmarshal(msg.Value, &body); err != nil || len(body.DeviceID) == 0 {
+		return "", 0, false
+	}
+
+	value, ok := body.Telemetry[SequenceField].(float64)
+	if !ok {
+		return "", 0, false
+	}
+
+	return body.DeviceID, int(value), true
+}
+
+// hasKey tells whether the key is one of the given keys ignoring case.
+func hasKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,151 @@
+package consuming
+
+import (
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestMessageIDs(t *testing.T) {
+	tests := []struct {
+		name          string
+		msg           kafka.Message
+		messageID     string
+		correlationID string
+	}{
+		{
+			name: "headers",
+			msg: kafka.Message{
+				Headers: []kafka.Header{
+					{Key: "iothub-message-id", Value: []byte("m1")},
+					{Key: "Correlation-Id", Value: []byte("c1")},
+				},
+				Value: []byte(`{"messageId":"ignored"}`),
+			},
+			messageID:     "m1",
+			correlationID: "c1",
+		},
+		{
+			name:          "top level",
+			msg:           kafka.Message{Value: []byte(`{"messageId":"m2","correlationId":"c2"}`)},
+			messageID:     "m2",
+			correlationID: "c2",
+		},
+		{
+			name:          "message properties",
+			msg:           kafka.Message{Value: []byte(`{"messageProperties":{"message-id":"m3"},"systemProperties":{"iothub-correlation-id":"c3"}}`)},
+			messageID:     "m3",
+			correlationID: "c3",
+		},
+		{
+			name: "not json",
+			msg:  kafka.Message{Value: []byte("telemetry")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			messageID, correlationID := messageIDs(test.msg)
+			if messageID != test.messageID || correlationID != test.correlationID {
+				t.Errorf("expected ids '%s' and '%s', got '%s' and '%s'", test.messageID, test.correlationID, messageID, correlationID)
+			}
+		})
+	}
+}
+
+func TestSequenceNumber(t *testing.T) {
+	deviceID, seq, ok := sequenceNumber(kafka.Message{Value: []byte(`{"deviceId":"d1","telemetry":{"starlingSeq":42}}`)})
+	if !ok || deviceID != "d1" || seq != 42 {
+		t.Errorf("expected sequence number 42 of d1, got %d of '%s' (%v)", seq, deviceID, ok)
+	}
+
+	if _, _, ok = sequenceNumber(kafka.Message{Value: []byte(`{"deviceId":"d1","telemetry":{}}`)}); ok {
+		t.Error("expected no sequence number without the sequence field")
+	}
+}
+
+func TestHandleMatchesTrackedMessages(t *testing.T) {
+	sent.setEnabled(true)
+	defer sent.setEnabled(false)
+	defer ResetSequences("consumer-sim")
+
+	now := time.Now()
+	Track("m1", "", "consumer-sim", "consumer-target", "consumer-model", "consumer-device", 1, now)
+	Track("m2", "c2", "consumer-sim", "consumer-target", "consumer-model", "consumer-device", 2, now)
+	Track("m3", "", "consumer-sim", "consumer-target", "consumer-model", "consumer-device", 3, now)
+
+	// matched by message id, by correlation id, and an unmatched copy found by its sequence number
+	handle(kafka.Message{Value: []byte(`{"messageId":"m1"}`)}, now)
+	handle(kafka.Message{Value: []byte(`{"correlationId":"c2"}`)}, now)
+	handle(kafka.Message{Value: []byte(`{"messageId":"m1","deviceId":"consumer-device","telemetry":{"starlingSeq":1}}`)}, now)
+
+	if sm := sent.match("m3", ""); sm == nil || sm.sequence != 3 {
+		t.Errorf("expected the unconsumed message to still be tracked, got %v", sm)
+	}
+	if sm := sent.match("m1", ""); sm != nil {
+		t.Error("expected the consumed message to no longer be tracked")
+	}
+
+	// the verifier reading back the same messages does not make them duplicates of the consumed ones
+	Observe(SinkVerifier, "consumer-sim", "consumer-device", 1)
+	Observe(SinkVerifier, "consumer-sim", "consumer-device", 3)
+
+	reports := SequenceReport("consumer-sim", "consumer-device")
+	if len(reports) != 2 {
+		t.Fatalf("expected reports of both sinks, got %+v", reports)
+	}
+	if r := reports[0]; r.Sink != SinkConsumer || r.Sent != 3 || r.Received != 2 || r.Duplicates != 1 || r.Pending != 1 || r.Lost != 0 {
+		t.Errorf("unexpected consumer sequence report %+v", r)
+	}
+	if r := reports[1]; r.Sink != SinkVerifier || r.Received != 2 || r.Duplicates != 0 || r.Pending != 0 || r.Lost != 1 {
+		t.Errorf("unexpected verifier sequence report %+v", r)
+	}
+	if SequenceReport("other-sim", "consumer-device") != nil {
+		t.Error("expected no reports of the device in another simulation")
+	}
+}
+
+func TestSequencesOfSimulationsSharingDeviceIDs(t *testing.T) {
+	defer ResetSequences("shared-sim-1")
+	defer ResetSequences("shared-sim-2")
+
+	for seq := 1; seq <= 3; seq++ {
+		RecordSent("shared-sim-1", "shared-target", "shared-model", "shared-device", seq)
+	}
+	RecordSent("shared-sim-2", "shared-target", "shared-model", "shared-device", 1)
+
+	Observe(SinkVerifier, "shared-sim-1", "shared-device", 1)
+	Observe(SinkVerifier, "shared-sim-1", "shared-device", 3)
+	Observe(SinkVerifier, "shared-sim-2", "shared-device", 1)
+
+	// unattributed copies can't tell which simulation sent them
+	observeDevice(SinkConsumer, "shared-device", 1)
+
+	if r := SequenceReport("shared-sim-1", "shared-device"); len(r) != 1 || r[0].Sent != 3 || r[0].Received != 2 || r[0].Lost != 1 || r[0].Duplicates != 0 {
+		t.Errorf("unexpected sequence report of the first simulation %+v", r)
+	}
+	if r := SequenceReport("shared-sim-2", "shared-device"); len(r) != 1 || r[0].Sent != 1 || r[0].Received != 1 || r[0].Duplicates != 0 {
+		t.Errorf("unexpected sequence report of the second simulation %+v", r)
+	}
+
+	ResetSequences("shared-sim-2")
+	observeDevice(SinkConsumer, "shared-device", 1)
+	if r := SequenceReport("shared-sim-1", "shared-device"); len(r) != 2 || r[0].Sink != SinkConsumer || r[0].Received != 1 {
+		t.Errorf("expected the copy to be attributed to the only simulation of the device, got %+v", r)
+	}
+	if len(SequenceReports("shared-sim-2")) != 0 {
+		t.Error("expected no reports of the reset simulation")
+	}
+}
+
+func TestTrackDisabled(t *testing.T) {
+	if Enabled() {
+		t.Fatal("expected tracking to be disabled while the consumer is not running")
+	}
+
+	Track("disabled", "", "consumer-sim", "consumer-target", "consumer-model", "disabled-device", 1, time.Now())
+	if sm := sent.match("disabled", ""); sm != nil {
+		t.Error("expected nothing to be tracked while disabled")
+	}
+}
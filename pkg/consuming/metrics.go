@@ -0,0 +1,119 @@
+package consuming
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	endToEndLatency       *prometheus.HistogramVec
+	endToEndReceivedTotal *prometheus.CounterVec
+	endToEndLostTotal     *prometheus.CounterVec
+	consumedTotal         *prometheus.CounterVec
+	consumerErrorsTotal   prometheus.Counter
+
+	sequenceDuplicatesTotal *prometheus.CounterVec
+	deviceSequenceMetrics   *sequenceCollector
+)
+
+type (
+	// MetricVec is a collector of series labelled with the simulation whose series can be deleted.
+	MetricVec interface {
+		prometheus.Collector
+		Delete(labels prometheus.Labels) bool
+	}
+)
+
+// init initializes the metrics used by the consumer of the exported telemetry
+func init() {
+	endToEndLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "starling",
+			Subsystem: "simulating",
+			Name:      "telemetry_e2e_latency_seconds",
+			Help:      "Latency from sending telemetry until it was consumed from the IoT Central data export",
+			Buckets:   []float64{.1, .25, .5, 1, 2.5, 5, 10, 20, 30, 60, 120, 240, 480, 960},
+		},
+		[]string{"sim", "target", "model"},
+	)
+
+	endToEndReceivedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "starling",
+			Subsystem: "simulating",
+			Name:      "telemetry_e2e_received_total",
+			Help:      "Total telemetry messages consumed from the IoT Central data export.",
+		},
+		[]string{"sim", "target", "model"},
+	)
+
+	endToEndLostTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "starling",
+			Subsystem: "simulating",
+			Name:      "telemetry_e2e_lost_total",
+			Help:      "Total telemetry messages not consumed from the IoT Central data export within the match window.",
+		},
+		[]string{"sim", "target", "model"},
+	)
+
+	consumedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "starling",
+			Subsystem: "consuming",
+			Name:      "messages_total",
+			Help:      "Total messages consumed from the IoT Central data export by match result.",
+		},
+		[]string{"result"},
+	)
+
+	consumerErrorsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "starling",
+			Subsystem: "consuming",
+			Name:      "errors_total",
+			Help:      "Total errors consuming the IoT Central data export.",
+		},
+	)
+
+	sequenceDuplicatesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "starling",
+			Subsystem: "sequence",
+			Name:      "duplicates_total",
+			Help:      "Total telemetry messages observed more than once in a sink.",
+		},
+		[]string{"sim", "target", "model", "sink"},
+	)
+
+	deviceSequenceMetrics = &sequenceCollector{
+		lost: prometheus.NewDesc(
+			"starling_sequence_device_lost",
+			"Number of telemetry messages of a device missing in a sink before the last one observed.",
+			[]string{"sim", "target", "model", "device", "sink"}, nil,
+		),
+		duplicates: prometheus.NewDesc(
+			"starling_sequence_device_duplicates",
+			"Number of telemetry messages of a device observed more than once in a sink.",
+			[]string{"sim", "target", "model", "device", "sink"}, nil,
+		),
+	}
+
+	prometheus.MustRegister(
+		endToEndLatency,
+		endToEndReceivedTotal,
+		endToEndLostTotal,
+		consumedTotal,
+		consumerErrorsTotal,
+		sequenceDuplicatesTotal,
+		deviceSequenceMetrics,
+	)
+}
+
+// SimulationMetrics lists the collectors of the consumer metrics labelled with the simulation, so that their series
+// are deleted along with the other series of the simulation.
+func SimulationMetrics() []MetricVec {
+	return []MetricVec{
+		endToEndLatency,
+		endToEndReceivedTotal,
+		endToEndLostTotal,
+		sequenceDuplicatesTotal,
+	}
+}
@@ -0,0 +1,332 @@
+package consuming
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/iot-for-all/starling/pkg/models"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// SequenceField is the telemetry field carrying the sequence number of the message within the device.
+	SequenceField = "starlingSeq"
+	// SentTimeField is the telemetry field carrying the time the message was sent.
+	SentTimeField = "starlingSentTime"
+
+	// maxReportedGaps limits the number of gaps reported per device.
+	maxReportedGaps = 100
+)
+
+const (
+	// SinkVerifier is the sink of the telemetry read back from IoT Central by the delivery verifier.
+	SinkVerifier = "verifier"
+	// SinkConsumer is the sink of the telemetry consumed from the IoT Central data export.
+	SinkConsumer = "consumer"
+)
+
+type (
+	// rangeSet is a sorted set of sequence numbers stored as non-overlapping, non-adjacent ranges.
+	rangeSet []models.SequenceRange
+
+	// sinkSequences tracks the sequence numbers of a device observed in a sink.
+	sinkSequences struct {
+		observed   rangeSet // distinct sequence numbers observed.
+		duplicates int      // number of messages observed more than once.
+	}
+
+	// deviceSequences tracks the sequence numbers a device sent and the ones observed in each sink.
+	deviceSequences struct {
+		simulationID string                    // simulation of the device.
+		targetID     string                    // target application of the device.
+		modelID      string                    // model of the device.
+		sent         rangeSet                  // sequence numbers sent successfully.
+		sinks        map[string]*sinkSequences // sequence numbers observed by sink.
+	}
+
+	// deviceKey identifies a tracked device; simulations may reuse the device ids of others, even in the same target.
+	deviceKey struct {
+		simulationID string
+		deviceID     string
+	}
+
+	// sequenceTracker detects lost and duplicated telemetry by device from the sequence numbers of the messages.
+	sequenceTracker struct {
+		sync.Mutex
+		devices       map[deviceKey]*deviceSequences // tracked devices by simulation and device id.
+		deviceMetrics map[string]bool                // simulations publishing metrics per device.
+	}
+)
+
+var (
+	sequences = &sequenceTracker{
+		devices:       map[deviceKey]*deviceSequences{},
+		deviceMetrics: map[string]bool{},
+	} // sequence numbers of the tracked devices
+)
+
+// RecordSent records a telemetry message sent successfully by a device so that its delivery can be checked.
+func RecordSent(simulationID string, targetID string, modelID string, deviceID string, sequenceNumber int) {
+	sequences.Lock()
+	defer sequences.Unlock()
+
+	key := deviceKey{simulationID: simulationID, deviceID: deviceID}
+	ds, ok := sequences.devices[key]
+	if !ok {
+		ds = &deviceSequences{simulationID: simulationID, targetID: targetID, modelID: modelID, sinks: map[string]*sinkSequences{}}
+		sequences.devices[key] = ds
+	}
+	ds.sent.add(sequenceNumber)
+}
+
+// Observe records a telemetry message of a device of a simulation observed in a sink. Messages observed again in the
+// same sink are duplicates; messages of devices that have not recorded any sent messages are ignored.
+func Observe(sink string, simulationID string, deviceID string, sequenceNumber int) {
+	sequences.Lock()
+	defer sequences.Unlock()
+
+	ds, ok := sequences.devices[deviceKey{simulationID: simulationID, deviceID: deviceID}]
+	if !ok {
+		return
+	}
+	ds.observe(sink, sequenceNumber)
+}
+
+// observeDevice records a telemetry message observed in a sink whose simulation is unknown. It is attributed to the
+// only simulation tracking the device and ignored when several do, as it can't tell which one sent it.
+func observeDevice(sink string, deviceID string, sequenceNumber int) {
+	sequences.Lock()
+	defer sequences.Unlock()
+
+	var found *deviceSequences
+	for key, ds := range sequences.devices {
+		if key.deviceID != deviceID {
+			continue
+		}
+		if found != nil {
+			return
+		}
+		found = ds
+	}
+	if found != nil {
+		found.observe(sink, sequenceNumber)
+	}
+}
+
+// observe records a sequence number observed in a sink, counting it as a duplicate if it was observed before.
+func (ds *deviceSequences) observe(sink string, sequenceNumber int) {
+	ss, ok := ds.sinks[sink]
+	if !ok {
+		ss = &sinkSequences{}
+		ds.sinks[sink] = ss
+	}
+	if !ss.observed.add(sequenceNumber) {
+		ss.duplicates++
+		sequenceDuplicatesTotal.WithLabelValues(ds.simulationID, ds.targetID, ds.modelID, sink).Inc()
+	}
+}
+
+// EnableDeviceMetrics publishes the lost and duplicated telemetry of the devices of a simulation per device until its
+// sequences are reset. Only small simulations should, as every device adds its own series.
+func EnableDeviceMetrics(simulationID string) {
+	sequences.Lock()
+	defer sequences.Unlock()
+
+	sequences.deviceMetrics[simulationID] = true
+}
+
+// ResetSequences forgets the sequence numbers of the devices of a simulation, as they start over when it is restarted,
+// and stops publishing them per device.
+func ResetSequences(simulationID string) {
+	sequences.Lock()
+	defer sequences.Unlock()
+
+	delete(sequences.deviceMetrics, simulationID)
+
+	for key := range sequences.devices {
+		if key.simulationID == simulationID {
+			delete(sequences.devices, key)
+		}
+	}
+}
+
+// SequenceReports lists the sequence reports of the tracked devices of a simulation by sink, ordered by device id and
+// sink. Devices not observed in any sink yet are not listed.
+func SequenceReports(simulationID string) []models.DeviceSequenceReport {
+	sequences.Lock()
+	defer sequences.Unlock()
+
+	reports := make([]models.DeviceSequenceReport, 0)
+	for key, ds := range sequences.devices {
+		if key.simulationID == simulationID {
+			reports = append(reports, ds.reports(key.deviceID)...)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].DeviceID != reports[j].DeviceID {
+			return reports[i].DeviceID < reports[j].DeviceID
+		}
+		return reports[i].Sink < reports[j].Sink
+	})
+
+	return reports
+}
+
+// SequenceReport gets the sequence reports of a tracked device of a simulation by sink, nil if the device is not
+// tracked.
+func SequenceReport(simulationID string, deviceID string) []models.DeviceSequenceReport {
+	sequences.Lock()
+	defer sequences.Unlock()
+
+	ds, ok := sequences.devices[deviceKey{simulationID: simulationID, deviceID: deviceID}]
+	if !ok {
+		return nil
+	}
+
+	reports := ds.reports(deviceID)
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Sink < reports[j].Sink })
+	return reports
+}
+
+// reports compares the sent sequence numbers with the ones observed in each sink.
+func (ds *deviceSequences) reports(deviceID string) []models.DeviceSequenceReport {
+	reports := make([]models.DeviceSequenceReport, 0, len(ds.sinks))
+	for sink, ss := range ds.sinks {
+		reports = append(reports, ds.report(deviceID, sink, ss))
+	}
+
+	return reports
+}
+
+// report compares the sent sequence numbers with the ones observed in a sink. Messages sent before the highest one
+// observed but never observed themselves are lost; the ones sent after it may still arrive.
+func (ds *deviceSequences) report(deviceID string, sink string, ss *sinkSequences) models.DeviceSequenceReport {
+	report := models.DeviceSequenceReport{
+		DeviceID:     deviceID,
+		SimulationID: ds.simulationID,
+		TargetID:     ds.targetID,
+		ModelID:      ds.modelID,
+		Sink:         sink,
+		Sent:         ds.sent.count(),
+		Received:     ss.observed.count(),
+		Duplicates:   ss.duplicates,
+		Gaps:         []models.SequenceRange{},
+	}
+
+	if len(ss.observed) == 0 {
+		report.Pending = report.Sent
+		return report
+	}
+
+	report.HighestReceived = ss.observed[len(ss.observed)-1].To
+	for _, r := range ds.sent {
+		if r.From > report.HighestReceived {
+			report.Pending += r.To - r.From + 1
+			continue
+		}
+		to := r.To
+		if to > report.HighestReceived {
+			report.Pending += to - report.HighestReceived
+			to = report.HighestReceived
+		}
+		for _, gap := range ss.observed.missing(models.SequenceRange{From: r.From, To: to}) {
+			report.Lost += gap.To - gap.From + 1
+			if len(report.Gaps) < maxReportedGaps {
+				report.Gaps = append(report.Gaps, gap)
+			}
+		}
+	}
+
+	return report
+}
+
+// sequenceCollector publishes the lost and duplicated telemetry of the tracked devices of the simulations with metrics
+// per device. The reports are computed when the metrics are collected rather than on every message observed.
+type sequenceCollector struct {
+	lost       *prometheus.Desc
+	duplicates *prometheus.Desc
+}
+
+// Describe sends the descriptors of the device sequence metrics.
+func (c *sequenceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.lost
+	ch <- c.duplicates
+}
+
+// Collect computes the sequence reports of the tracked devices and sends them as gauges.
+func (c *sequenceCollector) Collect(ch chan<- prometheus.Metric) {
+	sequences.Lock()
+	defer sequences.Unlock()
+
+	for key, ds := range sequences.devices {
+		if !sequences.deviceMetrics[key.simulationID] {
+			continue
+		}
+		for _, report := range ds.reports(key.deviceID) {
+			labels := []string{report.SimulationID, report.TargetID, report.ModelID, key.deviceID, report.Sink}
+			ch <- prometheus.MustNewConstMetric(c.lost, prometheus.GaugeValue, float64(report.Lost), labels...)
+			ch <- prometheus.MustNewConstMetric(c.duplicates, prometheus.GaugeValue, float64(report.Duplicates), labels...)
+		}
+	}
+}
+
+// add adds a sequence number to the set, merging adjacent ranges. It returns false if the number was already in the set.
+func (s *rangeSet) add(n int) bool {
+	ranges := *s
+	i := sort.Search(len(ranges), func(i int) bool { return ranges[i].To >= n })
+	if i < len(ranges) && ranges[i].From <= n {
+		return false
+	}
+
+	extendsPrev := i > 0 && ranges[i-1].To == n-1
+	extendsNext := i < len(ranges) && ranges[i].From == n+1
+	switch {
+	case extendsPrev && extendsNext:
+		ranges[i-1].To = ranges[i].To
+		ranges = append(ranges[:i], ranges[i+1:]...)
+	case extendsPrev:
+		ranges[i-1].To = n
+	case extendsNext:
+		ranges[i].From = n
+	default:
+		ranges = append(ranges, models.SequenceRange{})
+		copy(ranges[i+1:], ranges[i:])
+		ranges[i] = models.SequenceRange{From: n, To: n}
+	}
+
+	*s = ranges
+	return true
+}
+
+// count returns the number of sequence numbers in the set.
+func (s rangeSet) count() int {
+	n := 0
+	for _, r := range s {
+		n += r.To - r.From + 1
+	}
+
+	return n
+}
+
+// missing returns the ranges within r that are not in the set.
+func (s rangeSet) missing(r models.SequenceRange) []models.SequenceRange {
+	gaps := make([]models.SequenceRange, 0)
+	next := r.From
+	for _, have := range s {
+		if have.To < next {
+			continue
+		}
+		if have.From > r.To {
+			break
+		}
+		if have.From > next {
+			gaps = append(gaps, models.SequenceRange{From: next, To: have.From - 1})
+		}
+		next = have.To + 1
+	}
+	if next <= r.To {
+		gaps = append(gaps, models.SequenceRange{From: next, To: r.To})
+	}
+
+	return gaps
+}
@@ -0,0 +1,120 @@
+package consuming
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxTrackedMessages limits the number of sent messages awaiting a match, further messages are not tracked.
+	maxTrackedMessages = 1000000
+)
+
+type (
+	// sentMessage is a telemetry message sent by a simulated device awaiting its exported copy.
+	sentMessage struct {
+		simulationID  string    // simulation of the device.
+		targetID      string    // target application of the device.
+		modelID       string    // model of the device.
+		deviceID      string    // device that sent the message.
+		sequence      int       // sequence number of the message within the device.
+		correlationID string    // correlation id of the message.
+		sentTime      time.Time // when the message was sent.
+	}
+
+	// tracker keeps the sent telemetry messages until they are consumed or expire.
+	tracker struct {
+		sync.Mutex
+		enabled      int32                   // whether messages are tracked at all, 1 if so. Read without the lock as every generated message checks it.
+		messages     map[string]*sentMessage // sent messages by message id.
+		correlations map[string]string       // message ids by correlation id.
+	}
+)
+
+var (
+	sent = &tracker{
+		messages:     map[string]*sentMessage{},
+		correlations: map[string]string{},
+	} // telemetry messages awaiting their exported copy
+)
+
+// Enabled tells whether sent telemetry is matched against the exported telemetry.
+func Enabled() bool {
+	return atomic.LoadInt32(&sent.enabled) == 1
+}
+
+// Track remembers a telemetry message sent successfully by a simulated device so that its end-to-end latency
+// can be measured when it is consumed from the export. Nothing is tracked unless the consumer is running.
+func Track(messageID string, correlationID string, simulationID string, targetID string, modelID string, deviceID string, sequenceNumber int, sentTime time.Time) {
+	sent.Lock()
+	defer sent.Unlock()
+
+	if !Enabled() || len(sent.messages) >= maxTrackedMessages {
+		return
+	}
+
+	RecordSent(simulationID, targetID, modelID, deviceID, sequenceNumber)
+	sent.messages[messageID] = &sentMessage{
+		simulationID:  simulationID,
+		targetID:      targetID,
+		modelID:       modelID,
+		deviceID:      deviceID,
+		sequence:      sequenceNumber,
+		correlationID: correlationID,
+		sentTime:      sentTime,
+	}
+	if len(correlationID) > 0 {
+		sent.correlations[correlationID] = messageID
+	}
+}
+
+// setEnabled starts or stops tracking sent messages. Tracked messages are dropped when stopping.
+func (t *tracker) setEnabled(enabled bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	if enabled {
+		atomic.StoreInt32(&t.enabled, 1)
+	} else {
+		atomic.StoreInt32(&t.enabled, 0)
+		t.messages = map[string]*sentMessage{}
+		t.correlations = map[string]string{}
+	}
+}
+
+// match removes and returns the sent message with the given message or correlation id, nil if there is none.
+func (t *tracker) match(messageID string, correlationID string) *sentMessage {
+	t.Lock()
+	defer t.Unlock()
+
+	if len(messageID) == 0 && len(correlationID) > 0 {
+		messageID = t.correlations[correlationID]
+	}
+
+	msg, ok := t.messages[messageID]
+	if !ok {
+		return nil
+	}
+
+	delete(t.messages, messageID)
+	delete(t.correlations, msg.correlationID)
+	return msg
+}
+
+// expire removes and returns the messages sent before the given time.
+func (t *tracker) expire(before time.Time) []*sentMessage {
+	t.Lock()
+	defer t.Unlock()
+
+	expired := make([]*sentMessage, 0)
+	for id, msg := range t.messages {
+		if msg.sentTime.Before(before) {
+			expired = append(expired, msg)
+			delete(t.messages, id)
+			delete(t.correlations, msg.correlationID)
+		}
+	}
+
+	return expired
+}
@@ -0,0 +1,203 @@
+package controlling
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/iot-for-all/starling/pkg/central"
+	"github.com/iot-for-all/starling/pkg/models"
+	"github.com/iot-for-all/starling/pkg/storing"
+	"github.com/rs/zerolog/log"
+)
+
+// PreviewCleanup finds the devices in the IoT Central application of the target that would be deleted by a cleanup.
+// Unless a prefix or pattern is given, devices are matched against the naming patterns of the simulations using the target.
+func (c *Controller) PreviewCleanup(ctx context.Context, target *models.SimulationTarget, req *models.CleanupRequest) (*models.CleanupPreview, error) {
+	patterns, err := cleanupPatterns(target, req)
+	if err != nil {
+		return nil, err
+	}
+
+	regexps := make([]*regexp.Regexp, len(patterns))
+	for i, p := range patterns {
+		if regexps[i], err = regexp.Compile(p); err != nil {
+			return nil, fmt.Errorf("invalid device id pattern '%s': %w", p, err)
+		}
+	}
+
+	active, err := activeDevices(target, req)
+	if err != nil {
+		return nil, err
+	}
+
+	centralDevices, err := central.NewClient(target).ListDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &models.CleanupPreview{
+		TargetID: target.ID,
+		Patterns: patterns,
+		Devices:  []models.ReconcileDevice{},
+	}
+	for _, rd := range centralDevices {
+		matched := false
+		for _, re := range regexps {
+			if re.MatchString(rd.ID) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		if active[rd.ID] {
+			preview.Skipped++
+			continue
+		}
+
+		preview.Devices = append(preview.Devices, models.ReconcileDevice{
+			DeviceID:    rd.ID,
+			DisplayName: rd.DisplayName,
+			Template:    rd.Template,
+		})
+	}
+
+	log.Debug().
+		Str("targetID", target.ID).
+		Int("devices", len(preview.Devices)).
+		Int("skipped", preview.Skipped).
+		Msg("previewed target cleanup")
+
+	return preview, nil
+}
+
+// StartCleanupJob starts a background job that deletes the devices previewed by PreviewCleanup from the target. The
+// devices listed in the request are deleted as previewed, otherwise the devices are found by a new preview.
+func (c *Controller) StartCleanupJob(ctx context.Context, target *models.SimulationTarget, req *models.CleanupRequest) (*models.Job, error) {
+	deviceIDs := req.DeviceIDs
+	if len(deviceIDs) == 0 {
+		preview, err := c.PreviewCleanup(ctx, target, req)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range preview.Devices {
+			deviceIDs = append(deviceIDs, d.DeviceID)
+		}
+	}
+
+	// devices that joined a simulation since the preview are still protected
+	active, err := activeDevices(target, req)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := newJob(models.JobTypeCleanup, nil, target)
+	if err != nil {
+		return nil, err
+	}
+
+	task := models.JobTask{Action: models.JobActionDelete}
+	for _, deviceID := range deviceIDs {
+		if active[deviceID] {
+			log.Warn().Str("targetID", target.ID).Str("deviceID", deviceID).Msg("skipped cleaning up device of an existing simulation")
+			continue
+		}
+		task.DeviceIDs = append(task.DeviceIDs, deviceID)
+	}
+	job.Tasks = append(job.Tasks, task)
+
+	if err := c.startJob(job, nil, target, ""); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// cleanupPatterns gets the regular expressions matching the device ids to clean up.
+func cleanupPatterns(target *models.SimulationTarget, req *models.CleanupRequest) ([]string, error) {
+	if len(req.Prefix) > 0 || len(req.Pattern) > 0 {
+		patterns := make([]string, 0, 2)
+		if len(req.Prefix) > 0 {
+			patterns = append(patterns, "^"+regexp.QuoteMeta(req.Prefix))
+		}
+		if len(req.Pattern) > 0 {
+			patterns = append(patterns, req.Pattern)
+		}
+		return patterns, nil
+	}
+
+	// simulations known to have used the target, including deleted ones whose devices are still cached
+	simIDs := make(map[string]bool)
+	devices, err := storing.TargetDevices.List(target.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range devices {
+		if len(d.SimulationID) > 0 {
+			simIDs[d.SimulationID] = true
+		}
+	}
+
+	patterns := make([]string, 0)
+	sims, err := storing.Simulations.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, sim := range sims {
+		if sim.TargetID != target.ID {
+			continue
+		}
+		delete(simIDs, sim.ID)
+		deviceConfigs, err := storing.DeviceConfigs.List(sim.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, dc := range deviceConfigs {
+			patterns = append(patterns, dc.DeviceIDPattern(sim.ID, target.ID))
+		}
+	}
+
+	// devices left behind by deleted simulations follow the default naming of their simulation
+	ids := make([]string, 0, len(simIDs))
+	for simID := range simIDs {
+		ids = append(ids, simID)
+	}
+	sort.Strings(ids)
+	for _, simID := range ids {
+		// models.DefaultDeviceIDTemplate with any model
+		patterns = append(patterns, fmt.Sprintf(`^%s-%s-.+-\d+$`, regexp.QuoteMeta(simID), regexp.QuoteMeta(target.ID)))
+	}
+
+	return patterns, nil
+}
+
+// activeDevices gets the devices of the existing simulations using the target, which are not orphaned. No devices are
+// active if the request includes them.
+func activeDevices(target *models.SimulationTarget, req *models.CleanupRequest) (map[string]bool, error) {
+	active := make(map[string]bool)
+	if req.IncludeActive {
+		return active, nil
+	}
+
+	sims, err := storing.Simulations.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, sim := range sims {
+		if sim.TargetID != target.ID {
+			continue
+		}
+		devices, err := storing.TargetDevices.ListByTargetIdSimId(target.ID, sim.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range devices {
+			active[d.DeviceID] = true
+		}
+	}
+
+	return active, nil
+}
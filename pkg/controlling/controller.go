@@ -2,8 +2,12 @@ package controlling
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/iot-for-all/starling/pkg/central"
 	"github.com/iot-for-all/starling/pkg/config"
+	"github.com/iot-for-all/starling/pkg/eventing"
+	"github.com/iot-for-all/starling/pkg/exporting"
 	"github.com/iot-for-all/starling/pkg/models"
 	"github.com/iot-for-all/starling/pkg/simulating"
 	"github.com/iot-for-all/starling/pkg/storing"
@@ -13,19 +17,26 @@ import (
 	"time"
 )
 
+// maxProvisioningFailureReasons is the number of provisioning failure reasons shown for a simulation.
+const maxProvisioningFailureReasons = 5
+
 // Controller responsible for starting and stopping simulations; provisioning and deleting devices from a target application.
 type Controller struct {
 	context     context.Context      // parent program context.
 	globalCfg   *config.GlobalConfig // global configuration.
 	simulations map[string]*simulating.Simulator
+	jobs        map[string]context.CancelFunc // cancel functions of the running jobs.
+	jobsMutex   sync.Mutex                    // guards the running jobs.
+	jobsDone    sync.WaitGroup                // tracks the running jobs until they return.
 }
 
 // NewController creates a new controller.
-func NewController(context context.Context, globalConfig *config.GlobalConfig) *Controller {
+func NewController(ctx context.Context, globalConfig *config.GlobalConfig) *Controller {
 	return &Controller{
-		context:     context,
+		context:     ctx,
 		globalCfg:   globalConfig,
 		simulations: map[string]*simulating.Simulator{},
+		jobs:        map[string]context.CancelFunc{},
 	}
 }
 
@@ -56,70 +67,27 @@ func (c *Controller) StopSimulation(simulation *models.Simulation) error {
 	}
 
 	delete(c.simulations, simulation.ID)
-	return nil
-}
-
-// ProvisionDevices provisions devices in a target based on the deviceConfig.
-func (c *Controller) ProvisionDevices(ctx context.Context, simulation *models.Simulation, target *models.SimulationTarget, model *models.DeviceModel, maxDeviceID int, numDevices int) error {
-	provisioner := simulating.NewProvisioner(c.context, &c.globalCfg.Simulation)
-
-	wg := sync.WaitGroup{}
-	for i := 1; i <= numDevices; i++ {
-		select {
-		case <-ctx.Done():
-			return nil
-		default:
-			deviceID := fmt.Sprintf("%s-%s-%s-%d",
-				simulation.ID,
-				target.ID,
-				model.ID,
-				maxDeviceID+i)
-
-			wg.Add(1)
-			go c.provisionDevice(simulation, target, model, deviceID, provisioner, &wg)
-
-			// throttle DPS registrations
-			if i%c.globalCfg.Simulation.MaxConcurrentRegistrations == 0 {
-				wg.Wait()
-			}
-
-			if i%10 == 0 {
-				log.Debug().
-					Int("provisioned", i).
-					Int("remaining", numDevices-i).
-					Str("modelID", model.ID).
-					Msg("provisioning in progress")
-			}
-		}
-	}
-	wg.Wait()
-
-	log.Debug().
-		Int("provisioned", numDevices).
-		Str("modelID", model.ID).
-		Msg("provisioning completed")
 
+	// push the final values of the metrics of the simulation without holding up the response
+	go exporting.Flush()
 	return nil
 }
 
 // provisionDevice provisions a device in IoT Central and saves it into the database cache.
-func (c *Controller) provisionDevice(simulation *models.Simulation, target *models.SimulationTarget,
-	model *models.DeviceModel, deviceID string, provisioner *simulating.DeviceProvisioner,
-	wg *sync.WaitGroup) {
-	defer wg.Done()
-
+func (c *Controller) provisionDevice(ctx context.Context, simulation *models.Simulation, target *models.SimulationTarget,
+	model *models.DeviceModel, deviceID string, index int, provisioner *simulating.DeviceProvisioner) error {
 	req := &simulating.ProvisioningRequest{
 		DeviceID:   deviceID,
-		Context:    c.context,
+		Context:    ctx,
 		Target:     target,
 		Simulation: simulation,
 		Model:      model,
 	}
 
 	// call DPS to register the device
-	result := provisioner.Provision(req)
-	if result == nil {
-		return
+	result, err := provisioner.Provision(req)
+	if err != nil {
+		return err
 	}
 
 	// cache the device for future use
@@ -127,122 +95,32 @@ func (c *Controller) provisionDevice(simulation *models.Simulation, target *mode
 		TargetID:         req.Target.ID,
 		DeviceID:         req.DeviceID,
 		ConnectionString: result.ConnectionString,
+		SimulationID:     simulation.ID,
+		ModelID:          model.ID,
+		Index:            index,
 	}
-	storing.TargetDevices.Set(&newDevice)
-	//log.Debug().Str("deviceId", req.DeviceID).Msg("saved device in cache")
-}
-
-func (c *Controller) DeleteAllDevices(ctx context.Context, sim *models.Simulation, target *models.SimulationTarget) error {
-	targetDevices, err := storing.TargetDevices.ListByTargetIdSimId(target.ID, sim.ID)
-	if err != nil {
-		return err
-	}
-
-	wg := sync.WaitGroup{}
-
-	numDevices := len(targetDevices)
-	for i, td := range targetDevices {
-		select {
-		case <-ctx.Done():
-			return nil
-		default:
-
-			wg.Add(1)
-			go c.deleteDevice(ctx, target, td.DeviceID, &wg)
-
-			// throttle API calls to Central
-			if i%c.globalCfg.Simulation.MaxConcurrentDeletes == 0 {
-				wg.Wait()
-			}
-
-			if i%10 == 0 {
-				log.Debug().
-					Int("deleted", i+1).
-					Int("remaining", numDevices-i-1).
-					Str("simId", sim.ID).
-					Msg("deleting devices in progress")
-			}
-		}
-	}
-	wg.Wait()
-
-	log.Debug().
-		Int("deleted", numDevices).
-		Str("simId", sim.ID).
-		Msg("deleting devices completed")
-
-	return nil
-
-}
-
-// DeleteDevices deletes devices in a target based on the deviceConfig.
-func (c *Controller) DeleteDevices(ctx context.Context, simulation *models.Simulation, target *models.SimulationTarget, model *models.DeviceModel, maxDeviceID int, numDevices int) error {
-	wg := sync.WaitGroup{}
-
-	for i := 0; i < numDevices; i++ {
-		select {
-		case <-ctx.Done():
-			return nil
-		default:
-			deviceID := fmt.Sprintf("%s-%s-%s-%d",
-				simulation.ID,
-				target.ID,
-				model.ID,
-				maxDeviceID-i)
-
-			wg.Add(1)
-			go c.deleteDevice(ctx, target, deviceID, &wg)
-
-			// throttle API calls to Central
-			if i%c.globalCfg.Simulation.MaxConcurrentDeletes == 0 {
-				wg.Wait()
-			}
-
-			if i%10 == 0 {
-				log.Debug().
-					Int("deleted", i+1).
-					Int("remaining", numDevices-i-1).
-					Str("modelID", model.ID).
-					Msg("deleting devices in progress")
-			}
-		}
+	if err := storing.TargetDevices.Set(&newDevice); err != nil {
+		return fmt.Errorf("error caching device connection string: %w", err)
 	}
-	wg.Wait()
-
-	log.Debug().
-		Int("deleted", numDevices).
-		Str("modelID", model.ID).
-		Msg("deleting devices completed")
-
+	//log.Debug().Str("deviceId", req.DeviceID).Msg("saved device in cache")
 	return nil
 }
 
 // deleteDevice deletes a device from the target application and local database cache
-func (c *Controller) deleteDevice(ctx context.Context, target *models.SimulationTarget, deviceID string, wg *sync.WaitGroup) {
-	defer wg.Done()
-
-	path := fmt.Sprintf("https://%s/api/devices/%s?api-version=1.0", target.AppUrl, deviceID)
-	req, err := http.NewRequestWithContext(ctx, "DELETE", path, nil)
-	if err != nil {
-		log.Err(err).Str("deviceID", deviceID).Msg("error creating deprovision request")
-		return
-	}
+func (c *Controller) deleteDevice(ctx context.Context, target *models.SimulationTarget, deviceID string) error {
+	err := central.NewClient(target).DeleteDevice(ctx, deviceID)
 
-	req.Header.Add("Authorization", target.AppToken)
-	client := http.Client{
-		Timeout: time.Duration(10) * time.Second,
-	}
-	_, err = client.Do(req)
-	if err != nil {
-		log.Err(err).Str("deviceID", deviceID).Msg("error executing delete request")
-		// ignore delete errors
+	// device might have been deleted from Central already, treat it as deleted
+	if err != nil && !errors.Is(err, central.ErrNotFound) {
+		return fmt.Errorf("error deleting device from Central: %w", err)
 	}
 
 	// user might want to delete devices from Central that might not exist in client side case
 	// ignore errors
 	_ = storing.TargetDevices.Delete(target.ID, deviceID)
 
-	log.Trace().Str("deviceID", deviceID).Str("path", path).Msg("deleted device")
+	log.Trace().Str("deviceID", deviceID).Str("target", target.ID).Msg("deleted device")
+	return nil
 }
 
 // ResetSimulationStatus resets all simulation status to stopped
@@ -259,8 +137,11 @@ func (c *Controller) ResetSimulationStatus() error {
 		if err != nil {
 			return err
 		}
+		eventing.PublishStatus(&sim)
 	}
-	return nil
+
+	// pick up the jobs that were interrupted by a restart where they stopped
+	return c.resumeJobs()
 }
 
 // GetConnectedDeviceCount returns the number of devices connected for the given simulation and model
@@ -273,6 +154,28 @@ func (c *Controller) GetConnectedDeviceCount(simulation *models.Simulation, mode
 	return sim.GetConnectedDeviceCount(modelId)
 }
 
+// GetSimulationMetrics summarizes the current metrics of a simulation from the in-process collectors.
+func (c *Controller) GetSimulationMetrics(simulation *models.Simulation) *models.SimulationMetricsSummary {
+	summary := simulating.Summary(simulation.ID)
+	summary.Billing = simulating.EstimateBilling(simulation, summary)
+	return summary
+}
+
+// GetBillingEstimate estimates the IoT Central messages billed for a simulation.
+func (c *Controller) GetBillingEstimate(simulation *models.Simulation) *models.BillingEstimate {
+	return simulating.EstimateBilling(simulation, simulating.Summary(simulation.ID))
+}
+
+// GetProvisioningFailures lists the most frequent reasons devices of a simulation failed provisioning.
+func (c *Controller) GetProvisioningFailures(simulation *models.Simulation) []models.ProvisioningFailure {
+	return simulating.ProvisioningFailures(simulation.ID, maxProvisioningFailureReasons)
+}
+
+// GetDeviceEvents lists the recent lifecycle events of a device of a simulation, nil if none were recorded.
+func (c *Controller) GetDeviceEvents(simulation *models.Simulation, deviceID string) []models.DeviceEvent {
+	return simulating.DeviceEvents(simulation.ID, deviceID)
+}
+
 func (c *Controller) GetMetricsStatus(ctx context.Context) models.MetricsStatus {
 	return models.MetricsStatus{
 		GrafanaServer:    c.getServerStatus(ctx, "Grafana", c.globalCfg.HTTP.GrafanaPort),
@@ -298,3 +201,20 @@ func (c *Controller) getServerStatus(ctx context.Context, name string, portNumbe
 	}
 	return true
 }
+
+// deviceConfigForModel gets the device config of the simulation that names the devices of the model.
+// The default naming is used if the simulation has no device config for the model.
+func deviceConfigForModel(simulationID string, modelID string) (*models.SimulationDeviceConfig, error) {
+	deviceConfigs, err := storing.DeviceConfigs.List(simulationID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dc := range deviceConfigs {
+		if dc.ModelID == modelID {
+			return dc, nil
+		}
+	}
+
+	return &models.SimulationDeviceConfig{ID: modelID, ModelID: modelID}, nil
+}
@@ -0,0 +1,648 @@
+package controlling
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/iot-for-all/starling/pkg/eventing"
+	"github.com/iot-for-all/starling/pkg/models"
+	"github.com/iot-for-all/starling/pkg/simulating"
+	"github.com/iot-for-all/starling/pkg/storing"
+	"github.com/rs/zerolog/log"
+)
+
+// StartProvisionJob starts a background job that provisions or deletes devices in the target
+// so that the number of provisioned devices for each model matches the requested count.
+func (c *Controller) StartProvisionJob(sim *models.Simulation, target *models.SimulationTarget, deviceConfigs []models.SimulationViewDeviceConfig) (*models.Job, error) {
+	job, err := newJob(models.JobTypeProvision, sim, target)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dc := range deviceConfigs {
+		model, err := storing.DeviceModels.Get(dc.ModelID)
+		if err != nil {
+			return nil, err
+		}
+		if model == nil {
+			return nil, fmt.Errorf("could not find model '%s' to provision devices", dc.ModelID)
+		}
+
+		deviceConfig, err := deviceConfigForModel(sim.ID, model.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		existing, err := storing.TargetDevices.ListByModel(target.ID, sim.ID, model.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		numDevicesRequested := dc.ProvisionedCount
+		numDevicesExisting := len(existing)
+		if maxDevices := deviceConfig.MaxDevices(); maxDevices >= 0 && numDevicesRequested > maxDevices {
+			return nil, fmt.Errorf("cannot provision %d devices of model '%s' as only %d device ids are given", numDevicesRequested, model.ID, maxDevices)
+		}
+
+		if numDevicesRequested > numDevicesExisting {
+			// overall more devices are requested, so provision the difference
+			task := models.JobTask{Action: models.JobActionProvision, ModelID: model.ID}
+			provisioned := make(map[string]bool, numDevicesExisting)
+			maxDeviceIndex := 0
+			for _, d := range existing {
+				provisioned[d.DeviceID] = true
+				if maxDeviceIndex < d.DeviceIndex() {
+					maxDeviceIndex = d.DeviceIndex()
+				}
+			}
+
+			// explicit device ids are used in order skipping the ones already provisioned
+			index := maxDeviceIndex
+			if deviceConfig.MaxDevices() >= 0 {
+				index = 0
+			}
+			for len(task.DeviceIDs) < numDevicesRequested-numDevicesExisting {
+				index++
+				deviceID := deviceConfig.DeviceID(sim.ID, target.ID, index)
+				if len(deviceID) == 0 {
+					break
+				}
+				if provisioned[deviceID] {
+					continue
+				}
+				task.DeviceIDs = append(task.DeviceIDs, deviceID)
+				task.Indexes = append(task.Indexes, index)
+			}
+			job.Tasks = append(job.Tasks, task)
+		} else if numDevicesRequested < numDevicesExisting {
+			// overall less devices are requested, so delete the excess devices starting from the newest
+			task := models.JobTask{Action: models.JobActionDelete, ModelID: model.ID}
+			for i := numDevicesExisting - 1; i >= numDevicesRequested; i-- {
+				task.DeviceIDs = append(task.DeviceIDs, existing[i].DeviceID)
+			}
+			job.Tasks = append(job.Tasks, task)
+		} else {
+			// old and new counts are same, ignore the request for this model
+			log.Debug().Str("simID", sim.ID).Str("target", target.ID).
+				Str("model", model.ID).Int("numDevicesExisting", numDevicesExisting).
+				Int("numDevicesRequested", numDevicesRequested).Msg("ignoring provision devices as there is nothing to do")
+		}
+	}
+
+	if err := c.startJob(job, sim, target, jobSimulationStatus(job.Type)); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// StartDeleteSimulationJob starts a background job that deletes all devices of the simulation
+// from the target and then deletes the simulation along with its device configurations.
+func (c *Controller) StartDeleteSimulationJob(sim *models.Simulation, target *models.SimulationTarget) (*models.Job, error) {
+	targetDevices, err := storing.TargetDevices.ListByTargetIdSimId(target.ID, sim.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := newJob(models.JobTypeDeleteSimulation, sim, target)
+	if err != nil {
+		return nil, err
+	}
+
+	task := models.JobTask{Action: models.JobActionDelete}
+	for _, td := range targetDevices {
+		task.DeviceIDs = append(task.DeviceIDs, td.DeviceID)
+	}
+	job.Tasks = append(job.Tasks, task)
+
+	if err := c.startJob(job, sim, target, jobSimulationStatus(job.Type)); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// StartDeleteDevicesJob starts a background job that deletes the newest devices of a model that were provisioned by the
+// simulation in the target, or all devices of the simulation if modelID is empty.
+func (c *Controller) StartDeleteDevicesJob(sim *models.Simulation, target *models.SimulationTarget, modelID string, numDevices int) (*models.Job, error) {
+	var existing []models.SimulationTargetDevice
+	var err error
+	if len(modelID) > 0 {
+		existing, err = storing.TargetDevices.ListByModel(target.ID, sim.ID, modelID)
+	} else {
+		existing, err = storing.TargetDevices.ListByTargetIdSimId(target.ID, sim.ID)
+		numDevices = len(existing)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := newJob(models.JobTypeDeleteDevices, sim, target)
+	if err != nil {
+		return nil, err
+	}
+
+	if numDevices > len(existing) {
+		numDevices = len(existing)
+	}
+	task := models.JobTask{Action: models.JobActionDelete, ModelID: modelID}
+	for i := len(existing) - 1; i >= len(existing)-numDevices; i-- {
+		task.DeviceIDs = append(task.DeviceIDs, existing[i].DeviceID)
+	}
+	job.Tasks = append(job.Tasks, task)
+
+	if err := c.startJob(job, sim, target, jobSimulationStatus(job.Type)); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// ListJobs lists all jobs, optionally filtered by the simulation they belong to.
+func (c *Controller) ListJobs(simulationID string) ([]models.Job, error) {
+	jobs, err := storing.Jobs.List()
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]models.Job, 0, len(jobs))
+	for _, job := range jobs {
+		if len(simulationID) == 0 || job.SimulationID == simulationID {
+			items = append(items, job)
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].CreatedTime.After(items[j].CreatedTime)
+	})
+
+	return items, nil
+}
+
+// GetJob gets a job by its id.
+func (c *Controller) GetJob(id string) (*models.Job, error) {
+	return storing.Jobs.Get(id)
+}
+
+// CancelJob cancels a running job. Devices that are being processed at the moment are completed first.
+func (c *Controller) CancelJob(id string) error {
+	c.jobsMutex.Lock()
+	defer c.jobsMutex.Unlock()
+
+	cancel, ok := c.jobs[id]
+	if !ok {
+		return fmt.Errorf("job %s is not running. nothing to cancel", id)
+	}
+
+	cancel()
+	return nil
+}
+
+// RetryJob runs a finished job again for the devices that failed or were not processed before it was cancelled.
+func (c *Controller) RetryJob(id string) (*models.Job, error) {
+	job, err := storing.Jobs.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, nil
+	}
+	if !job.IsFinished() {
+		return nil, fmt.Errorf("job %s is in '%s' status. only finished jobs can be retried", id, job.Status)
+	}
+
+	// target level jobs do not belong to a simulation
+	var sim *models.Simulation
+	if len(job.SimulationID) > 0 {
+		sim, err = storing.Simulations.Get(job.SimulationID)
+		if err != nil {
+			return nil, err
+		}
+		if sim == nil {
+			return nil, fmt.Errorf("simulation %s of job %s does not exist anymore", job.SimulationID, id)
+		}
+		if sim.Status != models.SimulationStatusReady {
+			return nil, fmt.Errorf("job %s cannot be retried while the simulation is in '%s' status", id, sim.Status)
+		}
+	}
+
+	target, err := storing.Targets.Get(job.TargetID)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return nil, fmt.Errorf("target %s of job %s does not exist anymore", job.TargetID, id)
+	}
+
+	// collect the failed devices along with the ones that were never processed
+	var tasks []models.JobTask
+	taskIndex := make(map[string]int)
+	addDevice := func(action models.JobAction, modelID string, deviceID string, index int) {
+		key := fmt.Sprintf("%s/%s", action, modelID)
+		i, ok := taskIndex[key]
+		if !ok {
+			i = len(tasks)
+			taskIndex[key] = i
+			tasks = append(tasks, models.JobTask{Action: action, ModelID: modelID})
+		}
+		tasks[i].DeviceIDs = append(tasks[i].DeviceIDs, deviceID)
+		if action == models.JobActionProvision {
+			tasks[i].Indexes = append(tasks[i].Indexes, index)
+		}
+	}
+	for _, f := range job.Failures {
+		addDevice(f.Action, f.ModelID, f.DeviceID, f.Index)
+	}
+	for _, task := range job.Tasks {
+		for i := task.Processed; i < len(task.DeviceIDs); i++ {
+			addDevice(task.Action, task.ModelID, task.DeviceIDs[i], task.DeviceIndex(i))
+		}
+	}
+
+	if len(tasks) == 0 && job.Status == models.JobStatusCompleted {
+		return nil, fmt.Errorf("job %s completed successfully. nothing to retry", id)
+	}
+
+	job.Tasks = tasks
+	job.Failures = []models.JobFailure{}
+	job.Error = ""
+	job.Succeeded = 0
+
+	if err := c.startJob(job, sim, target, jobSimulationStatus(job.Type)); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// WaitForJobs waits for the running jobs to return once the program context is cancelled. Jobs suspend after the batch
+// of devices they are processing, so that they no longer use the store when it is closed.
+func (c *Controller) WaitForJobs() {
+	c.jobsDone.Wait()
+}
+
+// resumeJobs resumes the jobs that were still running when the program stopped. Each job continues
+// from the last batch of devices it saved, so devices that were already processed are not touched again.
+func (c *Controller) resumeJobs() error {
+	jobs, err := storing.Jobs.List()
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedTime.Before(jobs[j].CreatedTime)
+	})
+
+	resumed, failed := 0, 0
+	for i := range jobs {
+		job := &jobs[i]
+		if job.IsFinished() {
+			continue
+		}
+
+		if err := c.resumeJob(job); err != nil {
+			log.Error().Err(err).Str("jobID", job.ID).Str("simID", job.SimulationID).Msg("error resuming job")
+			job.Status = models.JobStatusFailed
+			job.Error = fmt.Sprintf("could not resume job after restart: %s", err.Error())
+			job.LastUpdatedTime = time.Now()
+			if err := storing.Jobs.Set(job); err != nil {
+				return err
+			}
+			failed++
+			continue
+		}
+		resumed++
+	}
+
+	if resumed > 0 || failed > 0 {
+		log.Info().Int("resumed", resumed).Int("failed", failed).Msg("recovered jobs interrupted by a restart")
+	}
+
+	return nil
+}
+
+// resumeJob restarts an interrupted job for the devices it has not processed yet.
+func (c *Controller) resumeJob(job *models.Job) error {
+	var sim *models.Simulation
+	var err error
+	if len(job.SimulationID) > 0 {
+		sim, err = storing.Simulations.Get(job.SimulationID)
+		if err != nil {
+			return err
+		}
+	}
+	if sim == nil && len(job.SimulationID) > 0 {
+		// the simulation was removed right before the restart, so the delete simulation job is done
+		if job.Type == models.JobTypeDeleteSimulation {
+			for t := range job.Tasks {
+				job.Succeeded += len(job.Tasks[t].DeviceIDs) - job.Tasks[t].Processed
+				job.Tasks[t].Processed = len(job.Tasks[t].DeviceIDs)
+			}
+			job.Status = models.JobStatusCompleted
+			job.LastUpdatedTime = time.Now()
+			return storing.Jobs.Set(job)
+		}
+		return fmt.Errorf("simulation %s does not exist anymore", job.SimulationID)
+	}
+
+	target, err := storing.Targets.Get(job.TargetID)
+	if err != nil {
+		return err
+	}
+	if target == nil {
+		return fmt.Errorf("target %s does not exist anymore", job.TargetID)
+	}
+
+	remaining := 0
+	for _, task := range job.Tasks {
+		remaining += len(task.DeviceIDs) - task.Processed
+	}
+
+	job.Resumes++
+	log.Info().
+		Str("jobID", job.ID).
+		Str("type", string(job.Type)).
+		Str("simID", job.SimulationID).
+		Int("succeeded", job.Succeeded).
+		Int("failed", len(job.Failures)).
+		Int("remaining", remaining).
+		Msg("resuming job")
+
+	return c.startJob(job, sim, target, jobSimulationStatus(job.Type))
+}
+
+// jobSimulationStatus returns the status of a simulation while a job of the type runs for it.
+func jobSimulationStatus(jobType models.JobType) models.SimulationStatus {
+	switch jobType {
+	case models.JobTypeDeleteSimulation:
+		return models.SimulationStatusDeleting
+	case models.JobTypeDeleteDevices:
+		return models.SimulationStatusDeletingDevices
+	default:
+		return models.SimulationStatusProvisioning
+	}
+}
+
+// isShuttingDown returns true if the program is stopping.
+func (c *Controller) isShuttingDown() bool {
+	return c.context.Err() != nil
+}
+
+// newJob creates a new pending job for the simulation.
+func newJob(jobType models.JobType, sim *models.Simulation, target *models.SimulationTarget) (*models.Job, error) {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	simID := ""
+	if sim != nil {
+		simID = sim.ID
+	}
+
+	now := time.Now()
+	return &models.Job{
+		ID:              id,
+		Type:            jobType,
+		SimulationID:    simID,
+		TargetID:        target.ID,
+		Status:          models.JobStatusPending,
+		Failures:        []models.JobFailure{},
+		CreatedTime:     now,
+		LastUpdatedTime: now,
+	}, nil
+}
+
+// startJob saves the job and runs it in the background.
+func (c *Controller) startJob(job *models.Job, sim *models.Simulation, target *models.SimulationTarget, simStatus models.SimulationStatus) error {
+	c.jobsMutex.Lock()
+	defer c.jobsMutex.Unlock()
+
+	for id := range c.jobs {
+		running, err := storing.Jobs.Get(id)
+		if err != nil || running == nil {
+			continue
+		}
+		if sim != nil && running.SimulationID == sim.ID {
+			return fmt.Errorf("job %s is already running for simulation %s. cancel it or wait for it to finish", id, sim.ID)
+		}
+		if sim == nil && len(running.SimulationID) == 0 && running.TargetID == target.ID {
+			return fmt.Errorf("job %s is already running for target %s. cancel it or wait for it to finish", id, target.ID)
+		}
+	}
+
+	job.Total = 0
+	for _, task := range job.Tasks {
+		job.Total += len(task.DeviceIDs)
+	}
+	job.Status = models.JobStatusRunning
+	job.LastUpdatedTime = time.Now()
+	if err := storing.Jobs.Set(job); err != nil {
+		return err
+	}
+
+	if sim != nil {
+		sim.Status = simStatus
+		sim.LastUpdatedTime = time.Now()
+		if err := storing.Simulations.Set(sim); err != nil {
+			return err
+		}
+		eventing.PublishStatus(sim)
+	}
+
+	ctx, cancel := context.WithCancel(c.context)
+	c.jobs[job.ID] = cancel
+
+	log.Debug().Str("jobID", job.ID).Str("type", string(job.Type)).Str("simID", job.SimulationID).Int("total", job.Total).Msg("starting job")
+	c.jobsDone.Add(1)
+	go c.runJob(ctx, job, sim, target)
+
+	return nil
+}
+
+// runJob processes all the devices in the job and records the outcome.
+func (c *Controller) runJob(ctx context.Context, job *models.Job, sim *models.Simulation, target *models.SimulationTarget) {
+	defer c.jobsDone.Done()
+	defer func() {
+		c.jobsMutex.Lock()
+		defer c.jobsMutex.Unlock()
+		if cancel, ok := c.jobs[job.ID]; ok {
+			cancel()
+			delete(c.jobs, job.ID)
+		}
+	}()
+
+	provisioner := simulating.NewProvisioner(ctx, &c.globalCfg.Simulation)
+	deviceModels := make(map[string]*models.DeviceModel)
+
+	for t := range job.Tasks {
+		task := &job.Tasks[t]
+
+		var model *models.DeviceModel
+		if task.Action == models.JobActionProvision {
+			var ok bool
+			if model, ok = deviceModels[task.ModelID]; !ok {
+				m, err := storing.DeviceModels.Get(task.ModelID)
+				if err == nil && m == nil {
+					err = fmt.Errorf("could not find model '%s'", task.ModelID)
+				}
+				if err != nil {
+					c.finishJob(job, sim, fmt.Errorf("error provisioning devices: %w", err))
+					return
+				}
+				model = m
+				deviceModels[task.ModelID] = model
+			}
+		}
+
+		eventType := models.SimulationEventProvisioning
+		maxConcurrent := c.globalCfg.Simulation.MaxConcurrentRegistrations
+		process := func(i int) error {
+			return c.provisionDevice(ctx, sim, target, model, task.DeviceIDs[i], task.DeviceIndex(i), provisioner)
+		}
+		if task.Action == models.JobActionDelete {
+			eventType = models.SimulationEventDeleting
+			maxConcurrent = c.globalCfg.Simulation.MaxConcurrentDeletes
+			process = func(i int) error {
+				return c.deleteDevice(ctx, target, task.DeviceIDs[i])
+			}
+		}
+		if maxConcurrent < 1 {
+			maxConcurrent = 1
+		}
+
+		for task.Processed < len(task.DeviceIDs) {
+			select {
+			case <-ctx.Done():
+				if c.isShuttingDown() {
+					// leave the job running so that it is resumed at the next start
+					log.Debug().Str("jobID", job.ID).Msg("suspending job due to shutdown")
+					return
+				}
+				c.finishJob(job, sim, nil)
+				return
+			default:
+			}
+
+			end := task.Processed + maxConcurrent
+			if end > len(task.DeviceIDs) {
+				end = len(task.DeviceIDs)
+			}
+
+			// process a batch of devices in parallel to throttle calls to DPS and Central
+			batch := task.DeviceIDs[task.Processed:end]
+			errs := make([]error, len(batch))
+			wg := sync.WaitGroup{}
+			for i := range batch {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					errs[i] = process(task.Processed + i)
+				}(i)
+			}
+			wg.Wait()
+
+			// devices interrupted by a shutdown are processed again when the job is resumed
+			if c.isShuttingDown() {
+				log.Debug().Str("jobID", job.ID).Msg("suspending job due to shutdown")
+				return
+			}
+
+			for i, err := range errs {
+				if err != nil {
+					job.Failures = append(job.Failures, models.JobFailure{
+						DeviceID: batch[i],
+						Index:    task.DeviceIndex(task.Processed + i),
+						ModelID:  task.ModelID,
+						Action:   task.Action,
+						Error:    err.Error(),
+					})
+				} else {
+					job.Succeeded++
+				}
+			}
+			task.Processed = end
+			job.LastUpdatedTime = time.Now()
+			if err := storing.Jobs.Set(job); err != nil {
+				log.Error().Err(err).Str("jobID", job.ID).Msg("error saving job progress")
+			}
+
+			log.Debug().
+				Str("jobID", job.ID).
+				Str("action", string(task.Action)).
+				Int("processed", task.Processed).
+				Int("remaining", len(task.DeviceIDs)-task.Processed).
+				Int("failed", len(job.Failures)).
+				Str("modelID", task.ModelID).
+				Msg("job in progress")
+			eventing.PublishProgress(job.SimulationID, eventType, task.ModelID, task.Processed, len(task.DeviceIDs)-task.Processed)
+		}
+	}
+
+	// deleting a simulation completes by removing it along with its device configs
+	if job.Type == models.JobTypeDeleteSimulation && len(job.Failures) == 0 {
+		if err := deleteSimulation(sim); err != nil {
+			c.finishJob(job, sim, err)
+			return
+		}
+		log.Debug().Str("simID", sim.ID).Msg("deleted simulation")
+	}
+
+	c.finishJob(job, sim, nil)
+}
+
+// finishJob records the final status of the job and makes the simulation ready again.
+func (c *Controller) finishJob(job *models.Job, sim *models.Simulation, err error) {
+	switch {
+	case err != nil:
+		job.Status = models.JobStatusFailed
+		job.Error = err.Error()
+	case job.Succeeded+len(job.Failures) < job.Total:
+		job.Status = models.JobStatusCancelled
+	case len(job.Failures) > 0:
+		job.Status = models.JobStatusFailed
+		job.Error = fmt.Sprintf("%d of %d devices failed", len(job.Failures), job.Total)
+	default:
+		job.Status = models.JobStatusCompleted
+	}
+	job.LastUpdatedTime = time.Now()
+	if err := storing.Jobs.Set(job); err != nil {
+		log.Error().Err(err).Str("jobID", job.ID).Msg("error saving job status")
+	}
+
+	log.Debug().
+		Str("jobID", job.ID).
+		Str("status", string(job.Status)).
+		Int("succeeded", job.Succeeded).
+		Int("failed", len(job.Failures)).
+		Str("simID", job.SimulationID).
+		Msg("job finished")
+
+	// the simulation is gone once a delete simulation job completes
+	if sim == nil || job.Type == models.JobTypeDeleteSimulation && job.Status == models.JobStatusCompleted {
+		return
+	}
+
+	sim.Status = models.SimulationStatusReady
+	sim.LastUpdatedTime = time.Now()
+	if err := storing.Simulations.Set(sim); err != nil {
+		log.Error().Err(err).Str("simID", sim.ID).Msg("error updating simulation to ready status")
+		return
+	}
+	eventing.PublishStatus(sim)
+}
+
+// deleteSimulation deletes the simulation along with its device configurations, once its devices are de-provisioned.
+func deleteSimulation(sim *models.Simulation) error {
+	if err := storing.Simulations.Delete(sim.ID, false); err != nil {
+		return fmt.Errorf("error deleting simulation: %w", err)
+	}
+	simulating.ResetProvisioningFailures(sim.ID)
+	simulating.DeleteMetrics(sim.ID)
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package controlling
+
+import (
+	"context"
+	"time"
+
+	"github.com/iot-for-all/starling/pkg/central"
+	"github.com/iot-for-all/starling/pkg/models"
+	"github.com/iot-for-all/starling/pkg/storing"
+	"github.com/rs/zerolog/log"
+)
+
+// ReconcileTarget compares the local device cache of the target with the devices in the IoT Central application
+// and reports the devices that are only cached locally, only present in Central or blocked in Central.
+func (c *Controller) ReconcileTarget(ctx context.Context, target *models.SimulationTarget) (*models.ReconcileReport, error) {
+	localDevices, err := storing.TargetDevices.List(target.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	centralDevices, err := central.NewClient(target).ListDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.ReconcileReport{
+		TargetID:       target.ID,
+		Time:           time.Now(),
+		LocalDevices:   len(localDevices),
+		CentralDevices: len(centralDevices),
+		LocalOnly:      []models.ReconcileDevice{},
+		CentralOnly:    []models.ReconcileDevice{},
+		Disabled:       []models.ReconcileDevice{},
+	}
+
+	remote := make(map[string]*models.CentralDevice, len(centralDevices))
+	for i := range centralDevices {
+		remote[centralDevices[i].ID] = &centralDevices[i]
+	}
+
+	local := make(map[string]bool, len(localDevices))
+	for _, ld := range localDevices {
+		local[ld.DeviceID] = true
+		rd, ok := remote[ld.DeviceID]
+		switch {
+		case !ok:
+			report.LocalOnly = append(report.LocalOnly, models.ReconcileDevice{
+				DeviceID:     ld.DeviceID,
+				SimulationID: ld.SimulationID,
+				ModelID:      ld.ModelID,
+			})
+		case !rd.Enabled:
+			report.Disabled = append(report.Disabled, models.ReconcileDevice{
+				DeviceID:     ld.DeviceID,
+				DisplayName:  rd.DisplayName,
+				Template:     rd.Template,
+				SimulationID: ld.SimulationID,
+				ModelID:      ld.ModelID,
+			})
+		default:
+			report.Matched++
+		}
+	}
+
+	for _, rd := range centralDevices {
+		if !local[rd.ID] {
+			report.CentralOnly = append(report.CentralOnly, models.ReconcileDevice{
+				DeviceID:    rd.ID,
+				DisplayName: rd.DisplayName,
+				Template:    rd.Template,
+			})
+		}
+	}
+
+	log.Debug().
+		Str("targetID", target.ID).
+		Int("matched", report.Matched).
+		Int("localOnly", len(report.LocalOnly)).
+		Int("centralOnly", len(report.CentralOnly)).
+		Int("disabled", len(report.Disabled)).
+		Msg("reconciled target devices")
+
+	return report, nil
+}
+
+// FixTarget reconciles the target and resolves the differences as requested. Devices are only deleted
+// from IoT Central when they are explicitly listed in the request, as Central may contain real devices.
+func (c *Controller) FixTarget(ctx context.Context, target *models.SimulationTarget, fix *models.ReconcileFixRequest) (*models.ReconcileFixResult, error) {
+	if err := fix.Validate(); err != nil {
+		return nil, err
+	}
+
+	report, err := c.ReconcileTarget(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string]bool, len(fix.DeviceIDs))
+	for _, id := range fix.DeviceIDs {
+		selected[id] = true
+	}
+	isSelected := func(deviceID string) bool {
+		return len(selected) == 0 || selected[deviceID]
+	}
+
+	result := &models.ReconcileFixResult{
+		TargetID:       target.ID,
+		RemovedLocal:   []string{},
+		DeletedCentral: []string{},
+		Enabled:        []string{},
+		Failures:       []models.ReconcileFailure{},
+	}
+	fail := func(deviceID string, err error) {
+		log.Error().Err(err).Str("deviceID", deviceID).Str("targetID", target.ID).Msg("error fixing device")
+		result.Failures = append(result.Failures, models.ReconcileFailure{DeviceID: deviceID, Error: err.Error()})
+	}
+
+	removeLocal := func(devices []models.ReconcileDevice) {
+		for _, d := range devices {
+			if !isSelected(d.DeviceID) {
+				continue
+			}
+			if err := storing.TargetDevices.Delete(target.ID, d.DeviceID); err != nil {
+				fail(d.DeviceID, err)
+				continue
+			}
+			result.RemovedLocal = append(result.RemovedLocal, d.DeviceID)
+		}
+	}
+
+	if fix.RemoveLocalOnly {
+		removeLocal(report.LocalOnly)
+	}
+	if fix.RemoveDisabled {
+		removeLocal(report.Disabled)
+	}
+
+	if fix.EnableDisabled {
+		client := central.NewClient(target)
+		for _, d := range report.Disabled {
+			if !isSelected(d.DeviceID) {
+				continue
+			}
+			if err := client.EnableDevice(ctx, d.DeviceID); err != nil {
+				fail(d.DeviceID, err)
+				continue
+			}
+			result.Enabled = append(result.Enabled, d.DeviceID)
+		}
+	}
+
+	if fix.DeleteCentralOnly {
+		for _, d := range report.CentralOnly {
+			if !selected[d.DeviceID] {
+				continue
+			}
+			if err := c.deleteDevice(ctx, target, d.DeviceID); err != nil {
+				fail(d.DeviceID, err)
+				continue
+			}
+			result.DeletedCentral = append(result.DeletedCentral, d.DeviceID)
+		}
+	}
+
+	log.Debug().
+		Str("targetID", target.ID).
+		Int("removedLocal", len(result.RemovedLocal)).
+		Int("deletedCentral", len(result.DeletedCentral)).
+		Int("enabled", len(result.Enabled)).
+		Int("failed", len(result.Failures)).
+		Msg("fixed target devices")
+
+	return result, nil
+}
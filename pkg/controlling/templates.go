@@ -0,0 +1,243 @@
+package controlling
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/iot-for-all/starling/pkg/central"
+	"github.com/iot-for-all/starling/pkg/models"
+	"github.com/iot-for-all/starling/pkg/storing"
+	"github.com/rs/zerolog/log"
+)
+
+// PublishModel creates or updates the device template of the model in the IoT Central application of the target.
+// The differences to an existing device template are always reported; the template is only changed if it does not
+// exist yet or overwriting it is requested, and never during a dry run.
+func (c *Controller) PublishModel(ctx context.Context, model *models.DeviceModel, target *models.SimulationTarget, req *models.ModelPublishRequest) (*models.ModelPublishResult, error) {
+	if len(model.CapabilityModel) == 0 {
+		return nil, fmt.Errorf("model '%s' has no capability model to publish", model.ID)
+	}
+
+	templateID := req.TemplateID
+	if len(templateID) == 0 {
+		templateID = model.TemplateID
+	}
+	if len(templateID) == 0 {
+		templateID = models.DefaultTemplateID(model.ID)
+	}
+	if err := models.ValidateTemplateID(templateID); err != nil {
+		return nil, err
+	}
+
+	result := &models.ModelPublishResult{
+		ModelID:    model.ID,
+		TargetID:   target.ID,
+		TemplateID: templateID,
+		Changes:    []models.TemplateChange{},
+	}
+
+	template, err := deviceTemplate(model, templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	client := central.NewClient(target)
+	existing, err := client.GetDeviceTemplate(ctx, templateID)
+	if err != nil && !errors.Is(err, central.ErrNotFound) {
+		return nil, fmt.Errorf("error getting device template from Central: %w", err)
+	}
+
+	if existing != nil {
+		result.Exists = true
+		result.Changes = templateChanges(existing, template)
+	}
+
+	switch {
+	case req.DryRun:
+		return result, nil
+	case result.Exists && len(result.Changes) == 0:
+		return result, nil
+	case result.Exists && !req.Overwrite:
+		return result, nil
+	}
+
+	if _, err = client.PutDeviceTemplate(ctx, templateID, template); err != nil {
+		return nil, fmt.Errorf("error publishing device template to Central: %w", err)
+	}
+	result.Published = true
+
+	// remember the template so that it is updated the next time the model is published
+	if model.TemplateID != templateID {
+		model.TemplateID = templateID
+		if err := storing.DeviceModels.Set(model); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Debug().
+		Str("modelID", model.ID).
+		Str("targetID", target.ID).
+		Str("templateID", templateID).
+		Bool("existed", result.Exists).
+		Int("changes", len(result.Changes)).
+		Msg("published device model to Central")
+
+	return result, nil
+}
+
+// deviceTemplate builds the IoT Central device template of the model. The first interface of the capability model
+// is the root; the other interfaces are inlined where they are referenced as component schemas.
+func deviceTemplate(model *models.DeviceModel, templateID string) (map[string]interface{}, error) {
+	// work on a copy so that the stored model is not modified
+	raw, err := json.Marshal(model.CapabilityModel)
+	if err != nil {
+		return nil, err
+	}
+	var interfaces []map[string]interface{}
+	if err = json.Unmarshal(raw, &interfaces); err != nil {
+		return nil, err
+	}
+
+	root := interfaces[0]
+	byID := make(map[string]map[string]interface{}, len(interfaces))
+	for _, iface := range interfaces[1:] {
+		if id, ok := iface["@id"].(string); ok {
+			byID[id] = iface
+		}
+	}
+	if contents, ok := root["contents"].([]interface{}); ok {
+		for _, item := range contents {
+			content, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if schema, ok := content["schema"].(string); ok {
+				if iface, ok := byID[schema]; ok {
+					content["schema"] = iface
+				}
+			}
+		}
+	}
+
+	displayName := model.Name
+	if len(displayName) == 0 {
+		displayName = model.ID
+	}
+
+	return map[string]interface{}{
+		"@id":             templateID,
+		"@type":           []interface{}{"ModelDefinition", "DeviceModel"},
+		"displayName":     displayName,
+		"capabilityModel": root,
+	}, nil
+}
+
+// templateChanges lists the differences between the device template in IoT Central and the one built from the model.
+// Only the display name and the capability model are compared, as Central adds its own fields to the template.
+func templateChanges(existing map[string]interface{}, template map[string]interface{}) []models.TemplateChange {
+	changes := make([]models.TemplateChange, 0)
+	for _, key := range []string{"displayName", "capabilityModel"} {
+		diffValues("$."+key, normalize(existing[key]), normalize(template[key]), &changes)
+	}
+
+	return changes
+}
+
+// diffValues appends the differences between two JSON values at the given path.
+func diffValues(path string, oldValue interface{}, newValue interface{}, changes *[]models.TemplateChange) {
+	switch {
+	case oldValue == nil && newValue == nil:
+		return
+	case oldValue == nil:
+		*changes = append(*changes, models.TemplateChange{Path: path, Op: "added", NewValue: newValue})
+		return
+	case newValue == nil:
+		*changes = append(*changes, models.TemplateChange{Path: path, Op: "removed", OldValue: oldValue})
+		return
+	}
+
+	oldMap, oldIsMap := oldValue.(map[string]interface{})
+	newMap, newIsMap := newValue.(map[string]interface{})
+	if oldIsMap && newIsMap {
+		keys := make([]string, 0, len(oldMap)+len(newMap))
+		for k := range oldMap {
+			keys = append(keys, k)
+		}
+		for k := range newMap {
+			if _, ok := oldMap[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			diffValues(fmt.Sprintf("%s.%s", path, k), oldMap[k], newMap[k], changes)
+		}
+		return
+	}
+
+	oldList, oldIsList := oldValue.([]interface{})
+	newList, newIsList := newValue.([]interface{})
+	if oldIsList && newIsList {
+		for i := 0; i < len(oldList) || i < len(newList); i++ {
+			var o, n interface{}
+			if i < len(oldList) {
+				o = oldList[i]
+			}
+			if i < len(newList) {
+				n = newList[i]
+			}
+			diffValues(fmt.Sprintf("%s[%d]", path, i), o, n, changes)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(oldValue, newValue) {
+		*changes = append(*changes, models.TemplateChange{Path: path, Op: "changed", OldValue: oldValue, NewValue: newValue})
+	}
+}
+
+// normalize converts a value to its generic JSON representation so that values from different sources compare equal.
+// Display names that are plain strings are treated the same as the localized form with an English entry.
+func normalize(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var generic interface{}
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return value
+	}
+
+	return normalizeDisplayNames(generic)
+}
+
+// normalizeDisplayNames replaces localized display names that only have an English entry with the plain string.
+func normalizeDisplayNames(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			if localized, ok := item.(map[string]interface{}); ok && len(localized) == 1 && strings.EqualFold(k, "displayName") {
+				if en, ok := localized["en"].(string); ok {
+					v[k] = en
+					continue
+				}
+			}
+			v[k] = normalizeDisplayNames(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeDisplayNames(item)
+		}
+	}
+
+	return value
+}
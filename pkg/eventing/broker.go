@@ -0,0 +1,119 @@
+package eventing
+
+import (
+	"sync"
+	"time"
+
+	"github.com/iot-for-all/starling/pkg/models"
+)
+
+type (
+	// Subscription receives the events published for a simulation.
+	Subscription struct {
+		simulationID string                       // the simulation this subscription listens to.
+		events       chan *models.SimulationEvent // channel on which the events are delivered.
+		closeOnce    sync.Once                    // makes sure that the subscription is closed only once.
+	}
+
+	// broker fans out the published simulation events to all the subscribers of that simulation.
+	broker struct {
+		mutex         sync.RWMutex
+		subscriptions map[string]map[*Subscription]struct{}
+	}
+)
+
+const (
+	// subscriptionBufferSize is the number of events buffered per subscriber before events are dropped.
+	subscriptionBufferSize = 64
+)
+
+var (
+	events = &broker{subscriptions: map[string]map[*Subscription]struct{}{}} // application event broker
+)
+
+// Subscribe creates a subscription for the events published for the given simulation.
+func Subscribe(simulationID string) *Subscription {
+	sub := &Subscription{
+		simulationID: simulationID,
+		events:       make(chan *models.SimulationEvent, subscriptionBufferSize),
+	}
+
+	events.mutex.Lock()
+	defer events.mutex.Unlock()
+
+	subs, ok := events.subscriptions[simulationID]
+	if !ok {
+		subs = map[*Subscription]struct{}{}
+		events.subscriptions[simulationID] = subs
+	}
+	subs[sub] = struct{}{}
+
+	return sub
+}
+
+// Publish delivers the event to all subscribers of the simulation.
+// Slow subscribers do not block the publisher; events are dropped when their buffer is full.
+func Publish(event *models.SimulationEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	events.mutex.RLock()
+	defer events.mutex.RUnlock()
+
+	for sub := range events.subscriptions[event.SimulationID] {
+		select {
+		case sub.events <- event:
+		default:
+		}
+	}
+}
+
+// PublishStatus publishes the current status of the simulation.
+func PublishStatus(simulation *models.Simulation) {
+	Publish(&models.SimulationEvent{
+		SimulationID: simulation.ID,
+		Type:         models.SimulationEventStatus,
+		Time:         simulation.LastUpdatedTime,
+		Status:       simulation.Status,
+	})
+}
+
+// PublishProgress publishes the progress of provisioning or deleting devices of a simulation.
+func PublishProgress(simulationID string, eventType models.SimulationEventType, modelID string, completed int, remaining int) {
+	Publish(&models.SimulationEvent{
+		SimulationID: simulationID,
+		Type:         eventType,
+		ModelID:      modelID,
+		Completed:    &completed,
+		Remaining:    &remaining,
+	})
+}
+
+// HasSubscribers returns true if anyone is listening to the events of the given simulation.
+func HasSubscribers(simulationID string) bool {
+	events.mutex.RLock()
+	defer events.mutex.RUnlock()
+
+	return len(events.subscriptions[simulationID]) > 0
+}
+
+// C returns the channel on which the events are delivered.
+func (s *Subscription) C() <-chan *models.SimulationEvent {
+	return s.events
+}
+
+// Close stops delivering events to this subscription.
+func (s *Subscription) Close() {
+	s.closeOnce.Do(func() {
+		events.mutex.Lock()
+		defer events.mutex.Unlock()
+
+		subs := events.subscriptions[s.simulationID]
+		delete(subs, s)
+		if len(subs) == 0 {
+			delete(events.subscriptions, s.simulationID)
+		}
+		close(s.events)
+	})
+}
@@ -0,0 +1,142 @@
+package exporting
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/iot-for-all/starling/pkg/config"
+	"github.com/iot-for-all/starling/pkg/simulating"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// metricPrefix selects the collectors of Starling among the registered collectors.
+	metricPrefix = "starling_"
+
+	// pushTimeout is the time allowed for a single push to the Pushgateway or remote-write endpoint.
+	pushTimeout = 10 * time.Second
+)
+
+type (
+	// exporter pushes the Starling metrics to the configured Pushgateway and remote-write endpoint.
+	exporter struct {
+		sync.Mutex                      // serializes the periodic and final pushes.
+		cfg        *config.ExportConfig // export configuration.
+		instance   string               // instance label of the pushed metrics.
+		client     *http.Client         // client used for all pushes.
+		pusher     *push.Pusher         // Pushgateway pusher, nil if not pushing to a Pushgateway.
+	}
+)
+
+var (
+	active atomic.Value // *exporter started by Start, unset if the metrics are not pushed
+)
+
+// Start pushes the Starling metrics at the configured interval until the context is done, then pushes them
+// a final time. It does nothing unless export is enabled.
+func Start(ctx context.Context, cfg *config.ExportConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if len(cfg.PushgatewayURL) == 0 && len(cfg.RemoteWriteURL) == 0 {
+		return fmt.Errorf("metrics export is enabled but neither a Pushgateway nor a remote-write URL is configured")
+	}
+
+	instance := cfg.Instance
+	if len(instance) == 0 {
+		instance, _ = os.Hostname()
+	}
+
+	e := &exporter{
+		cfg:      cfg,
+		instance: instance,
+		client:   &http.Client{Timeout: pushTimeout},
+	}
+	if len(cfg.PushgatewayURL) > 0 {
+		e.pusher = push.New(cfg.PushgatewayURL, cfg.Job).
+			Gatherer(prometheus.GathererFunc(gather)).
+			Grouping("instance", instance).
+			Client(e.client)
+		if len(cfg.Username) > 0 {
+			e.pusher = e.pusher.BasicAuth(cfg.Username, cfg.Password)
+		}
+	}
+	active.Store(e)
+
+	interval := time.Duration(cfg.Interval) * time.Second
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+
+	log.Info().
+		Str("pushgateway", cfg.PushgatewayURL).
+		Str("remoteWrite", cfg.RemoteWriteURL).
+		Str("job", cfg.Job).
+		Str("instance", instance).
+		Dur("interval", interval).
+		Msg("pushing metrics")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			e.push()
+			return nil
+		case <-ticker.C:
+			e.push()
+		}
+	}
+}
+
+// Flush pushes the current values of the Starling metrics right away, e.g. when a simulation stops.
+// It does nothing unless the metrics are pushed.
+func Flush() {
+	if e, ok := active.Load().(*exporter); ok {
+		e.push()
+	}
+}
+
+// push sends the current metrics to every configured endpoint, logging the failures.
+func (e *exporter) push() {
+	e.Lock()
+	defer e.Unlock()
+
+	if e.pusher != nil {
+		if err := e.pusher.Push(); err != nil {
+			log.Error().Err(err).Str("url", e.cfg.PushgatewayURL).Msg("error pushing metrics to the Pushgateway")
+		}
+	}
+
+	if len(e.cfg.RemoteWriteURL) > 0 {
+		if err := e.remoteWrite(); err != nil {
+			log.Error().Err(err).Str("url", e.cfg.RemoteWriteURL).Msg("error remote-writing metrics")
+		}
+	}
+}
+
+// gather collects the Starling metrics from the default registry, labelled with the custom labels of the simulations.
+func gather() ([]*dto.MetricFamily, error) {
+	families, err := simulating.Gatherer.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	starling := families[:0]
+	for _, family := range families {
+		if strings.HasPrefix(family.GetName(), metricPrefix) {
+			starling = append(starling, family)
+		}
+	}
+
+	return starling, nil
+}
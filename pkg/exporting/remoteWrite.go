@@ -0,0 +1,165 @@
+package exporting
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type (
+	// label is a name value pair identifying a time series.
+	label struct {
+		name  string
+		value string
+	}
+
+	// series is a time series with a single sample, as sent by remote-write.
+	series struct {
+		labels []label // labels of the series, including its name as __name__.
+		value  float64 // value of the sample.
+	}
+)
+
+// remoteWrite sends the current metrics to the remote-write endpoint as a snappy compressed protobuf WriteRequest.
+func (e *exporter) remoteWrite() error {
+	families, err := gather()
+	if err != nil {
+		return fmt.Errorf("error gathering metrics: %w", err)
+	}
+
+	extra := []label{{name: "job", value: e.cfg.Job}, {name: "instance", value: e.instance}}
+	body := snappy.Encode(nil, encodeWriteRequest(toSeries(families, extra), time.Now().UnixNano()/int64(time.Millisecond)))
+
+	req, err := http.NewRequest(http.MethodPost, e.cfg.RemoteWriteURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "starling")
+	if len(e.cfg.Username) > 0 {
+		req.SetBasicAuth(e.cfg.Username, e.cfg.Password)
+	}
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("remote-write failed with %d response code: %s", res.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
+
+// toSeries flattens the metric families into time series the way Prometheus does when scraping them,
+// adding the extra labels to every series.
+func toSeries(families []*dto.MetricFamily, extra []label) []series {
+	var all []series
+	for _, family := range families {
+		name := family.GetName()
+		for _, m := range family.GetMetric() {
+			labels := append([]label{}, extra...)
+			for _, lp := range m.GetLabel() {
+				labels = append(labels, label{name: lp.GetName(), value: lp.GetValue()})
+			}
+
+			add := func(suffix string, value float64, more ...label) {
+				ls := append(append([]label{{name: "__name__", value: name + suffix}}, labels...), more...)
+				sort.Slice(ls, func(i, j int) bool { return ls[i].name < ls[j].name })
+				all = append(all, series{labels: ls, value: value})
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add("", m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add("", m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add("", m.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				infinite := false
+				for _, b := range h.GetBucket() {
+					infinite = math.IsInf(b.GetUpperBound(), 1)
+					add("_bucket", float64(b.GetCumulativeCount()), label{name: "le", value: formatFloat(b.GetUpperBound())})
+				}
+				if !infinite {
+					add("_bucket", float64(h.GetSampleCount()), label{name: "le", value: "+Inf"})
+				}
+				add("_sum", h.GetSampleSum())
+				add("_count", float64(h.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					add("", q.GetValue(), label{name: "quantile", value: formatFloat(q.GetQuantile())})
+				}
+				add("_sum", s.GetSampleSum())
+				add("_count", float64(s.GetSampleCount()))
+			}
+		}
+	}
+
+	return all
+}
+
+// encodeWriteRequest encodes the series as a remote-write WriteRequest protobuf message with every sample
+// taken at the given time in milliseconds.
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(all []series, timestamp int64) []byte {
+	var req []byte
+	for _, s := range all {
+		var ts []byte
+		for _, l := range s.labels {
+			var lb []byte
+			lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.name)
+			lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.value)
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, lb)
+		}
+
+		var sb []byte
+		sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+		sb = protowire.AppendFixed64(sb, math.Float64bits(s.value))
+		sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+		sb = protowire.AppendVarint(sb, uint64(timestamp))
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sb)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+
+	return req
+}
+
+// formatFloat formats a bucket bound or quantile the way Prometheus exposes it.
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,26 @@
+package models
+
+type (
+	// MessageBudget limits the IoT Central messages a simulation is expected to use. Limits are in billable message
+	// units of 4 KB; a limit of 0 is not checked.
+	MessageBudget struct {
+		Daily         float64 `json:"daily,omitempty"`         // message units per day of the whole simulation.
+		Monthly       float64 `json:"monthly,omitempty"`       // message units per month of the whole simulation.
+		DeviceMonthly float64 `json:"deviceMonthly,omitempty"` // message units per month of a single device, e.g. the allowance of the pricing plan.
+	}
+
+	// BillingEstimate estimates the IoT Central messages billed for a simulation and projects its usage from the
+	// current rate.
+	BillingEstimate struct {
+		Messages               float64        `json:"messages"`               // device to cloud messages sent since Starling started.
+		MessageUnits           float64        `json:"messageUnits"`           // billable message units of 4 KB sent since Starling started.
+		UnitsPerMessage        float64        `json:"unitsPerMessage"`        // average billable units per message.
+		Rate                   float64        `json:"rate"`                   // billable message units per second over the window.
+		Devices                float64        `json:"devices"`                // number of devices simulated.
+		ProjectedDaily         float64        `json:"projectedDaily"`         // billable message units per day at the current rate.
+		ProjectedMonthly       float64        `json:"projectedMonthly"`       // billable message units per month at the current rate.
+		ProjectedDeviceMonthly float64        `json:"projectedDeviceMonthly"` // billable message units per device and month at the current rate.
+		Budget                 *MessageBudget `json:"budget,omitempty"`       // budget of the simulation, if any.
+		Warnings               []string       `json:"warnings,omitempty"`     // budget limits the projected usage exceeds.
+	}
+)
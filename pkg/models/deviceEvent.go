@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+type (
+	// DeviceEventType specifies the kind of lifecycle event recorded for a simulated device.
+	DeviceEventType string
+
+	// DeviceEvent represents a lifecycle event of a simulated device kept in its activity journal.
+	DeviceEvent struct {
+		Time         time.Time       `json:"time"`                // when the event happened.
+		SimulationID string          `json:"simulationId"`        // the simulation the device belongs to.
+		DeviceID     string          `json:"deviceId"`            // the device the event happened to.
+		ModelID      string          `json:"modelId"`             // model of the device.
+		Type         DeviceEventType `json:"type"`                // kind of the event.
+		Hub          string          `json:"hub,omitempty"`       // IoT Hub the device is assigned or connected to.
+		Count        int             `json:"count,omitempty"`     // number of messages sent, for telemetry events.
+		ErrorType    ErrorType       `json:"errorType,omitempty"` // error type as reported in the metrics, for failures.
+		Error        string          `json:"error,omitempty"`     // error message, for failures.
+		Detail       string          `json:"detail,omitempty"`    // additional information such as the command name.
+	}
+)
+
+const (
+	// DeviceEventProvisioned is recorded when the device was registered with DPS or found in the device cache.
+	DeviceEventProvisioned DeviceEventType = "provisioned"
+	// DeviceEventProvisioningFailed is recorded when registering the device with DPS failed.
+	DeviceEventProvisioningFailed DeviceEventType = "provisioningFailed"
+	// DeviceEventConnected is recorded when the device connected to its IoT Hub.
+	DeviceEventConnected DeviceEventType = "connected"
+	// DeviceEventConnectFailed is recorded when connecting the device to its IoT Hub failed.
+	DeviceEventConnectFailed DeviceEventType = "connectFailed"
+	// DeviceEventFailover is recorded when the device is re-provisioned after its IoT Hub failed over.
+	DeviceEventFailover DeviceEventType = "failover"
+	// DeviceEventDisconnected is recorded when the device disconnected from its IoT Hub.
+	DeviceEventDisconnected DeviceEventType = "disconnected"
+	// DeviceEventTelemetrySent is recorded when a batch of telemetry messages was sent.
+	DeviceEventTelemetrySent DeviceEventType = "telemetrySent"
+	// DeviceEventTelemetryFailed is recorded when sending a telemetry message failed.
+	DeviceEventTelemetryFailed DeviceEventType = "telemetryFailed"
+	// DeviceEventTwinUpdateReceived is recorded when the device received a desired property update.
+	DeviceEventTwinUpdateReceived DeviceEventType = "twinUpdateReceived"
+	// DeviceEventTwinUpdateAcked is recorded when the device acknowledged a desired property update.
+	DeviceEventTwinUpdateAcked DeviceEventType = "twinUpdateAcked"
+	// DeviceEventTwinUpdateFailed is recorded when acknowledging a desired property update failed.
+	DeviceEventTwinUpdateFailed DeviceEventType = "twinUpdateFailed"
+	// DeviceEventCommandReceived is recorded when the device received a direct method or C2D command.
+	DeviceEventCommandReceived DeviceEventType = "commandReceived"
+)
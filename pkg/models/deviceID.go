@@ -0,0 +1,206 @@
+package models
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultDeviceIDTemplate is used to name the devices of a device config that does not specify a template.
+	DefaultDeviceIDTemplate = "{sim}-{target}-{model}-{index}"
+
+	// maxDeviceIDLength is the longest device id accepted by DPS and IoT Central.
+	maxDeviceIDLength = 128
+
+	// deviceIDRandomChars are the characters used to generate random suffixes.
+	deviceIDRandomChars = "abcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+var (
+	// deviceIDPlaceholder matches {name} and {name:N} placeholders in a device id template.
+	deviceIDPlaceholder = regexp.MustCompile(`\{([a-z]+)(?::(\d+))?\}`)
+
+	// validDeviceID matches the device ids accepted by DPS and IoT Central.
+	validDeviceID = regexp.MustCompile(`^[a-zA-Z0-9\-.:_]+$`)
+)
+
+// DeviceIDTemplate returns the template used to name the devices of this config.
+func (dc *SimulationDeviceConfig) DeviceIDTemplate() string {
+	if len(dc.IDTemplate) == 0 {
+		return DefaultDeviceIDTemplate
+	}
+
+	return dc.IDTemplate
+}
+
+// DeviceID generates the id of the device at the given 1 based index. Devices are named after the explicit
+// device id list when one is given; otherwise the id template is expanded. The following placeholders are supported:
+//
+//	{sim}       simulation id
+//	{target}    target id
+//	{model}     model id
+//	{config}    device config id
+//	{index}     index of the device, {index:N} pads the index with zeros up to N digits
+//	{random:N}  N random lowercase letters and digits
+//
+// Returns an empty string if the index is past the end of the explicit device id list.
+func (dc *SimulationDeviceConfig) DeviceID(simulationID string, targetID string, index int) string {
+	if len(dc.DeviceIDs) > 0 {
+		if index < 1 || index > len(dc.DeviceIDs) {
+			return ""
+		}
+		return dc.DeviceIDs[index-1]
+	}
+
+	return deviceIDPlaceholder.ReplaceAllStringFunc(dc.DeviceIDTemplate(), func(p string) string {
+		m := deviceIDPlaceholder.FindStringSubmatch(p)
+		width, _ := strconv.Atoi(m[2])
+		switch m[1] {
+		case "sim":
+			return simulationID
+		case "target":
+			return targetID
+		case "model":
+			return dc.ModelID
+		case "config":
+			return dc.ID
+		case "index":
+			return fmt.Sprintf("%0*d", width, index)
+		case "random":
+			b := make([]byte, width)
+			for i := range b {
+				b[i] = deviceIDRandomChars[rand.Intn(len(deviceIDRandomChars))]
+			}
+			return string(b)
+		default:
+			return p
+		}
+	})
+}
+
+// MaxDevices returns the maximum number of devices that can be named by this config, or -1 if there is no limit.
+func (dc *SimulationDeviceConfig) MaxDevices() int {
+	if len(dc.DeviceIDs) > 0 {
+		return len(dc.DeviceIDs)
+	}
+
+	return -1
+}
+
+// ValidateDeviceIDs makes sure that the device config produces unique device ids accepted by IoT Central.
+func (dc *SimulationDeviceConfig) ValidateDeviceIDs() error {
+	if len(dc.DeviceIDs) > 0 {
+		if len(dc.IDTemplate) > 0 {
+			return fmt.Errorf("device config '%s' cannot have both an id template and a list of device ids", dc.ID)
+		}
+
+		seen := make(map[string]bool, len(dc.DeviceIDs))
+		for _, id := range dc.DeviceIDs {
+			if err := validateDeviceID(id); err != nil {
+				return fmt.Errorf("device config '%s' has an invalid device id: %w", dc.ID, err)
+			}
+			if seen[id] {
+				return fmt.Errorf("device config '%s' has duplicate device id '%s'", dc.ID, id)
+			}
+			seen[id] = true
+		}
+
+		if dc.DeviceCount > len(dc.DeviceIDs) {
+			return fmt.Errorf("device config '%s' simulates %d devices but only %d device ids are given", dc.ID, dc.DeviceCount, len(dc.DeviceIDs))
+		}
+		return nil
+	}
+
+	template := dc.DeviceIDTemplate()
+	unique := false
+	for _, m := range deviceIDPlaceholder.FindAllStringSubmatch(template, -1) {
+		switch m[1] {
+		case "sim", "target", "model", "config":
+			if len(m[2]) > 0 {
+				return fmt.Errorf("placeholder '%s' in device id template '%s' does not take a width", m[0], template)
+			}
+		case "index":
+			unique = true
+		case "random":
+			if width, _ := strconv.Atoi(m[2]); width < 1 {
+				return fmt.Errorf("placeholder '%s' in device id template '%s' must specify a length e.g. {random:6}", m[0], template)
+			}
+			unique = true
+		default:
+			return fmt.Errorf("unknown placeholder '%s' in device id template '%s'", m[0], template)
+		}
+	}
+	if !unique {
+		return fmt.Errorf("device id template '%s' must contain an {index} or {random:N} placeholder to generate unique ids", template)
+	}
+
+	// placeholders are replaced with valid characters, so validating a sample is enough
+	sample := dc.DeviceID("sim", "target", 1)
+	if err := validateDeviceID(sample); err != nil {
+		return fmt.Errorf("device id template '%s' generates invalid device ids: %w", template, err)
+	}
+
+	return nil
+}
+
+// validateDeviceID makes sure that the device id is accepted by DPS and IoT Central.
+func validateDeviceID(id string) error {
+	if len(id) == 0 || len(id) > maxDeviceIDLength {
+		return fmt.Errorf("device id '%s' must be between 1 and %d characters long", id, maxDeviceIDLength)
+	}
+	if !validDeviceID.MatchString(id) {
+		return fmt.Errorf("device id '%s' can only contain letters, digits, '-', '.', ':' and '_'", id)
+	}
+
+	return nil
+}
+
+// DeviceIDPattern returns a regular expression matching all device ids generated by this config.
+func (dc *SimulationDeviceConfig) DeviceIDPattern(simulationID string, targetID string) string {
+	if len(dc.DeviceIDs) > 0 {
+		ids := make([]string, len(dc.DeviceIDs))
+		for i, id := range dc.DeviceIDs {
+			ids[i] = regexp.QuoteMeta(id)
+		}
+		return fmt.Sprintf("^(%s)$", strings.Join(ids, "|"))
+	}
+
+	pattern := ""
+	template := dc.DeviceIDTemplate()
+	last := 0
+	for _, loc := range deviceIDPlaceholder.FindAllStringSubmatchIndex(template, -1) {
+		pattern += regexp.QuoteMeta(template[last:loc[0]])
+		last = loc[1]
+
+		name := template[loc[2]:loc[3]]
+		width := 0
+		if loc[4] >= 0 {
+			width, _ = strconv.Atoi(template[loc[4]:loc[5]])
+		}
+		switch name {
+		case "sim":
+			pattern += regexp.QuoteMeta(simulationID)
+		case "target":
+			pattern += regexp.QuoteMeta(targetID)
+		case "model":
+			pattern += regexp.QuoteMeta(dc.ModelID)
+		case "config":
+			pattern += regexp.QuoteMeta(dc.ID)
+		case "index":
+			if width < 1 {
+				width = 1
+			}
+			pattern += fmt.Sprintf(`\d{%d,}`, width)
+		case "random":
+			pattern += fmt.Sprintf("[%s]{%d}", deviceIDRandomChars, width)
+		default:
+			pattern += regexp.QuoteMeta(template[loc[0]:loc[1]])
+		}
+	}
+	pattern += regexp.QuoteMeta(template[last:])
+
+	return "^" + pattern + "$"
+}
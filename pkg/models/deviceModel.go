@@ -8,6 +8,54 @@ type (
 		ID              string                   `json:"id"`
 		Name            string                   `json:"name"`
 		CapabilityModel []map[string]interface{} `json:"capabilityModel"`
+		TemplateID      string                   `json:"templateId,omitempty"`      // DTMI of the device template the model was imported from.
+		TemplateVersion int                      `json:"templateVersion,omitempty"` // version of the device template the model was imported from.
+	}
+
+	// ModelPublishRequest specifies how to publish a device model to an IoT Central application as a device template.
+	ModelPublishRequest struct {
+		TargetID   string `json:"targetId"`             // target application to publish the model to.
+		TemplateID string `json:"templateId,omitempty"` // DTMI of the device template, defaults to the one the model was imported from.
+		DryRun     bool   `json:"dryRun,omitempty"`     // only preview the changes without publishing them.
+		Overwrite  bool   `json:"overwrite,omitempty"`  // update the device template if it already exists with differences.
+	}
+
+	// TemplateChange describes a difference between a device model and the device template in IoT Central.
+	TemplateChange struct {
+		Path     string      `json:"path"`               // JSON path of the changed value.
+		Op       string      `json:"op"`                 // one of added, removed or changed.
+		OldValue interface{} `json:"oldValue,omitempty"` // value in IoT Central.
+		NewValue interface{} `json:"newValue,omitempty"` // value in the device model.
+	}
+
+	// ModelPublishResult describes the outcome of publishing a device model to an IoT Central application.
+	ModelPublishResult struct {
+		ModelID    string           `json:"modelId"`    // model that was published.
+		TargetID   string           `json:"targetId"`   // target application the model was published to.
+		TemplateID string           `json:"templateId"` // DTMI of the device template.
+		Exists     bool             `json:"exists"`     // whether the device template already existed.
+		Published  bool             `json:"published"`  // whether the device template was created or updated.
+		Changes    []TemplateChange `json:"changes"`    // differences between the model and the existing device template.
+	}
+
+	// DeviceTemplateImport describes a device template available for import into the model store.
+	DeviceTemplateImport struct {
+		TemplateID  string `json:"templateId"`       // DTMI of the device template.
+		DisplayName string `json:"displayName"`      // display name of the device template.
+		Version     int    `json:"version"`          // version of the device template.
+		ModelID     string `json:"modelId"`          // id of the model the template is imported as.
+		Reason      string `json:"reason,omitempty"` // reason the template cannot be imported.
+	}
+
+	// DeviceTemplateImportRequest selects the device templates to import.
+	DeviceTemplateImportRequest struct {
+		Templates []string `json:"templates"` // DTMIs of the device templates to import, all templates are imported if empty.
+	}
+
+	// DeviceTemplateImportResult lists the device templates imported into the model store and the ones skipped.
+	DeviceTemplateImportResult struct {
+		Imported []DeviceTemplateImport `json:"imported"` // templates imported as models.
+		Skipped  []DeviceTemplateImport `json:"skipped"`  // templates that were not imported along with the reason.
 	}
 
 	// TelemetryType represents a telemetry capability of a device
@@ -47,11 +95,6 @@ type (
 	DeviceCapabilityModel struct {
 		Components []*Component
 	}
-
-	// DeviceTemplateResponse represents the response to deviceTemplates GET API call
-	DeviceTemplateResponse struct {
-		Value []map[string]interface{} `json:"value"`
-	}
 )
 
 // ParseDeviceCapabilityModel parses the DCM from the model store
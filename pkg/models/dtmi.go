@@ -0,0 +1,47 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// maxDTMILength is the longest DTMI accepted by DTDL v2.
+	maxDTMILength = 2048
+)
+
+var (
+	// validDTMI matches digital twin model identifiers: colon separated segments of letters, digits and underscores
+	// that start with a letter and do not end with an underscore, followed by a version.
+	validDTMI = regexp.MustCompile(`^dtmi:[A-Za-z](?:[A-Za-z0-9_]*[A-Za-z0-9])?(?::[A-Za-z](?:[A-Za-z0-9_]*[A-Za-z0-9])?)*;[1-9][0-9]{0,8}$`)
+
+	// invalidDTMIChars matches runs of characters that cannot be part of a DTMI segment.
+	invalidDTMIChars = regexp.MustCompile(`[^A-Za-z0-9]+`)
+)
+
+// DefaultTemplateID returns the DTMI a model is published as when it has no device template yet e.g.
+// dtmi:starling:thermostat;1. Characters of the model id that cannot be part of a DTMI are replaced with underscores,
+// and ids that do not start with a letter are prefixed with one.
+func DefaultTemplateID(modelID string) string {
+	segment := strings.Trim(invalidDTMIChars.ReplaceAllString(modelID, "_"), "_")
+	if len(segment) == 0 || !isLetter(segment[0]) {
+		segment = "m" + segment
+	}
+
+	return fmt.Sprintf("dtmi:starling:%s;1", segment)
+}
+
+// ValidateTemplateID makes sure that the id of a device template is a valid DTMI.
+func ValidateTemplateID(id string) error {
+	if len(id) > maxDTMILength || !validDTMI.MatchString(id) {
+		return fmt.Errorf("device template id '%s' is not a valid DTMI e.g. dtmi:contoso:thermostat;1, segments must start with a letter and only contain letters, digits and underscores", id)
+	}
+
+	return nil
+}
+
+// isLetter returns true if c is an ASCII letter.
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,40 @@
+package models
+
+import "testing"
+
+func TestDefaultTemplateID(t *testing.T) {
+	tests := map[string]string{
+		"thermostat":     "dtmi:starling:thermostat;1",
+		"2thermostat":    "dtmi:starling:m2thermostat;1",
+		"my-model.v2":    "dtmi:starling:my_model_v2;1",
+		"_sensor_":       "dtmi:starling:sensor;1",
+		"---":            "dtmi:starling:m;1",
+		"Brewer Model 1": "dtmi:starling:Brewer_Model_1;1",
+	}
+
+	for modelID, expected := range tests {
+		templateID := DefaultTemplateID(modelID)
+		if templateID != expected {
+			t.Errorf("expected '%s' for model '%s', got '%s'", expected, modelID, templateID)
+		}
+		if err := ValidateTemplateID(templateID); err != nil {
+			t.Errorf("expected the template id of model '%s' to be valid, got %v", modelID, err)
+		}
+	}
+}
+
+func TestValidateTemplateID(t *testing.T) {
+	valid := []string{"dtmi:contoso:thermostat;1", "dtmi:com:example:Thermostat_2;12"}
+	for _, id := range valid {
+		if err := ValidateTemplateID(id); err != nil {
+			t.Errorf("expected '%s' to be valid, got %v", id, err)
+		}
+	}
+
+	invalid := []string{"dtmi:starling:2model;1", "dtmi:starling:model-1;1", "dtmi:starling:model_;1", "dtmi:starling:model", "dtmi:starling:model;0", "urn:starling:model;1"}
+	for _, id := range invalid {
+		if err := ValidateTemplateID(id); err == nil {
+			t.Errorf("expected '%s' to be invalid", id)
+		}
+	}
+}
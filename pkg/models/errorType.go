@@ -0,0 +1,42 @@
+package models
+
+type (
+	// ErrorType classifies the errors of simulated device operations. Error types are used as the error label
+	// of the failure metrics and reported by the APIs, so their values must stay stable.
+	ErrorType string
+)
+
+const (
+	// ErrorThrottled is reported when IoT Hub or DPS throttled the request.
+	ErrorThrottled ErrorType = "throttled"
+	// ErrorQuotaExceeded is reported when the daily message quota of the IoT Hub is exhausted.
+	ErrorQuotaExceeded ErrorType = "quotaExceeded"
+	// ErrorUnauthorized is reported when the device credentials were rejected.
+	ErrorUnauthorized ErrorType = "unauthorized"
+	// ErrorNotFound is reported when the device or its registration does not exist.
+	ErrorNotFound ErrorType = "notFound"
+	// ErrorPayloadTooLarge is reported when a message exceeds the maximum message size.
+	ErrorPayloadTooLarge ErrorType = "payloadTooLarge"
+	// ErrorInvalidRequest is reported when the request was rejected as malformed.
+	ErrorInvalidRequest ErrorType = "invalidRequest"
+	// ErrorHubUnavailable is reported when the IoT Hub or DPS refused the connection or failed with a server error.
+	ErrorHubUnavailable ErrorType = "hubUnavailable"
+	// ErrorDNS is reported when the host name of the IoT Hub or DPS could not be resolved.
+	ErrorDNS ErrorType = "dns"
+	// ErrorTLS is reported when the TLS handshake failed or the certificate was not trusted.
+	ErrorTLS ErrorType = "tls"
+	// ErrorTimeout is reported when the operation did not complete within its timeout.
+	ErrorTimeout ErrorType = "timeout"
+	// ErrorConnectionReset is reported when the connection was reset or closed by the remote host.
+	ErrorConnectionReset ErrorType = "connectionReset"
+	// ErrorConnectionClosed is reported when the operation was attempted on a connection that is no longer open.
+	ErrorConnectionClosed ErrorType = "connectionClosed"
+	// ErrorRegistrationFailed is reported when DPS could not assign the device to an IoT Hub.
+	ErrorRegistrationFailed ErrorType = "registrationFailed"
+	// ErrorDeviceDisabled is reported when the enrollment or registration of the device is disabled in DPS.
+	ErrorDeviceDisabled ErrorType = "deviceDisabled"
+	// ErrorCanceled is reported when the operation was canceled because the simulation stopped.
+	ErrorCanceled ErrorType = "canceled"
+	// ErrorUnknown is reported for errors that could not be classified.
+	ErrorUnknown ErrorType = "unknown"
+)
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+type (
+	// SimulationEventType specifies the kind of event published for a simulation.
+	SimulationEventType string
+
+	// SimulationEvent represents a change in the state of a simulation pushed to the subscribers.
+	SimulationEvent struct {
+		SimulationID string              `json:"simulationId"`          // the simulation that raised the event.
+		Type         SimulationEventType `json:"type"`                  // kind of the event.
+		Time         time.Time           `json:"time"`                  // when the event was raised.
+		Status       SimulationStatus    `json:"status,omitempty"`      // current status of the simulation.
+		ModelID      string              `json:"modelId,omitempty"`     // model the progress or counts belong to.
+		Completed    *int                `json:"completed,omitempty"`   // number of devices processed so far, only set on progress events.
+		Remaining    *int                `json:"remaining,omitempty"`   // number of devices still to be processed, only set on progress events.
+		Connected    int                 `json:"connected,omitempty"`   // number of devices currently connected.
+		Connects     int                 `json:"connects,omitempty"`    // number of devices connected since the last event.
+		Disconnects  int                 `json:"disconnects,omitempty"` // number of devices disconnected since the last event.
+		Errors       map[string]int      `json:"errors,omitempty"`      // number of errors by error type since the last event.
+		Message      string              `json:"message,omitempty"`     // human readable description of the event.
+	}
+)
+
+const (
+	// SimulationEventStatus is raised when the status of a simulation changes.
+	SimulationEventStatus SimulationEventType = "status"
+	// SimulationEventProvisioning is raised when provisioning devices makes progress.
+	SimulationEventProvisioning SimulationEventType = "provisioning"
+	// SimulationEventDeleting is raised when deleting devices makes progress.
+	SimulationEventDeleting SimulationEventType = "deleting"
+	// SimulationEventConnections is raised periodically with the connected device counts of a running simulation.
+	SimulationEventConnections SimulationEventType = "connections"
+	// SimulationEventErrors is raised when a running simulation encountered errors since the last event.
+	SimulationEventErrors SimulationEventType = "errors"
+	// SimulationEventBudget is raised when the projected IoT Central message usage of a simulation exceeds its budget.
+	SimulationEventBudget SimulationEventType = "budget"
+)
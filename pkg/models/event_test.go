@@ -0,0 +1,35 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSimulationEventProgressCounts(t *testing.T) {
+	completed, remaining := 10, 0
+	progress, err := json.Marshal(&SimulationEvent{
+		SimulationID: "sim",
+		Type:         SimulationEventProvisioning,
+		Completed:    &completed,
+		Remaining:    &remaining,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(progress), `"completed":10`) || !strings.Contains(string(progress), `"remaining":0`) {
+		t.Errorf("expected the progress event to carry its counts, got %s", progress)
+	}
+
+	status, err := json.Marshal(&SimulationEvent{
+		SimulationID: "sim",
+		Type:         SimulationEventStatus,
+		Status:       SimulationStatusReady,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(status), "completed") || strings.Contains(string(status), "remaining") {
+		t.Errorf("expected the status event to carry no progress counts, got %s", status)
+	}
+}
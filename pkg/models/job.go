@@ -0,0 +1,119 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type (
+	// JobType specifies what a background job does.
+	JobType string
+
+	// JobStatus specifies the current status of a background job.
+	JobStatus string
+
+	// JobAction specifies the action performed on the devices of a job task.
+	JobAction string
+
+	// JobTask is a set of devices on which the same action is performed by a job.
+	JobTask struct {
+		Action    JobAction `json:"action"`            // action to perform on the devices.
+		ModelID   string    `json:"modelId"`           // model of the devices.
+		DeviceIDs []string  `json:"deviceIds"`         // devices to perform the action on.
+		Indexes   []int     `json:"indexes,omitempty"` // index of each device within its device config when provisioning.
+		Processed int       `json:"processed"`         // number of devices processed so far.
+	}
+
+	// JobFailure describes a device that could not be processed by a job.
+	JobFailure struct {
+		DeviceID string    `json:"deviceId"`        // the device that failed.
+		Index    int       `json:"index,omitempty"` // index of the device within its device config.
+		ModelID  string    `json:"modelId"`         // model of the device.
+		Action   JobAction `json:"action"`          // action that failed.
+		Error    string    `json:"error"`           // reason for the failure.
+	}
+
+	// Job tracks a long running operation on the devices of a simulation such as provisioning or deleting them.
+	Job struct {
+		ID              string       `json:"id"`              // unique identifier of the job.
+		Type            JobType      `json:"type"`            // what the job does.
+		SimulationID    string       `json:"simulationId"`    // simulation the job is working on, empty for jobs on the whole target.
+		TargetID        string       `json:"targetId"`        // target application the devices belong to.
+		Status          JobStatus    `json:"status"`          // current status of the job.
+		Tasks           []JobTask    `json:"tasks"`           // devices to process.
+		Total           int          `json:"total"`           // total number of devices to process.
+		Succeeded       int          `json:"succeeded"`       // number of devices processed successfully.
+		Failures        []JobFailure `json:"failures"`        // devices that failed to be processed.
+		Error           string       `json:"error,omitempty"` // reason the job failed as a whole.
+		Resumes         int          `json:"resumes"`         // number of times the job was resumed after a restart.
+		CreatedTime     time.Time    `json:"createdTime"`     // when the job was created.
+		LastUpdatedTime time.Time    `json:"lastUpdatedTime"` // when the job was last updated.
+	}
+)
+
+const (
+	// JobTypeProvision specifies that the job provisions and deletes devices to match the requested device counts.
+	JobTypeProvision JobType = "provision"
+	// JobTypeDeleteSimulation specifies that the job deletes all devices of a simulation and then the simulation itself.
+	JobTypeDeleteSimulation JobType = "deleteSimulation"
+	// JobTypeDeleteDevices specifies that the job deletes devices of a simulation and keeps the simulation.
+	JobTypeDeleteDevices JobType = "deleteDevices"
+	// JobTypeCleanup specifies that the job deletes orphaned devices from the target application.
+	JobTypeCleanup JobType = "cleanup"
+
+	// JobStatusPending specifies that the job is created but not started yet.
+	JobStatusPending JobStatus = "pending"
+	// JobStatusRunning specifies that the job is running.
+	JobStatusRunning JobStatus = "running"
+	// JobStatusCompleted specifies that the job processed all devices successfully.
+	JobStatusCompleted JobStatus = "completed"
+	// JobStatusFailed specifies that the job finished but some devices or the job itself failed.
+	JobStatusFailed JobStatus = "failed"
+	// JobStatusCancelled specifies that the job was cancelled before processing all devices.
+	JobStatusCancelled JobStatus = "cancelled"
+
+	// JobActionProvision provisions the devices in the target application.
+	JobActionProvision JobAction = "provision"
+	// JobActionDelete deletes the devices from the target application.
+	JobActionDelete JobAction = "delete"
+)
+
+// IsFinished returns true if the job is not going to make any more progress on its own.
+func (j *Job) IsFinished() bool {
+	return j.Status == JobStatusCompleted || j.Status == JobStatusFailed || j.Status == JobStatusCancelled
+}
+
+// DeviceIndex returns the index within its device config of the i-th device of the task, or 0 if it is not known.
+func (t *JobTask) DeviceIndex(i int) int {
+	if i < len(t.Indexes) {
+		return t.Indexes[i]
+	}
+
+	return 0
+}
+
+// UnmarshalJSON handles the un-marshalling of job status
+func (status *JobStatus) UnmarshalJSON(b []byte) error {
+	var p string
+	if err := json.Unmarshal(b, &p); err != nil {
+		return err
+	}
+
+	if p == "" {
+		return nil
+	}
+
+	s := JobStatus(p)
+	switch s {
+	case JobStatusPending,
+		JobStatusRunning,
+		JobStatusCompleted,
+		JobStatusFailed,
+		JobStatusCancelled:
+		*status = s
+		return nil
+	default:
+		return fmt.Errorf("invalid job status type %s", p)
+	}
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// validLabelName matches the names Prometheus accepts for labels.
+	validLabelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+	// reservedLabelNames are the labels set by Starling and Prometheus that custom labels cannot override.
+	reservedLabelNames = map[string]bool{
+		"sim":      true,
+		"target":   true,
+		"model":    true,
+		"hub":      true,
+		"device":   true,
+		"error":    true,
+		"type":     true,
+		"le":       true,
+		"quantile": true,
+		"job":      true,
+		"instance": true,
+	}
+)
+
+// ValidateLabels makes sure that the custom labels of the simulation can be added to its metrics.
+func (s *Simulation) ValidateLabels() error {
+	for name, value := range s.Labels {
+		if !validLabelName.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("label name '%s' can only contain letters, digits and '_', and must not start with a digit or '__'", name)
+		}
+		if reservedLabelNames[name] {
+			return fmt.Errorf("label name '%s' is reserved", name)
+		}
+		if len(value) == 0 {
+			return fmt.Errorf("label '%s' must have a value", name)
+		}
+	}
+
+	return nil
+}
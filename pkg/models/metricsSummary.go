@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+type (
+	// Percentiles summarizes a latency distribution in seconds.
+	Percentiles struct {
+		Count float64 `json:"count"` // number of observations.
+		Mean  float64 `json:"mean"`  // average latency.
+		P50   float64 `json:"p50"`   // median latency.
+		P90   float64 `json:"p90"`   // 90th percentile latency.
+		P99   float64 `json:"p99"`   // 99th percentile latency.
+	}
+
+	// ModelMetricsSummary summarizes the metrics of the devices of a model in a simulation.
+	ModelMetricsSummary struct {
+		ModelID   string                        `json:"modelId"`   // model of the devices.
+		Devices   float64                       `json:"devices"`   // number of devices simulated.
+		Connected float64                       `json:"connected"` // number of devices connected.
+		Totals    map[string]float64            `json:"totals"`    // counters since Starling started by name.
+		Rates     map[string]float64            `json:"rates"`     // counters per second over the window by name.
+		Errors    map[string]map[string]float64 `json:"errors"`    // failures since Starling started by operation and error type.
+		Latency   map[string]Percentiles        `json:"latency"`   // latencies over the window by operation.
+	}
+
+	// MetricsSample is a point of the throughput and latency time series of a simulation.
+	MetricsSample struct {
+		Time                time.Time `json:"time"`                // end of the sampling interval.
+		Connected           float64   `json:"connected"`           // number of devices connected.
+		TelemetryRate       float64   `json:"telemetryRate"`       // telemetry messages sent per second.
+		ErrorRate           float64   `json:"errorRate"`           // failures per second.
+		TelemetryLatencyP50 float64   `json:"telemetryLatencyP50"` // median telemetry send latency in seconds.
+		TelemetryLatencyP99 float64   `json:"telemetryLatencyP99"` // 99th percentile telemetry send latency in seconds.
+	}
+
+	// SimulationMetricsSummary summarizes the metrics of a simulation without requiring Prometheus.
+	SimulationMetricsSummary struct {
+		SimulationID string                `json:"simulationId"`      // the simulation.
+		Time         time.Time             `json:"time"`              // when the summary was taken.
+		Window       float64               `json:"window"`            // seconds covered by the rates and latencies.
+		Models       []ModelMetricsSummary `json:"models"`            // metrics by model.
+		Samples      []MetricsSample       `json:"samples"`           // recent time series of the whole simulation.
+		Billing      *BillingEstimate      `json:"billing,omitempty"` // estimate of the IoT Central messages billed.
+	}
+)
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+type (
+	// CentralDevice is a device as returned by the IoT Central devices REST API.
+	CentralDevice struct {
+		ID          string `json:"id"`                    // unique id of the device.
+		DisplayName string `json:"displayName"`           // display name of the device.
+		Template    string `json:"template,omitempty"`    // device template of the device.
+		Enabled     bool   `json:"enabled"`               // whether the device is allowed to connect.
+		Provisioned bool   `json:"provisioned"`           // whether the device has been provisioned through DPS.
+		Simulated   bool   `json:"simulated,omitempty"`   // whether the device is simulated by IoT Central itself.
+		ETag        string `json:"etag,omitempty"`        // version of the device.
+		Description string `json:"description,omitempty"` // description of the device.
+	}
+
+	// ReconcileDevice describes a device that differs between the local device cache and IoT Central.
+	ReconcileDevice struct {
+		DeviceID     string `json:"deviceId"`               // id of the device.
+		DisplayName  string `json:"displayName,omitempty"`  // display name of the device in IoT Central.
+		Template     string `json:"template,omitempty"`     // device template of the device in IoT Central.
+		SimulationID string `json:"simulationId,omitempty"` // simulation that provisioned the device, if known.
+		ModelID      string `json:"modelId,omitempty"`      // model of the device, if known.
+	}
+
+	// ReconcileReport lists the differences between the local device cache of a target and the devices in IoT Central.
+	ReconcileReport struct {
+		TargetID       string            `json:"targetId"`       // target that was reconciled.
+		Time           time.Time         `json:"time"`           // when the report was created.
+		LocalDevices   int               `json:"localDevices"`   // number of devices in the local cache.
+		CentralDevices int               `json:"centralDevices"` // number of devices in IoT Central.
+		Matched        int               `json:"matched"`        // number of enabled devices present on both sides.
+		LocalOnly      []ReconcileDevice `json:"localOnly"`      // devices cached locally but missing in IoT Central.
+		CentralOnly    []ReconcileDevice `json:"centralOnly"`    // devices in IoT Central that are not cached locally.
+		Disabled       []ReconcileDevice `json:"disabled"`       // cached devices that are blocked in IoT Central.
+	}
+
+	// ReconcileFixRequest specifies how to resolve the differences found by reconciling a target.
+	ReconcileFixRequest struct {
+		RemoveLocalOnly   bool     `json:"removeLocalOnly"`     // remove devices missing in IoT Central from the local cache.
+		DeleteCentralOnly bool     `json:"deleteCentralOnly"`   // delete devices from IoT Central that are not cached locally.
+		EnableDisabled    bool     `json:"enableDisabled"`      // unblock cached devices that are blocked in IoT Central.
+		RemoveDisabled    bool     `json:"removeDisabled"`      // remove cached devices that are blocked in IoT Central from the local cache.
+		DeviceIDs         []string `json:"deviceIds,omitempty"` // limit the fixes to these devices; required to delete devices from IoT Central.
+	}
+
+	// CleanupRequest specifies which devices to delete when cleaning up a target.
+	CleanupRequest struct {
+		Prefix        string   `json:"prefix,omitempty"`        // delete devices whose id starts with this prefix instead of the Starling naming patterns.
+		Pattern       string   `json:"pattern,omitempty"`       // delete devices whose id matches this regular expression instead of the Starling naming patterns.
+		IncludeActive bool     `json:"includeActive,omitempty"` // also delete devices that belong to existing simulations.
+		DeviceIDs     []string `json:"deviceIds,omitempty"`     // delete exactly these previewed devices instead of previewing again.
+	}
+
+	// CleanupPreview lists the devices that would be deleted when cleaning up a target.
+	CleanupPreview struct {
+		TargetID string            `json:"targetId"` // target to clean up.
+		Patterns []string          `json:"patterns"` // regular expressions used to find the devices.
+		Devices  []ReconcileDevice `json:"devices"`  // devices to delete.
+		Skipped  int               `json:"skipped"`  // matching devices skipped as they belong to existing simulations.
+	}
+
+	// ReconcileFailure describes a device that could not be fixed.
+	ReconcileFailure struct {
+		DeviceID string `json:"deviceId"` // the device that failed.
+		Error    string `json:"error"`    // reason for the failure.
+	}
+
+	// ReconcileFixResult lists the changes made to resolve the differences of a target.
+	ReconcileFixResult struct {
+		TargetID       string             `json:"targetId"`       // target that was fixed.
+		RemovedLocal   []string           `json:"removedLocal"`   // devices removed from the local cache.
+		DeletedCentral []string           `json:"deletedCentral"` // devices deleted from IoT Central.
+		Enabled        []string           `json:"enabled"`        // devices unblocked in IoT Central.
+		Failures       []ReconcileFailure `json:"failures"`       // devices that could not be fixed.
+	}
+)
+
+// Validate makes sure that the requested fixes are consistent and safe to apply.
+func (f *ReconcileFixRequest) Validate() error {
+	if f.DeleteCentralOnly && len(f.DeviceIDs) == 0 {
+		return errors.New("devices to delete from IoT Central must be listed explicitly in deviceIds")
+	}
+	if f.EnableDisabled && f.RemoveDisabled {
+		return errors.New("disabled devices can either be enabled or removed, not both")
+	}
+
+	return nil
+}
+
+// Validate checks that the device id pattern of a cleanup request is a valid regular expression.
+func (c *CleanupRequest) Validate() error {
+	if _, err := regexp.Compile(c.Pattern); err != nil {
+		return fmt.Errorf("invalid device id pattern '%s': %w", c.Pattern, err)
+	}
+
+	return nil
+}
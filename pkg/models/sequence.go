@@ -0,0 +1,25 @@
+package models
+
+type (
+	// SequenceRange is an inclusive range of telemetry sequence numbers.
+	SequenceRange struct {
+		From int `json:"from"` // first sequence number in the range.
+		To   int `json:"to"`   // last sequence number in the range.
+	}
+
+	// DeviceSequenceReport compares the telemetry sequence numbers sent by a device with the ones observed in a sink.
+	DeviceSequenceReport struct {
+		DeviceID        string          `json:"deviceId"`        // id of the device.
+		SimulationID    string          `json:"simulationId"`    // simulation of the device.
+		TargetID        string          `json:"targetId"`        // target application of the device.
+		ModelID         string          `json:"modelId"`         // model of the device.
+		Sink            string          `json:"sink"`            // sink the messages were observed in, verifier or consumer.
+		Sent            int             `json:"sent"`            // number of messages sent successfully.
+		Received        int             `json:"received"`        // number of distinct messages observed.
+		Duplicates      int             `json:"duplicates"`      // number of messages observed more than once.
+		Lost            int             `json:"lost"`            // number of messages sent before the last one observed that were never observed.
+		Pending         int             `json:"pending"`         // number of messages sent after the last one observed.
+		HighestReceived int             `json:"highestReceived"` // highest sequence number observed.
+		Gaps            []SequenceRange `json:"gaps"`            // ranges of lost sequence numbers.
+	}
+)
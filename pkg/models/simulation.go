@@ -18,9 +18,11 @@ type (
 
 	// SimulationDeviceConfig defines the device configuration for a simulation.
 	SimulationDeviceConfig struct {
-		ID          string `json:"id"`          // the id of the configuration
-		ModelID     string `json:"modelId"`     // the model to simulate.
-		DeviceCount int    `json:"deviceCount"` // the total no. of devices to simulate.
+		ID          string   `json:"id"`                   // the id of the configuration
+		ModelID     string   `json:"modelId"`              // the model to simulate.
+		DeviceCount int      `json:"deviceCount"`          // the total no. of devices to simulate.
+		IDTemplate  string   `json:"idTemplate,omitempty"` // template to generate device ids from e.g. {sim}-{model}-{index:4}.
+		DeviceIDs   []string `json:"deviceIds,omitempty"`  // explicit list of device ids to use instead of the template.
 	}
 
 	// Simulation definition.
@@ -36,21 +38,45 @@ type (
 		ReportedPropsInterval int                      `json:"reportedPropertyInterval"` // interval to wait between sending reported properties.
 		DisconnectBehavior    DeviceDisconnectBehavior `json:"disconnectBehavior"`       // device connection behavior.
 		TelemetryFormat       TelemetryFormat          `json:"telemetryFormat"`          // format of telemetry messages.
+		VerifyDelivery        *DeliveryVerification    `json:"verifyDelivery,omitempty"` // verify that telemetry arrives in IoT Central, disabled if empty.
+		MessageBudget         *MessageBudget           `json:"messageBudget,omitempty"`  // budget of IoT Central messages to warn about, not checked if empty.
+		Labels                map[string]string        `json:"labels,omitempty"`         // custom labels added to all metrics of the simulation e.g. build number.
+		DeviceMetrics         bool                     `json:"deviceMetrics,omitempty"`  // report metrics per device, only for small debug runs.
 		LastUpdatedTime       time.Time                `json:"lastUpdatedTime"`          // when the status was last updated
 	}
 
+	// DeliveryVerification configures reading back telemetry from IoT Central to verify its delivery end-to-end.
+	DeliveryVerification struct {
+		SampleSize int `json:"sampleSize"` // number of devices whose telemetry is verified.
+		Interval   int `json:"interval"`   // interval in seconds between reading back telemetry.
+		Grace      int `json:"grace"`      // seconds after which telemetry not found in IoT Central is counted as lost.
+	}
+
 	// SimulationViewDeviceConfig defines the device configuration for a simulation view.
 	SimulationViewDeviceConfig struct {
-		ID               string `json:"id"`               // the id of the configuration
-		ModelID          string `json:"modelId"`          // the model to simulate.
-		ProvisionedCount int    `json:"provisionedCount"` // number of provisioned devices.
-		SimulatedCount   int    `json:"simulatedCount"`   // number of devices to simulate.
-		ConnectedCount   int    `json:"connectedCount"`   // number of devices currently connected.
+		ID               string   `json:"id"`                   // the id of the configuration
+		ModelID          string   `json:"modelId"`              // the model to simulate.
+		ProvisionedCount int      `json:"provisionedCount"`     // number of provisioned devices.
+		SimulatedCount   int      `json:"simulatedCount"`       // number of devices to simulate.
+		ConnectedCount   int      `json:"connectedCount"`       // number of devices currently connected.
+		IDTemplate       string   `json:"idTemplate,omitempty"` // template to generate device ids from.
+		DeviceIDs        []string `json:"deviceIds,omitempty"`  // explicit list of device ids to use instead of the template.
 	}
 
 	SimulationView struct {
-		Simulation                              // simulation configuration
-		Devices    []SimulationViewDeviceConfig `json:"devices"` // devices configurations
+		Simulation                                        // simulation configuration
+		Devices              []SimulationViewDeviceConfig `json:"devices"`                        // devices configurations
+		ProvisioningFailures []ProvisioningFailure        `json:"provisioningFailures,omitempty"` // most frequent reasons devices failed provisioning
+		Billing              *BillingEstimate             `json:"billing,omitempty"`              // estimate of the IoT Central messages billed
+	}
+
+	// ProvisioningFailure counts the devices of a simulation that failed provisioning for the same reason.
+	ProvisioningFailure struct {
+		ErrorType ErrorType `json:"errorType"`         // classification of the failure.
+		Reason    string    `json:"reason"`            // reason reported by DPS e.g. its status and error code.
+		Count     int       `json:"count"`             // number of failures for this reason.
+		Message   string    `json:"message,omitempty"` // error message of the last failure.
+		LastTime  time.Time `json:"lastTime"`          // when the last failure happened.
 	}
 )
 
@@ -61,8 +87,10 @@ const (
 	SimulationStatusRunning SimulationStatus = "running"
 	// SimulationStatusProvisioning specifies that the simulation is provisioning devices.
 	SimulationStatusProvisioning SimulationStatus = "provisioning"
-	// SimulationStatusDeleting specifies that the devices in the simulation are getting deleted.
+	// SimulationStatusDeleting specifies that the simulation is getting deleted along with its devices.
 	SimulationStatusDeleting SimulationStatus = "deleting"
+	// SimulationStatusDeletingDevices specifies that devices of the simulation are getting deleted.
+	SimulationStatusDeletingDevices SimulationStatus = "deletingDevices"
 
 	// DeviceDisconnectNever specifies that the device should never disconnect.
 	DeviceDisconnectNever DeviceDisconnectBehavior = "never"
@@ -96,7 +124,8 @@ func (status *SimulationStatus) UnmarshalJSON(b []byte) error {
 	case SimulationStatusReady,
 		SimulationStatusRunning,
 		SimulationStatusProvisioning,
-		SimulationStatusDeleting:
+		SimulationStatusDeleting,
+		SimulationStatusDeletingDevices:
 		*status = s
 		return nil
 	default:
@@ -1,5 +1,11 @@
 package models
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 type SimulationTargetType string
 
 type (
@@ -22,9 +28,12 @@ type (
 
 	// SimulationTargetDevice cached copy of a device connection string  in a target.
 	SimulationTargetDevice struct {
-		TargetID         string `json:"targetId"`         // identifier of a target.
-		DeviceID         string `json:"deviceId"`         // device identifier in the target.
-		ConnectionString string `json:"connectionString"` // IoT Hub connection string for the device.
+		TargetID         string `json:"targetId"`               // identifier of a target.
+		DeviceID         string `json:"deviceId"`               // device identifier in the target.
+		ConnectionString string `json:"connectionString"`       // IoT Hub connection string for the device.
+		SimulationID     string `json:"simulationId,omitempty"` // simulation that provisioned the device.
+		ModelID          string `json:"modelId,omitempty"`      // model of the device.
+		Index            int    `json:"index,omitempty"`        // 1 based index of the device within its device config.
 	}
 
 	// SimulationTargetView specifies the target to be added
@@ -33,3 +42,63 @@ type (
 		ImportModels     bool `json:"importModels"` // Should models be imported when a new SimulationTarget is added
 	}
 )
+
+// BelongsTo returns true if the device was provisioned by the given simulation for the given model.
+// All models of the simulation are matched if the model id is empty.
+func (d *SimulationTargetDevice) BelongsTo(simulationID string, modelID string) bool {
+	if len(d.SimulationID) > 0 {
+		return d.SimulationID == simulationID && (len(modelID) == 0 || d.ModelID == modelID)
+	}
+
+	// devices cached before ownership was recorded are named SimID-TargetID-ModelID-N
+	prefix := fmt.Sprintf("%s-%s-", simulationID, d.TargetID)
+	if !strings.HasPrefix(d.DeviceID, prefix) {
+		return false
+	}
+
+	// the model is everything up to the index, so that model m does not match the devices of model m-2
+	rest := d.DeviceID[len(prefix):]
+	i := strings.LastIndex(rest, "-")
+	if i < 1 || !isDigits(rest[i+1:]) {
+		return false
+	}
+	return len(modelID) == 0 || rest[:i] == modelID
+}
+
+// BelongsToConfig returns true if the device was provisioned by the given simulation for the device config. A
+// simulation has one device config per model, so devices are matched by the model of the config. Devices cached before
+// ownership was recorded are named after the model when they were provisioned, and after the config id when they were
+// created by the simulator, so both names are matched.
+func (d *SimulationTargetDevice) BelongsToConfig(simulationID string, cfg *SimulationDeviceConfig) bool {
+	if len(d.SimulationID) > 0 {
+		return d.BelongsTo(simulationID, cfg.ModelID)
+	}
+
+	return d.BelongsTo(simulationID, cfg.ModelID) || (len(cfg.ID) > 0 && d.BelongsTo(simulationID, cfg.ID))
+}
+
+// isDigits returns true if s is a non-empty string of decimal digits.
+func isDigits(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// DeviceIndex returns the 1 based index of the device within its device config.
+func (d *SimulationTargetDevice) DeviceIndex() int {
+	if d.Index > 0 {
+		return d.Index
+	}
+
+	// devices cached before the index was recorded end with the index
+	i := strings.LastIndex(d.DeviceID, "-")
+	index, _ := strconv.Atoi(d.DeviceID[i+1:])
+	return index
+}
@@ -2,16 +2,20 @@ package serving
 
 import (
 	"embed"
+	"errors"
 	"fmt"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/iot-for-all/starling/pkg/central"
 	"github.com/iot-for-all/starling/pkg/config"
 	"github.com/iot-for-all/starling/pkg/controlling"
+	"github.com/iot-for-all/starling/pkg/storing"
 	"github.com/rs/zerolog/log"
 	"io/fs"
 	"net/http"
 	"os"
 	"path"
+	"strconv"
 )
 
 var (
@@ -39,10 +43,15 @@ func StartAdmin(globalCfg *config.GlobalConfig, ctrl *controlling.Controller) {
 	router.HandleFunc("/api/simulation/{id}/provision/{modelId}/{numDevices}", provisionDevices).Methods(http.MethodPost)
 	router.HandleFunc("/api/simulation/{id}/provision", deleteAllDevices).Methods(http.MethodDelete)
 	router.HandleFunc("/api/simulation/{id}/provision/{modelId}/{numDevices}", deleteDevices).Methods(http.MethodDelete)
+	router.HandleFunc("/api/simulation/{id}/metrics", getSimulationMetrics).Methods(http.MethodGet)
+	router.HandleFunc("/api/simulation/{id}/sequences", listSequenceReports).Methods(http.MethodGet)
+	router.HandleFunc("/api/simulation/{id}/sequences/{deviceId}", getSequenceReport).Methods(http.MethodGet)
+	router.HandleFunc("/api/simulation/{id}/device/{deviceId}/events", getDeviceEvents).Methods(http.MethodGet)
 	router.HandleFunc("/api/simulation/{id}/deviceConfig", listDeviceConfigs).Methods(http.MethodGet)
 	router.HandleFunc("/api/simulation/{id}/deviceConfig", upsertDeviceConfig).Methods(http.MethodPut)
 	router.HandleFunc("/api/simulation/{id}/deviceConfig/{configId}", getDeviceConfig).Methods(http.MethodGet)
 	router.HandleFunc("/api/simulation/{id}/deviceConfig/{configId}", deleteDeviceConfig).Methods(http.MethodDelete)
+	router.HandleFunc("/api/simulation/{id}/deviceConfig/{configId}/deviceIds", uploadDeviceIDs).Methods(http.MethodPut)
 
 	router.HandleFunc("/api/target", listTargets).Methods(http.MethodGet)
 	router.HandleFunc("/api/target", upsertTarget).Methods(http.MethodPut)
@@ -56,11 +65,25 @@ func StartAdmin(globalCfg *config.GlobalConfig, ctrl *controlling.Controller) {
 	router.HandleFunc("/api/target/{id}/models", getTargetModels).Methods(http.MethodGet)
 	router.HandleFunc("/api/target/{id}/models", upsertTargetModels).Methods(http.MethodPut)
 	router.HandleFunc("/api/target/{id}/models", deleteTargetModels).Methods(http.MethodDelete)
+	router.HandleFunc("/api/target/{id}/reconcile", reconcileTarget).Methods(http.MethodGet)
+	router.HandleFunc("/api/target/{id}/reconcile", fixTarget).Methods(http.MethodPost)
+	router.HandleFunc("/api/target/{id}/cleanup", previewTargetCleanup).Methods(http.MethodGet)
+	router.HandleFunc("/api/target/{id}/cleanup", cleanupTarget).Methods(http.MethodPost)
+
+	router.HandleFunc("/api/jobs", listJobs).Methods(http.MethodGet)
+	router.HandleFunc("/api/jobs/{id}", getJob).Methods(http.MethodGet)
+	router.HandleFunc("/api/jobs/{id}", deleteJob).Methods(http.MethodDelete)
+	router.HandleFunc("/api/jobs/{id}/cancel", cancelJob).Methods(http.MethodPost)
+	router.HandleFunc("/api/jobs/{id}/retry", retryJob).Methods(http.MethodPost)
 
 	router.HandleFunc("/api/model", listDeviceModels).Methods(http.MethodGet)
 	router.HandleFunc("/api/model", upsertDeviceModel).Methods(http.MethodPut)
 	router.HandleFunc("/api/model/{id}", getDeviceModel).Methods(http.MethodGet)
 	router.HandleFunc("/api/model/{id}", deleteDeviceModel).Methods(http.MethodDelete)
+	router.HandleFunc("/api/model/{id}/publish", publishDeviceModel).Methods(http.MethodPost)
+
+	router.HandleFunc("/api/admin/backup", backupStore).Methods(http.MethodGet)
+	router.HandleFunc("/api/admin/restore", restoreStore).Methods(http.MethodPost)
 
 	// WEB API
 	router.HandleFunc("/webapi/model", webAPIListDeviceModels).Methods(http.MethodGet)
@@ -74,6 +97,7 @@ func StartAdmin(globalCfg *config.GlobalConfig, ctrl *controlling.Controller) {
 	router.HandleFunc("/webapi/target", webAPIAddTarget).Methods(http.MethodPost)
 	router.HandleFunc("/webapi/target", webAPIUpdateTarget).Methods(http.MethodPut)
 	router.HandleFunc("/webapi/target/{id}", webAPIDeleteTarget).Methods(http.MethodDelete)
+	router.HandleFunc("/webapi/target/{id}/templates", webAPIListTargetTemplates).Methods(http.MethodGet)
 	router.HandleFunc("/webapi/target/{id}/import", webAPIImportModelsFromTarget).Methods(http.MethodPost)
 
 	router.HandleFunc("/webapi/simulation", webAPIListSimulations).Methods(http.MethodGet)
@@ -85,6 +109,7 @@ func StartAdmin(globalCfg *config.GlobalConfig, ctrl *controlling.Controller) {
 	router.HandleFunc("/webapi/simulation/{id}/start", webAPIStartSimulation).Methods(http.MethodPost)
 	router.HandleFunc("/webapi/simulation/{id}/stop", webAPIStopSimulation).Methods(http.MethodPost)
 	router.HandleFunc("/webapi/simulation/{id}/export", webAPIExportSimulation).Methods(http.MethodGet)
+	router.HandleFunc("/webapi/simulation/{id}/events", webAPISimulationEvents).Methods(http.MethodGet)
 
 	router.HandleFunc("/webapi/config", webAPIGetConfig).Methods(http.MethodGet)
 	router.HandleFunc("/webapi/config", webAPIUpdateConfig).Methods(http.MethodPut)
@@ -105,7 +130,7 @@ func StartAdmin(globalCfg *config.GlobalConfig, ctrl *controlling.Controller) {
 	log.Info().Msgf("serving UX at http://localhost:%d", globalConfig.HTTP.AdminPort)
 
 	// handle CORS
-	headersOK := handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization"})
+	headersOK := handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization", backupPassphraseHeader})
 	methodsOK := handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "HEAD", "OPTIONS"})
 	originsOK := handlers.AllowedOrigins([]string{"*"})
 
@@ -157,8 +182,30 @@ func AssetHandler(prefix, root string) http.Handler {
 func handleError(err error, w http.ResponseWriter) bool {
 	if err != nil {
 		log.Error().Err(err).Msg("error encountered while processing request")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), errorStatus(err))
 		return true
 	}
 	return false
 }
+
+// errorStatus maps an error to the HTTP status code of the response.
+func errorStatus(err error) int {
+	var conflict *storing.ConflictError
+	switch {
+	case errors.As(err, &conflict):
+		return http.StatusConflict
+	case errors.Is(err, central.ErrUnauthorized), errors.Is(err, central.ErrUnavailable):
+		// the target application rejected or failed the request, not the caller
+		return http.StatusBadGateway
+	case errors.Is(err, central.ErrThrottled):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// cascadeRequested checks whether a delete request asks to delete the records referencing the deleted one too.
+func cascadeRequested(r *http.Request) bool {
+	cascade, _ := strconv.ParseBool(r.URL.Query().Get("cascade"))
+	return cascade
+}
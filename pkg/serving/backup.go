@@ -0,0 +1,59 @@
+package serving
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/iot-for-all/starling/pkg/storing"
+	"github.com/rs/zerolog/log"
+)
+
+// backupPassphraseHeader carries the passphrase encrypting the secrets of a backup, so that it is not logged with the URL.
+const backupPassphraseHeader = "X-Backup-Passphrase"
+
+// backupStore streams a snapshot of all stores. Secrets are encrypted if a passphrase is given and left out otherwise,
+// unless the request explicitly asks for them in plain text.
+func backupStore(w http.ResponseWriter, r *http.Request) {
+	opts := storing.BackupOptions{Passphrase: r.Header.Get(backupPassphraseHeader)}
+	opts.ExcludeSecrets = len(opts.Passphrase) == 0
+	if value := r.URL.Query().Get("excludeSecrets"); len(value) > 0 {
+		excludeSecrets, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid excludeSecrets value '%s'", value), http.StatusBadRequest)
+			return
+		}
+		opts.ExcludeSecrets = excludeSecrets
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=starling-%s.backup", time.Now().UTC().Format("20060102-150405")))
+	if err := storing.Backup(w, opts); err != nil {
+		// the response is already streaming, so the client only sees a truncated backup
+		log.Error().Err(err).Msg("error writing backup")
+	}
+}
+
+// restoreStore restores a backup into the empty stores.
+func restoreStore(w http.ResponseWriter, r *http.Request) {
+	restored, err := storing.Restore(r.Body, r.Header.Get(backupPassphraseHeader))
+	if errors.Is(err, storing.ErrNotEmpty) {
+		msg := "Backups can only be restored into an empty data directory."
+		log.Error().Msg(msg)
+		http.Error(w, msg, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Int("restored", restored).Msg("error restoring backup")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Info().Int("restored", restored).Msg("restored backup")
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]int{"restored": restored})
+	handleError(err, w)
+}
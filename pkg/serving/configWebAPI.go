@@ -12,13 +12,38 @@ import (
 	"path/filepath"
 )
 
+// maskedSecret replaces the passwords in the configuration returned by the web API.
+const maskedSecret = "********"
+
 // webAPIGetConfig get the current configuration.
 func webAPIGetConfig(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	err := json.NewEncoder(w).Encode(globalConfig)
+	err := json.NewEncoder(w).Encode(maskSecrets(*globalConfig))
 	handleError(err, w)
 }
 
+// maskSecrets returns a copy of the configuration with its passwords masked.
+func maskSecrets(cfg config.GlobalConfig) config.GlobalConfig {
+	if len(cfg.Export.Password) > 0 {
+		cfg.Export.Password = maskedSecret
+	}
+	if len(cfg.Consumer.Password) > 0 {
+		cfg.Consumer.Password = maskedSecret
+	}
+
+	return cfg
+}
+
+// keepSecrets keeps the current passwords where the updated configuration sends back the masked ones.
+func keepSecrets(cfg *config.GlobalConfig) {
+	if cfg.Export.Password == maskedSecret {
+		cfg.Export.Password = globalConfig.Export.Password
+	}
+	if cfg.Consumer.Password == maskedSecret {
+		cfg.Consumer.Password = globalConfig.Consumer.Password
+	}
+}
+
 // webAPIUpdateConfig update current configuration.
 func webAPIUpdateConfig(w http.ResponseWriter, r *http.Request) {
 	req, err := ioutil.ReadAll(r.Body)
@@ -34,10 +59,14 @@ func webAPIUpdateConfig(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// update config
+	keepSecrets(&cfg)
 	globalConfig.Data = cfg.Data
 	globalConfig.HTTP = cfg.HTTP
 	globalConfig.Logger = cfg.Logger
 	globalConfig.Simulation = cfg.Simulation
+	globalConfig.Consumer = cfg.Consumer
+	globalConfig.Tracing = cfg.Tracing
+	globalConfig.Export = cfg.Export
 
 	// generate YAML content and write it to the config file
 	exeDir, err := filepath.Abs(filepath.Dir(os.Args[0]))
@@ -55,7 +84,7 @@ func webAPIUpdateConfig(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// write the config back to request
-	err = json.NewEncoder(w).Encode(globalConfig)
+	err = json.NewEncoder(w).Encode(maskSecrets(*globalConfig))
 	handleError(err, w)
 }
 
@@ -2,12 +2,15 @@ package serving
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/iot-for-all/starling/pkg/models"
 	"github.com/iot-for-all/starling/pkg/storing"
+	"github.com/rs/zerolog/log"
 )
 
 // listDeviceConfigs lists all device configurations for a simulation.
@@ -62,6 +65,12 @@ func upsertDeviceConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err = cfg.ValidateDeviceIDs(); err != nil {
+		log.Error().Err(err).Str("simID", simID).Msg("invalid device configuration")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	err = storing.DeviceConfigs.Set(simID, &cfg)
 	if handleError(err, w) {
 		return
@@ -80,3 +89,57 @@ func deleteDeviceConfig(w http.ResponseWriter, r *http.Request) {
 	err := storing.DeviceConfigs.Delete(simID, cfgID)
 	handleError(err, w)
 }
+
+// uploadDeviceIDs replaces the naming of the devices in a device configuration with an explicit list of device ids.
+// The list is either a JSON array or plain text with one device id per line.
+func uploadDeviceIDs(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	simID := vars["id"]
+	cfgID := vars["configId"]
+
+	cfg, err := storing.DeviceConfigs.Get(simID, cfgID)
+	if handleError(err, w) {
+		return
+	}
+
+	if cfg == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	req, err := ioutil.ReadAll(r.Body)
+	if handleError(err, w) {
+		return
+	}
+
+	var deviceIDs []string
+	if strings.HasPrefix(strings.TrimSpace(string(req)), "[") {
+		if err = json.Unmarshal(req, &deviceIDs); err != nil {
+			http.Error(w, fmt.Sprintf("invalid list of device ids: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+	} else {
+		for _, line := range strings.Split(string(req), "\n") {
+			if id := strings.TrimSpace(line); len(id) > 0 {
+				deviceIDs = append(deviceIDs, id)
+			}
+		}
+	}
+
+	cfg.IDTemplate = ""
+	cfg.DeviceIDs = deviceIDs
+	if err = cfg.ValidateDeviceIDs(); err != nil {
+		log.Error().Err(err).Str("simID", simID).Msg("invalid list of device ids")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = storing.DeviceConfigs.Set(simID, cfg)
+	if handleError(err, w) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(cfg)
+	handleError(err, w)
+}
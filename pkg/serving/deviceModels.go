@@ -5,6 +5,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/iot-for-all/starling/pkg/models"
 	"github.com/iot-for-all/starling/pkg/storing"
+	"github.com/rs/zerolog/log"
 	"io/ioutil"
 	"net/http"
 )
@@ -61,7 +62,7 @@ func upsertDeviceModel(w http.ResponseWriter, r *http.Request) {
 func deleteDeviceModel(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
-	err := storing.DeviceModels.Delete(id)
+	err := storing.DeviceModels.Delete(id, cascadeRequested(r))
 	handleError(err, w)
 }
 
@@ -75,3 +76,67 @@ func upsertDeviceModelInternal(w http.ResponseWriter, r *http.Request, model mod
 	err = json.NewEncoder(w).Encode(&model)
 	handleError(err, w)
 }
+
+// publishDeviceModel creates or updates the device template of a model in the IoT Central application of a target.
+// A conflict is returned with the differences when the device template exists and overwriting it was not requested.
+func publishDeviceModel(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	model, err := storing.DeviceModels.Get(id)
+	if handleError(err, w) {
+		return
+	}
+
+	if model == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if handleError(err, w) {
+		return
+	}
+
+	var req models.ModelPublishRequest
+	err = json.Unmarshal(body, &req)
+	if handleError(err, w) {
+		return
+	}
+
+	if len(req.TargetID) == 0 {
+		log.Error().Str("modelID", id).Msg("publishing model requires a target")
+		http.Error(w, "targetId is required", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.TemplateID) > 0 {
+		if err = models.ValidateTemplateID(req.TemplateID); err != nil {
+			log.Error().Err(err).Str("modelID", id).Msg("invalid device template id")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	target, err := storing.Targets.Get(req.TargetID)
+	if handleError(err, w) {
+		return
+	}
+
+	if target == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	result, err := controller.PublishModel(r.Context(), model, target, &req)
+	if handleError(err, w) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !req.DryRun && result.Exists && !result.Published && len(result.Changes) > 0 {
+		w.WriteHeader(http.StatusConflict)
+	}
+	err = json.NewEncoder(w).Encode(result)
+	handleError(err, w)
+}
@@ -98,46 +98,8 @@ func webAPIUpdateDeviceModel(w http.ResponseWriter, r *http.Request) {
 
 // webAPIDeleteDeviceModel deletes an existing device model.
 func webAPIDeleteDeviceModel(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
-
-	// check if there are any simulations using this model
-	sims, err := storing.Simulations.List()
-	if handleError(err, w) {
-		return
-	}
-
-	for _, sim := range sims {
-		deviceConfigs, err := storing.DeviceConfigs.List(sim.ID)
-		if handleError(err, w) {
-			return
-		}
-
-		for _, dc := range deviceConfigs {
-			// TODO: Check for provisioned and sim device counts
-			if dc.ModelID == id {
-				msg := fmt.Sprintf("device model '%s' cannot be deleted as there are simulations using this model. Delete the simulation '%s' and try again.", id, sim.Name)
-				log.Error().Msg(msg)
-				http.Error(w, msg, http.StatusBadRequest)
-				return
-			}
-		}
-	}
-
+	// simulations using the model make the delete fail unless cascaded, targets stop listing it either way
 	deleteDeviceModel(w, r)
-
-	// delete this device model from all targets
-	targets, err := storing.Targets.List()
-	if handleError(err, w) {
-		return
-	}
-
-	for _, target := range targets {
-		err = storing.TargetModels.Delete(target.ID)
-		if handleError(err, w) {
-			return
-		}
-	}
 }
 
 func generateModelID(name string) (string, error) {
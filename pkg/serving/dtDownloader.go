@@ -3,13 +3,12 @@ package serving
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
+	"github.com/iot-for-all/starling/pkg/central"
 	"github.com/iot-for-all/starling/pkg/models"
-	"io"
-	"net/http"
+	"github.com/iot-for-all/starling/pkg/storing"
+	"strconv"
 	"strings"
-	"time"
 )
 
 type DeviceTemplateDownloader struct {
@@ -22,54 +21,204 @@ func NewDeviceTemplateDownloader(target *models.SimulationTarget) *DeviceTemplat
 	}
 }
 
-func (d *DeviceTemplateDownloader) DownloadModels() ([]*models.DeviceModel, error) {
-	var deviceModels []*models.DeviceModel
-	ctx := context.Background()
-	path := fmt.Sprintf("https://%s/api/deviceTemplates?api-version=1.0", d.target.AppUrl)
-	req, err := http.NewRequestWithContext(ctx, "GET", path, nil)
+// ListTemplates lists the device templates in the target application along with the model id each one is imported as.
+// Templates that cannot be imported carry the reason.
+func (d *DeviceTemplateDownloader) ListTemplates() ([]models.DeviceTemplateImport, error) {
+	items, _, err := d.download()
+	return items, err
+}
+
+// DownloadModels downloads the selected device templates from the target application as device models.
+// All templates are downloaded if none are selected. Templates that cannot be imported are reported as skipped.
+func (d *DeviceTemplateDownloader) DownloadModels(selected []string) ([]*models.DeviceModel, *models.DeviceTemplateImportResult, error) {
+	items, deviceModels, err := d.download()
 	if err != nil {
-		return deviceModels, err
+		return nil, nil, err
 	}
 
-	req.Header.Add("Authorization", d.target.AppToken)
-	client := http.Client{
-		Timeout: time.Duration(10) * time.Second,
+	wanted := make(map[string]bool, len(selected))
+	for _, id := range selected {
+		wanted[id] = true
+	}
+
+	result := &models.DeviceTemplateImportResult{
+		Imported: []models.DeviceTemplateImport{},
+		Skipped:  []models.DeviceTemplateImport{},
+	}
+	var selectedModels []*models.DeviceModel
+	found := make(map[string]bool, len(items))
+	for i, item := range items {
+		found[item.TemplateID] = true
+		switch {
+		case len(wanted) > 0 && !wanted[item.TemplateID]:
+			continue
+		case len(item.Reason) > 0:
+			result.Skipped = append(result.Skipped, item)
+		default:
+			result.Imported = append(result.Imported, item)
+			selectedModels = append(selectedModels, deviceModels[i])
+		}
 	}
-	res, err := client.Do(req)
-	if err != nil {
-		return deviceModels, err
 
+	for _, id := range selected {
+		if !found[id] {
+			result.Skipped = append(result.Skipped, models.DeviceTemplateImport{
+				TemplateID: id,
+				Reason:     "device template not found in the application",
+			})
+		}
 	}
-	body, err := io.ReadAll(res.Body)
+
+	return selectedModels, result, nil
+}
+
+// download downloads all device templates from the target application. It returns the templates and the models
+// they are imported as at the same positions; the model is nil for templates that cannot be imported.
+func (d *DeviceTemplateDownloader) download() ([]models.DeviceTemplateImport, []*models.DeviceModel, error) {
+	deviceTemplates, err := central.NewClient(d.target).ListDeviceTemplates(context.Background())
 	if err != nil {
-		return deviceModels, err
+		return nil, nil, err
 	}
 
-	var dtr models.DeviceTemplateResponse
-	err = json.Unmarshal(body, &dtr)
+	existingModels, err := storing.DeviceModels.List()
 	if err != nil {
-		return deviceModels, err
+		return nil, nil, err
 	}
 
-	for _, deviceTemplate := range dtr.Value {
+	// models imported before keep their ids, other ids are taken
+	modelByTemplate := make(map[string]string)
+	takenIDs := make(map[string]bool)
+	for _, m := range existingModels {
+		if len(m.TemplateID) > 0 {
+			modelByTemplate[m.TemplateID] = m.ID
+		}
+		takenIDs[m.ID] = true
+	}
+	d.matchLegacyModels(deviceTemplates, existingModels, modelByTemplate)
+
+	items := make([]models.DeviceTemplateImport, len(deviceTemplates))
+	deviceModels := make([]*models.DeviceModel, len(deviceTemplates))
+	for i, deviceTemplate := range deviceTemplates {
+		templateID, _ := deviceTemplate["@id"].(string)
+		name, _ := deviceTemplate["displayName"].(string)
+		items[i] = models.DeviceTemplateImport{
+			TemplateID:  templateID,
+			DisplayName: name,
+			Version:     d.templateVersion(templateID),
+		}
+
 		capabilityModel, ok := deviceTemplate["capabilityModel"].(map[string]interface{})
-		if !ok {
-			return deviceModels, err
+		switch {
+		case len(templateID) == 0:
+			items[i].Reason = "device template has no @id"
+			continue
+		case len(name) == 0:
+			items[i].Reason = "device template has no displayName"
+			continue
+		case !ok:
+			items[i].Reason = "device template has no capabilityModel"
+			continue
 		}
-		name, ok := deviceTemplate["displayName"].(string)
+
+		modelID, ok := modelByTemplate[templateID]
 		if !ok {
-			return deviceModels, fmt.Errorf("could not find displayName in capability model")
+			modelID = d.uniqueModelID(d.scrubModelName(name), items[i].Version, takenIDs)
+			modelByTemplate[templateID] = modelID
+			takenIDs[modelID] = true
 		}
-		name = d.scrubModelName(name)
-		model := models.DeviceModel{
-			ID:              name,
-			Name:            name,
+		items[i].ModelID = modelID
+
+		deviceModels[i] = &models.DeviceModel{
+			ID:              modelID,
+			Name:            modelID,
 			CapabilityModel: []map[string]interface{}{capabilityModel},
+			TemplateID:      templateID,
+			TemplateVersion: items[i].Version,
+		}
+	}
+
+	return items, deviceModels, nil
+}
+
+// matchLegacyModels matches the models imported before their template was recorded to the templates they were imported
+// from, so that importing the templates again updates the models and records their template. The models were named
+// after the template, so a model is matched by the id of its capability model, or else by its name.
+func (d *DeviceTemplateDownloader) matchLegacyModels(deviceTemplates []map[string]interface{}, existingModels []models.DeviceModel, modelByTemplate map[string]string) {
+	legacyByCapability := make(map[string]string)
+	legacyByName := make(map[string]string)
+	for _, m := range existingModels {
+		if len(m.TemplateID) > 0 {
+			continue
+		}
+		legacyByName[m.ID] = m.ID
+		if len(m.CapabilityModel) > 0 {
+			if id, _ := m.CapabilityModel[0]["@id"].(string); len(id) > 0 {
+				legacyByCapability[id] = m.ID
+			}
+		}
+	}
+
+	match := func(templateID string, modelID string) {
+		modelByTemplate[templateID] = modelID
+		for id, legacyID := range legacyByCapability {
+			if legacyID == modelID {
+				delete(legacyByCapability, id)
+			}
+		}
+		delete(legacyByName, modelID)
+	}
+
+	for _, deviceTemplate := range deviceTemplates {
+		templateID, _ := deviceTemplate["@id"].(string)
+		capabilityModel, _ := deviceTemplate["capabilityModel"].(map[string]interface{})
+		capabilityID, _ := capabilityModel["@id"].(string)
+		if _, ok := modelByTemplate[templateID]; ok || len(templateID) == 0 || len(capabilityID) == 0 {
+			continue
+		}
+		if modelID, ok := legacyByCapability[capabilityID]; ok {
+			match(templateID, modelID)
+		}
+	}
+
+	for _, deviceTemplate := range deviceTemplates {
+		templateID, _ := deviceTemplate["@id"].(string)
+		name, _ := deviceTemplate["displayName"].(string)
+		if _, ok := modelByTemplate[templateID]; ok || len(templateID) == 0 {
+			continue
 		}
-		deviceModels = append(deviceModels, &model)
+		if modelID, ok := legacyByName[d.scrubModelName(name)]; ok {
+			match(templateID, modelID)
+		}
+	}
+}
+
+// templateVersion gets the version from the DTMI of a device template e.g. 2 for dtmi:contoso:thermostat;2.
+func (d *DeviceTemplateDownloader) templateVersion(templateID string) int {
+	i := strings.LastIndex(templateID, ";")
+	if i < 0 {
+		return 0
+	}
+
+	version, _ := strconv.Atoi(templateID[i+1:])
+	return version
+}
+
+// uniqueModelID derives a model id from the template name that is not taken yet. The version is appended when
+// another model already uses the name, so that multiple versions of a template can be imported side by side.
+func (d *DeviceTemplateDownloader) uniqueModelID(name string, version int, takenIDs map[string]bool) string {
+	if len(name) == 0 {
+		name = "model"
+	}
+	if !takenIDs[name] {
+		return name
+	}
+
+	id := fmt.Sprintf("%sv%d", name, version)
+	for n := 2; takenIDs[id]; n++ {
+		id = fmt.Sprintf("%sv%d_%d", name, version, n)
 	}
 
-	return deviceModels, nil
+	return id
 }
 
 func (d *DeviceTemplateDownloader) scrubModelName(name string) string {
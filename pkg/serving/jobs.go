@@ -0,0 +1,125 @@
+package serving
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/iot-for-all/starling/pkg/models"
+	"github.com/iot-for-all/starling/pkg/storing"
+	"github.com/rs/zerolog/log"
+)
+
+// listJobs lists all background jobs, optionally filtered by simulation.
+func listJobs(w http.ResponseWriter, r *http.Request) {
+	simID := r.URL.Query().Get("simulationId")
+	items, err := controller.ListJobs(simID)
+	if handleError(err, w) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(items)
+	handleError(err, w)
+}
+
+// getJob gets a background job by its id.
+func getJob(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	job, err := controller.GetJob(id)
+	if handleError(err, w) {
+		return
+	}
+
+	if job == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(job)
+	handleError(err, w)
+}
+
+// cancelJob cancels a running background job.
+func cancelJob(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	job, err := controller.GetJob(id)
+	if handleError(err, w) {
+		return
+	}
+
+	if job == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err = controller.CancelJob(id); err != nil {
+		log.Error().Err(err).Str("jobID", id).Msg("error cancelling job")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// retryJob retries the failed devices of a finished background job.
+func retryJob(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	job, err := controller.GetJob(id)
+	if handleError(err, w) {
+		return
+	}
+
+	if job == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	job, err = controller.RetryJob(id)
+	if err != nil {
+		log.Error().Err(err).Str("jobID", id).Msg("error retrying job")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJob(w, job)
+}
+
+// deleteJob deletes a finished background job.
+func deleteJob(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	job, err := controller.GetJob(id)
+	if handleError(err, w) {
+		return
+	}
+
+	if job == nil {
+		return
+	}
+
+	if !job.IsFinished() {
+		msg := "job cannot be deleted while it is running. cancel it first and try again."
+		log.Error().Str("jobID", id).Msg(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	err = storing.Jobs.Delete(id)
+	handleError(err, w)
+}
+
+// writeJob writes a job that is accepted for processing in the background to the response.
+func writeJob(w http.ResponseWriter, job *models.Job) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	err := json.NewEncoder(w).Encode(job)
+	if err != nil {
+		log.Error().Err(err).Str("jobID", job.ID).Msg("error writing job to response")
+	}
+}
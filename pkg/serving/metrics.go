@@ -3,6 +3,8 @@ package serving
 import (
 	"fmt"
 	"github.com/iot-for-all/starling/pkg/config"
+	"github.com/iot-for-all/starling/pkg/simulating"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
 	"net/http"
@@ -11,6 +13,7 @@ import (
 // StartMetrics starts serving metrics for prometheus server scrape.
 func StartMetrics(cfg *config.HTTPConfig) {
 	log.Info().Msgf("serving prometheus metrics at http://localhost:%d/metrics", cfg.MetricsPort)
-	http.Handle("/metrics", promhttp.Handler())
+	handler := promhttp.HandlerFor(simulating.Gatherer, promhttp.HandlerOpts{})
+	http.Handle("/metrics", promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, handler))
 	_ = http.ListenAndServe(fmt.Sprintf(":%d", cfg.MetricsPort), nil)
 }
@@ -11,7 +11,8 @@ import (
 )
 
 type exporter struct {
-	sim *models.Simulation
+	sim     *models.Simulation
+	billing *models.BillingEstimate // estimate of the messages billed for the runs of the simulation, if any.
 }
 
 func (e *exporter) exportSimulation() ([]byte, error) {
@@ -60,6 +61,7 @@ func (e *exporter) exportSimulation() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	e.exportBilling(&builder)
 
 	builder.WriteString("#####################################################################################\n")
 	builder.WriteString("## Configure number of devices for the simulation.\n")
@@ -128,8 +130,6 @@ func (e *exporter) exportModelBinding(builder *strings.Builder, targetId string,
 	builder.WriteString("## can be created in simulations.\n")
 	builder.WriteString("## You can add multiple device models in the same models array.\n")
 	builder.WriteString("##\n")
-	builder.WriteString("## NOTE: You need to add this model to IoT Central application yourself\n")
-	builder.WriteString("##       before the simulation is started.\n")
 	builder.WriteString(fmt.Sprintf("curl --location --request PUT \"$BASE_URL/target/%s/models\" \\\n", targetId))
 	builder.WriteString("--header 'Content-Type: application/json' \\\n")
 	builder.WriteString("--data-raw '\n")
@@ -139,6 +139,21 @@ func (e *exporter) exportModelBinding(builder *strings.Builder, targetId string,
 	}
 	builder.Write(content)
 	builder.WriteString("'\n\n")
+
+	builder.WriteString("#####################################################################################\n")
+	builder.WriteString("## Publish the device models to IoT Central application as device templates.\n")
+	builder.WriteString("## Existing device templates with differences are only updated with overwrite set.\n")
+	for _, modelName := range modelNames {
+		builder.WriteString(fmt.Sprintf("curl --location --request POST \"$BASE_URL/model/%s/publish\" \\\n", modelName))
+		builder.WriteString("--header 'Content-Type: application/json' \\\n")
+		builder.WriteString("--data-raw '\n")
+		content, err := e.marshallToJson(models.ModelPublishRequest{TargetID: targetId})
+		if err != nil {
+			return err
+		}
+		builder.Write(content)
+		builder.WriteString("'\n\n")
+	}
 	return nil
 }
 
@@ -165,6 +180,23 @@ func (e *exporter) exportSimulationDetails(builder *strings.Builder, simulation
 	return nil
 }
 
+// exportBilling reports the estimate of the IoT Central messages billed for the runs of the simulation as comments.
+func (e *exporter) exportBilling(builder *strings.Builder) {
+	if e.billing == nil || e.billing.Messages == 0 {
+		return
+	}
+
+	builder.WriteString("#####################################################################################\n")
+	builder.WriteString("## Billing estimate of the simulation when it was exported.\n")
+	builder.WriteString(fmt.Sprintf("## %.0f messages sent in %.0f billable message units of 4 KB, %.2f units per message.\n", e.billing.Messages, e.billing.MessageUnits, e.billing.UnitsPerMessage))
+	builder.WriteString(fmt.Sprintf("## At the rate of the last five minutes: %.0f units per day, %.0f units per month, %.0f units per device and month.\n",
+		e.billing.ProjectedDaily, e.billing.ProjectedMonthly, e.billing.ProjectedDeviceMonthly))
+	for _, warning := range e.billing.Warnings {
+		builder.WriteString(fmt.Sprintf("## Warning: %s.\n", warning))
+	}
+	builder.WriteString("\n")
+}
+
 func (e *exporter) exportSimulationDeviceConfig(builder *strings.Builder, simulation *models.Simulation, deviceConfig *models.SimulationDeviceConfig) error {
 	builder.WriteString(fmt.Sprintf("## Setup %d %s devices in simulation %s\n", deviceConfig.DeviceCount, deviceConfig.ModelID, simulation.Name))
 	builder.WriteString(fmt.Sprintf("curl --location --request PUT \"$BASE_URL/simulation/%s/deviceConfig\" \\\n", simulation.ID))
@@ -4,13 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/iot-for-all/starling/pkg/consuming"
 	"github.com/iot-for-all/starling/pkg/models"
+	"github.com/iot-for-all/starling/pkg/simulating"
 	"github.com/iot-for-all/starling/pkg/storing"
 	"github.com/rs/zerolog/log"
 	"io/ioutil"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 )
 
@@ -75,9 +76,15 @@ func upsertSimulation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err = sim.ValidateLabels(); err != nil {
+		log.Error().Err(err).Msg("invalid simulation labels")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	sim.Status = models.SimulationStatusReady
 	sim.LastUpdatedTime = time.Now()
-	err = storing.Simulations.Set(&sim)
+	err = storing.Simulations.Save(&sim, nil)
 	if handleError(err, w) {
 		return
 	}
@@ -89,11 +96,25 @@ func upsertSimulation(w http.ResponseWriter, r *http.Request) {
 
 // deleteSimulation deletes an existing simulation.
 func deleteSimulation(w http.ResponseWriter, r *http.Request) {
-	// TODO: Simulation cannot be deleted when running.
 	vars := mux.Vars(r)
 	id := vars["id"]
-	err := storing.Simulations.Delete(id)
-	handleError(err, w)
+	sim, err := storing.Simulations.Get(id)
+	if handleError(err, w) {
+		return
+	}
+
+	if sim != nil && sim.Status != models.SimulationStatusReady {
+		msg := fmt.Sprintf("Simulation cannot be deleted while it is in '%s' status.", sim.Status)
+		log.Error().Msg(msg)
+		http.Error(w, msg, http.StatusConflict)
+		return
+	}
+
+	err = storing.Simulations.Delete(id, cascadeRequested(r))
+	if handleError(err, w) {
+		return
+	}
+	simulating.DeleteMetrics(id)
 }
 
 // startSimulation starts an existing simulation.
@@ -130,164 +151,182 @@ func stopSimulation(w http.ResponseWriter, r *http.Request) {
 	handleError(err, w)
 }
 
-// provisionDevices provisions devices in a target based on the device configs from the given start index
+// provisionDevices provisions more devices of a model for the simulation in a background job.
 func provisionDevices(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	simID := vars["id"]
 	modelID := vars["modelId"]
 	numDevices, _ := strconv.Atoi(vars["numDevices"])
 	if numDevices < 1 {
 		return
 	}
 
-	sim, err := storing.Simulations.Get(simID)
-	if handleError(err, w) {
+	sim, target, ok := simulationForDevices(w, r)
+	if !ok {
 		return
 	}
 
-	if sim.Status != models.SimulationStatusReady {
-		msg := fmt.Sprintf("Devices cannot be provisioned while it is in status '%s'.", sim.Status)
-		log.Error().Msg(msg)
-		http.Error(w, msg, http.StatusBadRequest)
+	existing, err := storing.TargetDevices.ListByModel(target.ID, sim.ID, modelID)
+	if handleError(err, w) {
 		return
 	}
 
-	target, err := storing.Targets.Get(sim.TargetID)
+	deviceConfigs := []models.SimulationViewDeviceConfig{{ModelID: modelID, ProvisionedCount: len(existing) + numDevices}}
+	job, err := controller.StartProvisionJob(sim, target, deviceConfigs)
 	if handleError(err, w) {
 		return
 	}
 
-	model, err := storing.DeviceModels.Get(modelID)
-	if handleError(err, w) {
+	writeJob(w, job)
+}
+
+// deleteAllDevices deletes all the devices of the simulation from the target and local cache in a background job.
+func deleteAllDevices(w http.ResponseWriter, r *http.Request) {
+	sim, target, ok := simulationForDevices(w, r)
+	if !ok {
 		return
 	}
 
-	targetDevices, err := storing.TargetDevices.List(target.ID)
+	job, err := controller.StartDeleteDevicesJob(sim, target, "", 0)
 	if handleError(err, w) {
 		return
 	}
 
-	maxDeviceID := 0
-	if targetDevices != nil {
-		// format SimID-TargetID-modelID-NNNN
-		prefix := fmt.Sprintf("%s-%s-%s-", sim.ID, target.ID, modelID)
-		length := len(prefix)
-		for _, d := range targetDevices {
-			if strings.Index(d.DeviceID, prefix) == 0 {
-				idStr := d.DeviceID[length:]
-				did, _ := strconv.Atoi(idStr)
-				if maxDeviceID < did {
-					maxDeviceID = did
-				}
-			}
-		}
-	}
-
-	// update sim status to provisioning
-	if err := updateSimulationStatus(sim, models.SimulationStatusProvisioning); err != nil {
-		if handleError(err, w) {
-			return
-		}
-	}
-
-	if err := controller.ProvisionDevices(r.Context(), sim, target, model, maxDeviceID, numDevices); err != nil {
-		if err2 := updateSimulationStatus(sim, models.SimulationStatusReady); err2 != nil {
-			if handleError(err2, w) {
-				return
-			}
-		}
-		if handleError(err, w) {
-			return
-		}
-	}
-
-	// update sim status to ready
-	if err := updateSimulationStatus(sim, models.SimulationStatusReady); err != nil {
-		if handleError(err, w) {
-			return
-		}
-	}
+	writeJob(w, job)
 }
 
-// deleteAllDevices deletes all the devices from the target and local cache
-func deleteAllDevices(w http.ResponseWriter, r *http.Request) {
+// deleteDevices deletes the newest devices of a model from the target and local cache in a background job.
+func deleteDevices(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	simID := vars["id"]
+	modelID := vars["modelId"]
+	numDevices, _ := strconv.Atoi(vars["numDevices"])
+	if numDevices < 1 {
+		return
+	}
+
+	sim, target, ok := simulationForDevices(w, r)
+	if !ok {
+		return
+	}
 
-	sim, err := storing.Simulations.Get(simID)
+	job, err := controller.StartDeleteDevicesJob(sim, target, modelID, numDevices)
 	if handleError(err, w) {
 		return
 	}
 
+	writeJob(w, job)
+}
+
+// simulationForDevices gets the simulation of a request and its target, making sure that the simulation is ready for
+// provisioning or deleting devices.
+func simulationForDevices(w http.ResponseWriter, r *http.Request) (*models.Simulation, *models.SimulationTarget, bool) {
+	vars := mux.Vars(r)
+	sim, err := storing.Simulations.Get(vars["id"])
+	if handleError(err, w) {
+		return nil, nil, false
+	}
+
+	if sim == nil {
+		http.NotFound(w, r)
+		return nil, nil, false
+	}
+
+	if sim.Status != models.SimulationStatusReady {
+		msg := fmt.Sprintf("Devices cannot be changed while the simulation is in status '%s'.", sim.Status)
+		log.Error().Msg(msg)
+		http.Error(w, msg, http.StatusConflict)
+		return nil, nil, false
+	}
+
 	target, err := storing.Targets.Get(sim.TargetID)
 	if handleError(err, w) {
-		return
+		return nil, nil, false
 	}
 
-	if err := controller.DeleteAllDevices(r.Context(), sim, target); err != nil {
-		if handleError(err, w) {
-			return
-		}
+	if target == nil {
+		http.NotFound(w, r)
+		return nil, nil, false
 	}
+
+	return sim, target, true
 }
 
-// deleteDevices deletes the devices from the target and local cache based on the device configs from the given start index
-func deleteDevices(w http.ResponseWriter, r *http.Request) {
+// getSimulationMetrics summarizes the throughput, errors and latencies of a simulation.
+func getSimulationMetrics(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	simID := vars["id"]
-	modelID := vars["modelId"]
-	numDevices, _ := strconv.Atoi(vars["numDevices"])
-	if numDevices < 1 {
+	id := vars["id"]
+	sim, err := storing.Simulations.Get(id)
+	if handleError(err, w) {
 		return
 	}
 
-	sim, err := storing.Simulations.Get(simID)
-	if handleError(err, w) {
+	if sim == nil {
+		http.NotFound(w, r)
 		return
 	}
 
-	target, err := storing.Targets.Get(sim.TargetID)
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(controller.GetSimulationMetrics(sim))
+	handleError(err, w)
+}
+
+// listSequenceReports lists the lost and duplicated telemetry of the devices of a simulation.
+func listSequenceReports(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	sim, err := storing.Simulations.Get(id)
 	if handleError(err, w) {
 		return
 	}
 
-	model, err := storing.DeviceModels.Get(modelID)
-	if handleError(err, w) {
+	if sim == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(consuming.SequenceReports(id))
+	handleError(err, w)
+}
+
+// getSequenceReport gets the lost and duplicated telemetry of a device of a simulation.
+func getSequenceReport(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	deviceID := vars["deviceId"]
+
+	reports := consuming.SequenceReport(id, deviceID)
+	if reports == nil {
+		http.NotFound(w, r)
 		return
 	}
 
-	targetDevices, err := storing.TargetDevices.List(target.ID)
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(reports)
+	handleError(err, w)
+}
+
+// getDeviceEvents lists the recent lifecycle events of a device of a simulation.
+func getDeviceEvents(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	deviceID := vars["deviceId"]
+	sim, err := storing.Simulations.Get(id)
 	if handleError(err, w) {
 		return
 	}
 
-	maxDeviceID := 0
-	if targetDevices != nil {
-		// format SimID-TargetID-modelID-NNNN
-		prefix := fmt.Sprintf("%s-%s-%s-", sim.ID, target.ID, modelID)
-		length := len(prefix)
-		for _, d := range targetDevices {
-			if strings.Index(d.DeviceID, prefix) == 0 {
-				idStr := d.DeviceID[length:]
-				did, _ := strconv.Atoi(idStr)
-				if maxDeviceID < did {
-					maxDeviceID = did
-				}
-			}
-		}
+	if sim == nil {
+		http.NotFound(w, r)
+		return
 	}
 
-	if err := controller.DeleteDevices(r.Context(), sim, target, model, maxDeviceID, numDevices); err != nil {
-		if handleError(err, w) {
-			return
-		}
+	events := controller.GetDeviceEvents(sim, deviceID)
+	if events == nil {
+		http.NotFound(w, r)
+		return
 	}
-}
-func updateSimulationStatus(simulation *models.Simulation, status models.SimulationStatus) error {
-	// update the status of simulation
-	simulation.Status = status
-	simulation.LastUpdatedTime = time.Now()
 
-	err := storing.Simulations.Set(simulation)
-	return err
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(events)
+	handleError(err, w)
 }
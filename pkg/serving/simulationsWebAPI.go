@@ -1,16 +1,15 @@
 package serving
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/iot-for-all/starling/pkg/eventing"
 	"github.com/iot-for-all/starling/pkg/models"
 	"github.com/iot-for-all/starling/pkg/storing"
 	"github.com/rs/zerolog/log"
 	"io/ioutil"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 )
@@ -39,6 +38,8 @@ func webAPIListSimulations(w http.ResponseWriter, r *http.Request) {
 			deviceViews[i].ID = config.ID
 			deviceViews[i].ModelID = config.ModelID
 			deviceViews[i].SimulatedCount = config.DeviceCount
+			deviceViews[i].IDTemplate = config.IDTemplate
+			deviceViews[i].DeviceIDs = config.DeviceIDs
 			provisionedCount, err := getProvisionedDeviceCount(sim.ID, sim.TargetID, config.ModelID)
 			if handleError(err, w) {
 				return
@@ -110,6 +111,8 @@ func webAPIGetSimulation(w http.ResponseWriter, r *http.Request) {
 		deviceViews[i].ID = config.ID
 		deviceViews[i].ModelID = config.ModelID
 		deviceViews[i].SimulatedCount = config.DeviceCount
+		deviceViews[i].IDTemplate = config.IDTemplate
+		deviceViews[i].DeviceIDs = config.DeviceIDs
 		provisionedCount, err := getProvisionedDeviceCount(sim.ID, sim.TargetID, config.ModelID)
 		if handleError(err, w) {
 			return
@@ -141,8 +144,10 @@ func webAPIGetSimulation(w http.ResponseWriter, r *http.Request) {
 	}
 
 	simView := models.SimulationView{
-		Simulation: *sim,
-		Devices:    deviceViews,
+		Simulation:           *sim,
+		Devices:              deviceViews,
+		ProvisioningFailures: controller.GetProvisioningFailures(sim),
+		Billing:              controller.GetBillingEstimate(sim),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -151,20 +156,12 @@ func webAPIGetSimulation(w http.ResponseWriter, r *http.Request) {
 }
 
 func getProvisionedDeviceCount(simID string, targetID string, modelID string) (int, error) {
-	targetDevices, err := storing.TargetDevices.List(targetID)
+	targetDevices, err := storing.TargetDevices.ListByModel(targetID, simID, modelID)
 	if err != nil {
 		return 0, err
 	}
 
-	prefix := fmt.Sprintf("%s-%s-%s-", simID, targetID, modelID)
-	numProvisioned := 0
-	for _, d := range targetDevices {
-		if strings.Index(d.DeviceID, prefix) == 0 {
-			numProvisioned++
-		}
-	}
-
-	return numProvisioned, nil
+	return len(targetDevices), nil
 }
 
 // webAPIAddSimulation add a new simulation.
@@ -201,29 +198,29 @@ func webAPIAddSimulation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	deviceConfigs, err := deviceConfigsFromView(&simView)
+	if err != nil {
+		log.Error().Err(err).Msg("invalid device configuration")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = simView.ValidateLabels(); err != nil {
+		log.Error().Err(err).Msg("invalid simulation labels")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// reset status
 	simView.Simulation.Status = models.SimulationStatusReady
 	simView.Simulation.LastUpdatedTime = time.Now()
 
-	// save simulation
-	err = storing.Simulations.Set(&simView.Simulation)
+	// save simulation along with its device configs
+	err = storing.Simulations.Save(&simView.Simulation, deviceConfigs)
 	if handleError(err, w) {
 		return
 	}
 
-	// save new simulation device configs
-	for _, simViewDeviceConfig := range simView.Devices {
-		dc := &models.SimulationDeviceConfig{
-			ID:          simViewDeviceConfig.ID,
-			ModelID:     simViewDeviceConfig.ModelID,
-			DeviceCount: simViewDeviceConfig.SimulatedCount,
-		}
-		err = storing.DeviceConfigs.Set(simView.ID, dc)
-		if handleError(err, w) {
-			return
-		}
-	}
-
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(&simView)
 	handleError(err, w)
@@ -255,43 +252,51 @@ func webAPIUpdateSimulation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// update lastUpdatedDate
-	simView.Simulation.LastUpdatedTime = time.Now()
+	deviceConfigs, err := deviceConfigsFromView(&simView)
+	if err != nil {
+		log.Error().Err(err).Msg("invalid device configuration")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// update simulation
-	err = storing.Simulations.Set(&simView.Simulation)
-	if handleError(err, w) {
+	if err = simView.ValidateLabels(); err != nil {
+		log.Error().Err(err).Msg("invalid simulation labels")
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// delete old simulation device configs
-	deviceConfigs, err := storing.DeviceConfigs.List(simView.ID)
+	// update lastUpdatedDate
+	simView.Simulation.LastUpdatedTime = time.Now()
+
+	// update simulation and replace its device configs
+	err = storing.Simulations.Save(&simView.Simulation, deviceConfigs)
 	if handleError(err, w) {
 		return
 	}
-	for _, dc := range deviceConfigs {
-		err := storing.DeviceConfigs.Delete(simView.ID, dc.ID)
-		if handleError(err, w) {
-			return
-		}
-	}
 
-	// add new simulation device configs
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(&simView)
+	handleError(err, w)
+}
+
+// deviceConfigsFromView gets the device configs of a simulation view and makes sure that they generate valid device ids.
+func deviceConfigsFromView(simView *models.SimulationView) ([]*models.SimulationDeviceConfig, error) {
+	deviceConfigs := make([]*models.SimulationDeviceConfig, 0, len(simView.Devices))
 	for _, simViewDeviceConfig := range simView.Devices {
 		dc := &models.SimulationDeviceConfig{
 			ID:          simViewDeviceConfig.ID,
 			ModelID:     simViewDeviceConfig.ModelID,
 			DeviceCount: simViewDeviceConfig.SimulatedCount,
+			IDTemplate:  simViewDeviceConfig.IDTemplate,
+			DeviceIDs:   simViewDeviceConfig.DeviceIDs,
 		}
-		err = storing.DeviceConfigs.Set(simView.ID, dc)
-		if handleError(err, w) {
-			return
+		if err := dc.ValidateDeviceIDs(); err != nil {
+			return nil, err
 		}
+		deviceConfigs = append(deviceConfigs, dc)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(&simView)
-	handleError(err, w)
+	return deviceConfigs, nil
 }
 
 // webAPIDeleteSimulation deletes an existing simulation.
@@ -304,11 +309,16 @@ func webAPIDeleteSimulation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if sim == nil {
+		http.NotFound(w, r)
+		return
+	}
+
 	// Simulation cannot be deleted when running.
 	if sim.Status != models.SimulationStatusReady {
 		msg := fmt.Sprintf("Simulation cannot be deleted while it is in '%s' status.", sim.Status)
 		log.Error().Msg(msg)
-		http.Error(w, msg, http.StatusBadRequest)
+		http.Error(w, msg, http.StatusConflict)
 		return
 	}
 
@@ -317,18 +327,13 @@ func webAPIDeleteSimulation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sim.Status = models.SimulationStatusDeleting
-	if err := storing.Simulations.Set(sim); err != nil {
-		log.Error().Err(err).Str("simID", sim.ID).Msg("error updating simulation to deleting status")
+	// de-provision and delete all target devices for this simulation in background
+	job, err := controller.StartDeleteSimulationJob(sim, target)
+	if handleError(err, w) {
 		return
 	}
 
-	log.Debug().Msg("starting parallel delete")
-	// de-provision and delete all target devices for this simulation in background
-	go deleteSimulationInternal(sim, target)
-	log.Debug().Msg("returning response")
-
-	w.Write([]byte("simulation is getting deleted in background"))
+	writeJob(w, job)
 }
 
 // webAPIStartSimulation starts an existing simulation.
@@ -380,8 +385,10 @@ func webAPIStopSimulation(w http.ResponseWriter, r *http.Request) {
 
 // webAPIProvisionDevices provisions devices in a target based on the device configs from the given start index
 func webAPIProvisionDevices(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	simID := vars["id"]
+	sim, target, ok := simulationForDevices(w, r)
+	if !ok {
+		return
+	}
 
 	req, err := ioutil.ReadAll(r.Body)
 	if handleError(err, w) {
@@ -394,27 +401,13 @@ func webAPIProvisionDevices(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sim, err := storing.Simulations.Get(simID)
-	if handleError(err, w) {
-		return
-	}
-
-	if sim.Status != models.SimulationStatusReady {
-		msg := fmt.Sprintf("Devices cannot be provisioned while the simulation is in '%s' status.", sim.Status)
-		log.Error().Msg(msg)
-		http.Error(w, msg, http.StatusBadRequest)
-		return
-	}
-
-	target, err := storing.Targets.Get(sim.TargetID)
+	// kick off device provisioning in the background
+	job, err := controller.StartProvisionJob(sim, target, simViewDeviceConfigs)
 	if handleError(err, w) {
 		return
 	}
 
-	// kick off device provisioning in the background
-	go provisionDevicesInternal(sim, target, simViewDeviceConfigs)
-
-	w.Write([]byte("device provisioning started in background"))
+	writeJob(w, job)
 }
 
 // webAPIExportSimulation export the simulation as a shell script
@@ -434,8 +427,9 @@ func webAPIExportSimulation(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/x-sh")
 	w.Header().Set("Content-Disposition", "filename=loadData-"+sim.ID+".sh")
 
+	billing := controller.GetBillingEstimate(sim)
 	sim.Status = models.SimulationStatusReady
-	exporter := exporter{sim: sim}
+	exporter := exporter{sim: sim, billing: billing}
 	exportFileContent, err := exporter.exportSimulation()
 	if handleError(err, w) {
 		return
@@ -445,138 +439,78 @@ func webAPIExportSimulation(w http.ResponseWriter, r *http.Request) {
 	handleError(err, w)
 }
 
-func deleteSimulationInternal(sim *models.Simulation, target *models.SimulationTarget) {
-	ctx := context.Background()
-	if err := controller.DeleteAllDevices(ctx, sim, target); err != nil {
-		log.Error().Err(err).Str("simID", sim.ID).Msg("error deleting all devices")
+// webAPISimulationEvents streams the status, provisioning progress and device activity of a simulation as server-sent events
+func webAPISimulationEvents(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	simID := vars["id"]
 
-		sim.Status = models.SimulationStatusReady
-		if err := storing.Simulations.Set(sim); err != nil {
-			log.Error().Err(err).Str("simID", sim.ID).Msg("error updating simulation to ready status")
-			return
-		}
+	sim, err := storing.Simulations.Get(simID)
+	if handleError(err, w) {
 		return
 	}
-
-	// delete all device config
-	deviceConfigs, err := storing.DeviceConfigs.List(sim.ID)
-	if err != nil {
-		log.Error().Err(err).Str("simID", sim.ID).Msg("error deleting all devices that belong to simulation")
-		sim.Status = models.SimulationStatusReady
-		if err := storing.Simulations.Set(sim); err != nil {
-			log.Error().Err(err).Str("simID", sim.ID).Msg("error updating simulation to ready status")
-			return
-		}
+	if sim == nil {
+		http.NotFound(w, r)
 		return
 	}
 
-	for _, dc := range deviceConfigs {
-		err = storing.DeviceConfigs.Delete(sim.ID, dc.ID)
-		if err != nil {
-			log.Error().Err(err).Str("simID", sim.ID).Msg("error deleting device configs that belong to simulation")
-			sim.Status = models.SimulationStatusReady
-			if err := storing.Simulations.Set(sim); err != nil {
-				log.Error().Err(err).Str("simID", sim.ID).Msg("error updating simulation to ready status")
-				return
-			}
-			return
-		}
-	}
-
-	// delete simulation
-	err = storing.Simulations.Delete(sim.ID)
-	if err != nil {
-		log.Error().Err(err).Str("simID", sim.ID).Msg("error deleting simulation")
-		sim.Status = models.SimulationStatusReady
-		if err := storing.Simulations.Set(sim); err != nil {
-			log.Error().Err(err).Str("simID", sim.ID).Msg("error updating simulation to ready status")
-			return
-		}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
 		return
 	}
-	log.Debug().Str("simID", sim.ID).Msg("deleted simulation")
-}
 
-func provisionDevicesInternal(sim *models.Simulation, target *models.SimulationTarget, simViewDeviceConfigs []models.SimulationViewDeviceConfig) {
-	ctx := context.Background()
+	sub := eventing.Subscribe(simID)
+	defer sub.Close()
 
-	sim.Status = models.SimulationStatusProvisioning
-	if err := storing.Simulations.Set(sim); err != nil {
-		log.Error().Err(err).Str("simID", sim.ID).Msg("error updating simulation to provisioning status")
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	// start the stream with the current status of the simulation
+	if err := writeSimulationEvent(w, &models.SimulationEvent{
+		SimulationID: sim.ID,
+		Type:         models.SimulationEventStatus,
+		Time:         sim.LastUpdatedTime,
+		Status:       sim.Status,
+	}); err != nil {
 		return
 	}
+	flusher.Flush()
 
-	for _, svdc := range simViewDeviceConfigs {
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
 
-		model, err := storing.DeviceModels.Get(svdc.ModelID)
-		if err != nil {
-			log.Error().Err(err).Str("simID", sim.ID).Str("model", svdc.ModelID).Msg("error provisioning devices, could not find model")
-
-			sim.Status = models.SimulationStatusReady
-			if err := storing.Simulations.Set(sim); err != nil {
-				log.Error().Err(err).Str("simID", sim.ID).Msg("error updating simulation to ready status")
-			}
-			return
-		}
-
-		targetDevices, err := storing.TargetDevices.List(target.ID)
-		if err != nil {
-			log.Error().Err(err).Str("simID", sim.ID).Str("target", target.ID).Msg("error provisioning devices, could not find target devices")
-			sim.Status = models.SimulationStatusReady
-			if err := storing.Simulations.Set(sim); err != nil {
-				log.Error().Err(err).Str("simID", sim.ID).Msg("error updating simulation to ready status")
-			}
+	for {
+		select {
+		case <-r.Context().Done():
 			return
-		}
-
-		numDevicesRequested := svdc.ProvisionedCount
-
-		// get the maximum device ID for this model
-		maxDeviceID := 0
-		numDevicesExisting := 0
-		if targetDevices != nil {
-			// format SimID-TargetID-modelID-NNNN
-			prefix := fmt.Sprintf("%s-%s-%s-", sim.ID, target.ID, svdc.ModelID)
-			length := len(prefix)
-			for _, d := range targetDevices {
-				if strings.Index(d.DeviceID, prefix) == 0 {
-					idStr := d.DeviceID[length:]
-					did, _ := strconv.Atoi(idStr)
-					if maxDeviceID < did {
-						maxDeviceID = did
-					}
-					numDevicesExisting++
-				}
+		case <-keepAlive.C:
+			if _, err := w.Write([]byte(": keep-alive\n\n")); err != nil {
+				return
 			}
-		}
-
-		if numDevicesRequested > numDevicesExisting {
-			// overall more devices are requested, so provision the difference
-			numDevicesToProvision := numDevicesRequested - numDevicesExisting
-			if err := controller.ProvisionDevices(ctx, sim, target, model, maxDeviceID, numDevicesToProvision); err != nil {
-				log.Error().Err(err).Str("simID", sim.ID).Str("target", target.ID).Int("numDevicesExisting", numDevicesExisting).
-					Int("numDevicesRequested", numDevicesRequested).Str("model", model.ID).Msg("error provisioning devices")
+			flusher.Flush()
+		case event, ok := <-sub.C():
+			if !ok {
+				return
 			}
-		} else if numDevicesRequested < numDevicesExisting {
-			// overall less devices are requested, so delete the excess devices
-			numDevicesToDelete := numDevicesExisting - numDevicesRequested
-			if err := controller.DeleteDevices(ctx, sim, target, model, maxDeviceID, numDevicesToDelete); err != nil {
-				log.Error().Err(err).Str("simID", sim.ID).Str("target", target.ID).Int("numDevicesExisting", numDevicesExisting).
-					Int("numDevicesRequested", numDevicesRequested).Str("model", model.ID).Msg("error deleting devices")
+			if err := writeSimulationEvent(w, event); err != nil {
+				log.Debug().Err(err).Str("simID", simID).Msg("error writing simulation event, closing the stream")
+				return
 			}
-		} else {
-			// old and new counts are same, ignore the request for this model
-			log.Debug().Str("simID", sim.ID).Str("target", target.ID).
-				Str("model", model.ID).Int("numDevicesExisting", numDevicesExisting).
-				Int("numDevicesRequested", numDevicesRequested).Msg("ignoring provision devices as there is nothing to do")
+			flusher.Flush()
 		}
 	}
+}
 
-	sim.Status = models.SimulationStatusReady
-	if err := storing.Simulations.Set(sim); err != nil {
-		log.Error().Err(err).Str("simID", sim.ID).Msg("error updating simulation to ready status")
-		return
+// writeSimulationEvent writes the event in the server-sent events format
+func writeSimulationEvent(w http.ResponseWriter, event *models.SimulationEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
 	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
 }
 
 func generateSimulationID(name string) (string, error) {
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"github.com/gorilla/mux"
 	"github.com/iot-for-all/starling/pkg/models"
+	"github.com/iot-for-all/starling/pkg/simulating"
 	"github.com/iot-for-all/starling/pkg/storing"
+	"github.com/rs/zerolog/log"
 	"io/ioutil"
 	"net/http"
 )
@@ -177,13 +179,14 @@ func upsertTargetDevice(w http.ResponseWriter, r *http.Request) {
 func deleteTarget(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
-	err := storing.Targets.Delete(id)
+	simIDs, err := storing.Targets.Delete(id, cascadeRequested(r))
 	if handleError(err, w) {
 		return
 	}
 
-	err = storing.TargetModels.Delete(id)
-	handleError(err, w)
+	for _, simID := range simIDs {
+		simulating.DeleteMetrics(simID)
+	}
 }
 
 // deleteTargetModels deletes existing target models
@@ -210,3 +213,146 @@ func deleteAllTargetDevices(w http.ResponseWriter, r *http.Request) {
 	err := storing.TargetDevices.DeleteAll(id)
 	handleError(err, w)
 }
+
+// reconcileTarget compares the local device cache of a target with the devices in its IoT Central application.
+func reconcileTarget(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	t, err := storing.Targets.Get(id)
+	if handleError(err, w) {
+		return
+	}
+
+	if t == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	report, err := controller.ReconcileTarget(r.Context(), t)
+	if handleError(err, w) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(report)
+	handleError(err, w)
+}
+
+// fixTarget resolves the differences between the local device cache of a target and its IoT Central application.
+func fixTarget(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	t, err := storing.Targets.Get(id)
+	if handleError(err, w) {
+		return
+	}
+
+	if t == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	req, err := ioutil.ReadAll(r.Body)
+	if handleError(err, w) {
+		return
+	}
+
+	var fix models.ReconcileFixRequest
+	err = json.Unmarshal(req, &fix)
+	if handleError(err, w) {
+		return
+	}
+
+	if err = fix.Validate(); err != nil {
+		log.Error().Err(err).Str("targetID", id).Msg("invalid reconcile request")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := controller.FixTarget(r.Context(), t, &fix)
+	if handleError(err, w) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(result)
+	handleError(err, w)
+}
+
+// previewTargetCleanup lists the orphaned devices that would be deleted from the target.
+func previewTargetCleanup(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	t, err := storing.Targets.Get(id)
+	if handleError(err, w) {
+		return
+	}
+
+	if t == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	req := models.CleanupRequest{
+		Prefix:        query.Get("prefix"),
+		Pattern:       query.Get("pattern"),
+		IncludeActive: query.Get("includeActive") == "true",
+	}
+
+	if err = req.Validate(); err != nil {
+		log.Error().Err(err).Str("targetID", id).Msg("invalid cleanup request")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	preview, err := controller.PreviewCleanup(r.Context(), t, &req)
+	if handleError(err, w) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(preview)
+	handleError(err, w)
+}
+
+// cleanupTarget starts a background job that deletes the orphaned devices from the target.
+func cleanupTarget(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	t, err := storing.Targets.Get(id)
+	if handleError(err, w) {
+		return
+	}
+
+	if t == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if handleError(err, w) {
+		return
+	}
+
+	var req models.CleanupRequest
+	if len(body) > 0 {
+		err = json.Unmarshal(body, &req)
+		if handleError(err, w) {
+			return
+		}
+	}
+
+	if err = req.Validate(); err != nil {
+		log.Error().Err(err).Str("targetID", id).Msg("invalid cleanup request")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job, err := controller.StartCleanupJob(r.Context(), t, &req)
+	if handleError(err, w) {
+		return
+	}
+
+	writeJob(w, job)
+}
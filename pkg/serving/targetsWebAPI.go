@@ -76,11 +76,15 @@ func webAPIAddTarget(w http.ResponseWriter, r *http.Request) {
 	// download models and store them into database
 	if tv.ImportModels {
 		dtDownloader := NewDeviceTemplateDownloader(&t)
-		deviceModels, err := dtDownloader.DownloadModels()
+		deviceModels, result, err := dtDownloader.DownloadModels(nil)
 		if handleError(err, w) {
 			return
 		}
 
+		for _, skipped := range result.Skipped {
+			log.Warn().Str("templateID", skipped.TemplateID).Str("reason", skipped.Reason).Msg("skipped importing device template")
+		}
+
 		for _, dm := range deviceModels {
 			err := storing.DeviceModels.Set(dm)
 			if handleError(err, w) {
@@ -113,34 +117,38 @@ func webAPIUpdateTarget(w http.ResponseWriter, r *http.Request) {
 
 // webAPIDeleteTarget deletes an existing target
 func webAPIDeleteTarget(w http.ResponseWriter, r *http.Request) {
+	// simulations using the target make the delete fail unless cascaded
+	deleteTarget(w, r)
+}
+
+// webAPIListTargetTemplates lists the device templates of an existing target that can be imported as device models
+func webAPIListTargetTemplates(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	// check if there are any simulations using this target
-	sims, err := storing.Simulations.List()
+	target, err := storing.Targets.Get(id)
 	if handleError(err, w) {
 		return
 	}
 
-	for _, sim := range sims {
-		if sim.TargetID == id {
-			msg := fmt.Sprintf("application '%s' cannot be deleted as there are simulations using this model. Delete the simulation '%s' and try again.", id, sim.Name)
-			log.Error().Msg(msg)
-			http.Error(w, msg, http.StatusBadRequest)
-			return
-		}
+	if target == nil {
+		http.NotFound(w, r)
+		return
 	}
 
-	// delete model bindings with target
-	err = storing.TargetModels.Delete(id)
+	dtDownloader := NewDeviceTemplateDownloader(target)
+	items, err := dtDownloader.ListTemplates()
 	if handleError(err, w) {
 		return
 	}
 
-	deleteTarget(w, r)
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(items)
+	handleError(err, w)
 }
 
-// webAPIImportModelsFromTarget imports device models from an existing target
+// webAPIImportModelsFromTarget imports device models from an existing target.
+// The device templates to import can be selected by their DTMIs; all templates are imported otherwise.
 func webAPIImportModelsFromTarget(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
@@ -150,9 +158,27 @@ func webAPIImportModelsFromTarget(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if target == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	req, err := ioutil.ReadAll(r.Body)
+	if handleError(err, w) {
+		return
+	}
+
+	var importReq models.DeviceTemplateImportRequest
+	if len(req) > 0 {
+		err = json.Unmarshal(req, &importReq)
+		if handleError(err, w) {
+			return
+		}
+	}
+
 	// download device models from the application
 	dtDownloader := NewDeviceTemplateDownloader(target)
-	deviceModels, err := dtDownloader.DownloadModels()
+	deviceModels, result, err := dtDownloader.DownloadModels(importReq.Templates)
 	if handleError(err, w) {
 		return
 	}
@@ -164,6 +190,10 @@ func webAPIImportModelsFromTarget(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(result)
+	handleError(err, w)
 }
 
 func generateTargetID(name string) (string, error) {
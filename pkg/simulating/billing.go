@@ -0,0 +1,140 @@
+package simulating
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/iot-for-all/starling/pkg/eventing"
+	"github.com/iot-for-all/starling/pkg/models"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// messageUnitSize is the size of a billable IoT Central message unit in bytes.
+	messageUnitSize = 4 * 1024
+
+	// secondsPerDay and secondsPerMonth convert rates into daily and monthly projections.
+	secondsPerDay   = 24 * 60 * 60
+	secondsPerMonth = 30 * secondsPerDay
+
+	// budgetCheckSamples is the number of summary samples between checking the budget of a running simulation.
+	budgetCheckSamples = 12
+)
+
+// messageUnits returns the number of billable message units of a message of the given size.
+// Every message is billed as at least one unit.
+func messageUnits(size int) int {
+	if size <= 0 {
+		return 1
+	}
+
+	return (size + messageUnitSize - 1) / messageUnitSize
+}
+
+// propertyUnits returns the number of billable message units of a property update.
+func propertyUnits(properties interface{}) int {
+	raw, err := json.Marshal(properties)
+	if err != nil {
+		return 1
+	}
+
+	return messageUnits(len(raw))
+}
+
+// EstimateBilling estimates the IoT Central messages billed for a simulation from the summary of its metrics
+// and checks the projected usage against the budget of the simulation.
+func EstimateBilling(simulation *models.Simulation, summary *models.SimulationMetricsSummary) *models.BillingEstimate {
+	estimate := &models.BillingEstimate{Budget: simulation.MessageBudget}
+	for _, mm := range summary.Models {
+		estimate.Devices += mm.Devices
+		estimate.MessageUnits += mm.Totals["billableMessageUnits"]
+		estimate.Rate += mm.Rates["billableMessageUnits"]
+		for _, name := range []string{"telemetryMessagesSent", "reportedPropsSent", "twinUpdatesSent"} {
+			estimate.Messages += mm.Totals[name]
+		}
+	}
+
+	if estimate.Messages > 0 {
+		estimate.UnitsPerMessage = estimate.MessageUnits / estimate.Messages
+	}
+	estimate.ProjectedDaily = estimate.Rate * secondsPerDay
+	estimate.ProjectedMonthly = estimate.Rate * secondsPerMonth
+	if estimate.Devices > 0 {
+		estimate.ProjectedDeviceMonthly = estimate.ProjectedMonthly / estimate.Devices
+	}
+	estimate.Warnings = budgetWarnings(simulation.MessageBudget, estimate.ProjectedDaily, estimate.ProjectedMonthly, estimate.ProjectedDeviceMonthly)
+
+	return estimate
+}
+
+// budgetWarnings lists the limits of the budget exceeded by the projected usage.
+func budgetWarnings(budget *models.MessageBudget, daily float64, monthly float64, deviceMonthly float64) []string {
+	if budget == nil {
+		return nil
+	}
+
+	var warnings []string
+	if budget.Daily > 0 && daily > budget.Daily {
+		warnings = append(warnings, fmt.Sprintf("projected %.0f message units per day exceed the daily budget of %.0f", daily, budget.Daily))
+	}
+	if budget.Monthly > 0 && monthly > budget.Monthly {
+		warnings = append(warnings, fmt.Sprintf("projected %.0f message units per month exceed the monthly budget of %.0f", monthly, budget.Monthly))
+	}
+	if budget.DeviceMonthly > 0 && deviceMonthly > budget.DeviceMonthly {
+		warnings = append(warnings, fmt.Sprintf("projected %.0f message units per device and month exceed the device budget of %.0f", deviceMonthly, budget.DeviceMonthly))
+	}
+
+	return warnings
+}
+
+// checkPlannedBudget warns before the simulation starts if sending at its configured rates would exceed its budget.
+// Messages are assumed to fit into a single billable unit, so the actual usage may be higher.
+func (s *Simulator) checkPlannedBudget() {
+	if s.simulation.MessageBudget == nil {
+		return
+	}
+
+	devices := 0
+	rate := 0.0
+	for _, dc := range s.deviceConfigs {
+		devices += dc.DeviceCount
+		if s.config.EnableTelemetry && s.simulation.TelemetryInterval > 0 {
+			rate += float64(dc.DeviceCount*s.simulation.TelemetryBatchSize) / float64(s.simulation.TelemetryInterval)
+		}
+		if s.config.EnableReportedProps && s.simulation.ReportedPropsInterval > 0 {
+			rate += float64(dc.DeviceCount) / float64(s.simulation.ReportedPropsInterval)
+		}
+	}
+
+	deviceMonthly := 0.0
+	if devices > 0 {
+		deviceMonthly = rate * secondsPerMonth / float64(devices)
+	}
+	s.warnBudget(budgetWarnings(s.simulation.MessageBudget, rate*secondsPerDay, rate*secondsPerMonth, deviceMonthly), "planned")
+}
+
+// checkBudget warns once if the usage of the running simulation projected from its current rate exceeds its budget.
+// The summary pump calls it every budgetCheckSamples samples, once the rate covers the samples taken so far.
+func (s *Simulator) checkBudget() {
+	if s.simulation.MessageBudget == nil || s.budgetWarned {
+		return
+	}
+
+	estimate := EstimateBilling(s.simulation, Summary(s.simulation.ID))
+	if len(estimate.Warnings) > 0 {
+		s.budgetWarned = true
+		s.warnBudget(estimate.Warnings, "current")
+	}
+}
+
+// warnBudget logs the exceeded budget limits and publishes them to the simulation event subscribers.
+func (s *Simulator) warnBudget(warnings []string, basis string) {
+	for _, warning := range warnings {
+		log.Warn().Str("simID", s.simulation.ID).Str("basis", basis).Msg(warning)
+		eventing.Publish(&models.SimulationEvent{
+			SimulationID: s.simulation.ID,
+			Type:         models.SimulationEventBudget,
+			Message:      fmt.Sprintf("%s rate: %s", basis, warning),
+		})
+	}
+}
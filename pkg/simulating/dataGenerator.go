@@ -6,6 +6,7 @@ import (
 	"github.com/amenzhinsky/iothub/common"
 	"github.com/amenzhinsky/iothub/iotdevice"
 	"github.com/hashicorp/go-uuid"
+	"github.com/iot-for-all/starling/pkg/consuming"
 	"github.com/iot-for-all/starling/pkg/models"
 	"math/rand"
 	"strings"
@@ -66,12 +67,13 @@ func (d *DataGenerator) GenerateTelemetryMessage(device *device, creationTime ti
 	dataPointCount := 0
 	var body []byte
 	var err error
+	device.telemetrySequenceNumber++
+	sentTime := time.Now().UTC()
 	if device.simulation.TelemetryFormat == models.TelemetryFormatOpcua {
 		// OPCUA device sending JSON payload
 		msgGuid, _ := uuid.GenerateUUID()
 		payload := make(map[string]interface{})
 		msgList := make([]map[string]interface{}, 1)
-		device.telemetrySequenceNumber++
 		msgList[0] = map[string]interface{}{
 			"DataSetWriterId": fmt.Sprintf("%s-%s", device.deviceID, msgGuid),
 			"MetaDataVersion": map[string]interface{}{
@@ -111,6 +113,7 @@ func (d *DataGenerator) GenerateTelemetryMessage(device *device, creationTime ti
 				dataPointCount++
 			}
 		}
+		d.addVerificationFields(device, telemetryValues, sentTime)
 
 		body, err = json.Marshal(telemetryValues)
 		if err != nil {
@@ -125,6 +128,7 @@ func (d *DataGenerator) GenerateTelemetryMessage(device *device, creationTime ti
 				dataPointCount++
 			}
 		}
+		d.addVerificationFields(device, msg, sentTime)
 		body, err = json.Marshal(msg)
 		if err != nil {
 			return nil, err
@@ -144,12 +148,25 @@ func (d *DataGenerator) GenerateTelemetryMessage(device *device, creationTime ti
 		creationTimeUtc:    creationTime, // distribute the messages in the batch evenly
 		properties:         nil,
 		dataPointCount:     dataPointCount,
+		sequenceNumber:     device.telemetrySequenceNumber,
+		sentTime:           sentTime,
 	}
 	telemetryMessages[0] = &tm
 
 	return telemetryMessages, nil
 }
 
+// addVerificationFields embeds the sequence number and the send time into the telemetry message
+// so that its delivery can be verified by reading it back from IoT Central or its data export.
+func (d *DataGenerator) addVerificationFields(device *device, msg map[string]interface{}, sentTime time.Time) {
+	if device.simulation.VerifyDelivery == nil && !consuming.Enabled() {
+		return
+	}
+
+	msg[consuming.SequenceField] = device.telemetrySequenceNumber
+	msg[consuming.SentTimeField] = sentTime.Format(time.RFC3339Nano)
+}
+
 // GenerateReportedProperties generate reported property update based on the device capability model.
 func (d *DataGenerator) GenerateReportedProperties(device *device) (iotdevice.TwinState, error) {
 	reportedProps := make(iotdevice.TwinState)
@@ -0,0 +1,139 @@
+package simulating
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/amenzhinsky/iothub/iotdevice"
+)
+
+// commandTimeKeys are the payload fields a command can carry the time it was sent in.
+var commandTimeKeys = []string{"timestamp", "sentTime", "time"}
+
+// observeDesiredDelivery measures the latency of a desired property update from the time it was sent, and counts
+// updates arriving with a version not newer than the last update.
+func (s *deviceSimulator) observeDesiredDelivery(device *device, desired iotdevice.TwinState, received time.Time) {
+	version := desired.Version()
+	if version > 0 {
+		if version <= device.desiredVersion {
+			twinVersionsOutOfOrderTotal.WithLabelValues(s.simulation.ID, s.simulation.TargetID, device.model.ID).Inc()
+		} else {
+			device.desiredVersion = version
+		}
+	}
+
+	if sent, ok := desiredSentTime(desired); ok {
+		observeDeliveryLatency(desiredPropsDeliveryLatency.WithLabelValues(s.simulation.ID, s.simulation.TargetID, device.model.ID), sent, received)
+	}
+}
+
+// observeCommandDelivery measures the latency of a command from the time embedded in its payload or, for
+// cloud-to-device messages, the time IoT Hub enqueued it.
+func (s *deviceSimulator) observeCommandDelivery(device *device, payload interface{}, enqueued *time.Time, received time.Time) {
+	sent, ok := commandSentTime(payload)
+	if !ok && enqueued != nil && !enqueued.IsZero() {
+		sent, ok = *enqueued, true
+	}
+
+	if ok {
+		observeDeliveryLatency(commandDeliveryLatency.WithLabelValues(s.simulation.ID, s.simulation.TargetID, device.model.ID), sent, received)
+	}
+}
+
+// observeDeliveryLatency records the time from sending until receiving, ignoring times in the future that
+// are caused by clock skew between Starling and IoT Central.
+func observeDeliveryLatency(observer interface{ Observe(float64) }, sent time.Time, received time.Time) {
+	if latency := received.Sub(sent); latency >= 0 {
+		observer.Observe(latency.Seconds())
+	}
+}
+
+// desiredSentTime returns when a desired property update was sent. IoT Hub leaves the metadata out of most updates
+// it sends to devices and devices cannot read it from their twin either, so without metadata the time is taken from
+// one of the commandTimeKeys of the updated values, e.g. {"setpoint": {"value": 21, "timestamp": "..."}}. Updates
+// carrying neither are not measured.
+func desiredSentTime(desired iotdevice.TwinState) (time.Time, bool) {
+	if updated, ok := desiredLastUpdated(desired); ok {
+		return updated, true
+	}
+
+	var latest time.Time
+	for name, value := range desired {
+		if strings.HasPrefix(name, "$") {
+			continue
+		}
+		if fields, ok := value.(map[string]interface{}); ok {
+			for _, key := range commandTimeKeys {
+				if sent, ok := parseTime(fields[key]); ok && sent.After(latest) {
+					latest = sent
+				}
+			}
+		}
+	}
+
+	return latest, !latest.IsZero()
+}
+
+// desiredLastUpdated returns when the desired properties were last updated according to their metadata,
+// using the latest update of a property if the metadata of the whole document is not included.
+func desiredLastUpdated(desired iotdevice.TwinState) (time.Time, bool) {
+	metadata, ok := desired["$metadata"].(map[string]interface{})
+	if !ok {
+		return time.Time{}, false
+	}
+	if updated, ok := parseTime(metadata["$lastUpdated"]); ok {
+		return updated, true
+	}
+
+	var latest time.Time
+	for name, value := range metadata {
+		if strings.HasPrefix(name, "$") {
+			continue
+		}
+		if property, ok := value.(map[string]interface{}); ok {
+			if updated, ok := parseTime(property["$lastUpdated"]); ok && updated.After(latest) {
+				latest = updated
+			}
+		}
+	}
+
+	return latest, !latest.IsZero()
+}
+
+// commandSentTime returns the time embedded in a command payload, either as the payload itself or as one
+// of the commandTimeKeys of a JSON object.
+func commandSentTime(payload interface{}) (time.Time, bool) {
+	if raw, ok := payload.([]byte); ok {
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			return time.Time{}, false
+		}
+	}
+
+	if fields, ok := payload.(map[string]interface{}); ok {
+		for _, key := range commandTimeKeys {
+			if sent, ok := parseTime(fields[key]); ok {
+				return sent, true
+			}
+		}
+		return time.Time{}, false
+	}
+
+	return parseTime(payload)
+}
+
+// parseTime parses an RFC 3339 timestamp or milliseconds since the epoch.
+func parseTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		return t, err == nil
+	case float64:
+		if v <= 0 {
+			return time.Time{}, false
+		}
+		return time.Unix(0, int64(v*float64(time.Millisecond))), true
+	}
+
+	return time.Time{}, false
+}
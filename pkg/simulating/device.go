@@ -5,10 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/iot-for-all/starling/pkg/config"
-	"reflect"
+	"github.com/iot-for-all/starling/pkg/consuming"
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/amenzhinsky/iothub/common"
@@ -17,14 +18,19 @@ import (
 	"github.com/amenzhinsky/iothub/logger"
 	"github.com/iot-for-all/starling/pkg/models"
 	"github.com/iot-for-all/starling/pkg/storing"
+	"github.com/iot-for-all/starling/pkg/tracing"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type (
 	// device represents the IoT Central device being simulated.
 	device struct {
 		deviceID                string                   // unique id of the device.
+		index                   int                      // 1 based index of the device within its device config.
 		model                   *models.DeviceModel      // model of the device.
 		target                  *models.SimulationTarget // target application of the device.
 		connectionString        string                   // IoT Hub connectionString of the device.
@@ -36,6 +42,7 @@ type (
 		iotHubClient            *iotdevice.Client        // IoT Hub connection MQTT client.
 		twinSub                 *iotdevice.TwinStateSub  // subscription to listen for twin updates.
 		c2dSub                  *iotdevice.EventSub      // subscription to listen for c2d commands
+		desiredVersion          int                      // version of the last desired property update received.
 		dataGenerator           *DataGenerator           // data generator used to generate telemetry and reported property updates.
 		retryCount              int                      // number of retries for sending telemetry
 		telemetrySequenceNumber int                      // monotonically increasing sequence number for telemetry
@@ -59,6 +66,17 @@ type (
 		reportedPropsRequests chan *reportedPropsRequest // input channel used for queuing up reported property requests.
 		provisioner           *DeviceProvisioner         // provisioner to provision devices using DPS
 		provisionThrottle     chan int                   // channel to apply device provisioning rate throttle
+		activity              deviceActivity             // device activity since the last simulation event was published
+		verifier              *deliveryVerifier          // verifier reading back telemetry from IoT Central, nil if disabled.
+		deviceMetrics         bool                       // report metrics per device.
+	}
+
+	// deviceActivity counts the connections, disconnections and errors of devices between two simulation events.
+	deviceActivity struct {
+		sync.Mutex
+		connects    int            // number of devices connected.
+		disconnects int            // number of devices disconnected.
+		errors      map[string]int // number of errors by error type.
 	}
 
 	// telemetryRequest represents the request to send telemetry by the device simulator.
@@ -80,6 +98,8 @@ type (
 		creationTimeUtc    time.Time         // time when the device generated telemetry.
 		properties         map[string]string // telemetry message headers sent by the device.
 		dataPointCount     int               // number of data points sent in the message
+		sequenceNumber     int               // sequence number of the message within the device.
+		sentTime           time.Time         // time when the message was generated for sending.
 	}
 
 	// telemetryBatch represents a batch of telemetry messages.
@@ -110,6 +130,7 @@ func newDeviceSimulator(ctx context.Context, config *config.SimulationConfig, si
 		reportedPropsRequests: make(chan *reportedPropsRequest, config.MaxConcurrentConnections), // only process so many concurrent reported property update send requests at a time
 		provisioner:           NewProvisioner(ctx, config),
 		provisionThrottle:     make(chan int, config.MaxConcurrentRegistrations), // only allow so many DPS registrations at a time
+		activity:              deviceActivity{errors: map[string]int{}},
 	}
 }
 
@@ -208,15 +229,28 @@ func (s *deviceSimulator) sendTelemetry(req *telemetryRequest) {
 	batch := s.getNextTelemetryBatch(req.device)
 	start := time.Now()
 
+	var span trace.Span
+	req.context, span = tracing.Start(req.device.context, "telemetryBatch", s.simulation.ID, s.simulation.TargetID, req.device.model.ID, req.device.deviceID)
+	span.SetAttributes(attribute.Int("starling.batchSize", len(batch.messages)))
+	defer span.End()
+
 	// send all messages in a batch in parallel.
 	wg := sync.WaitGroup{}
+	var sent int32
 	for _, msg := range batch.messages {
 		wg.Add(1)
-		go s.sendTelemetryMessage(msg, req, &wg)
+		go func(msg *telemetryMessage) {
+			if s.sendTelemetryMessage(msg, req, &wg) {
+				atomic.AddInt32(&sent, 1)
+			}
+		}(msg)
 	}
 
 	// wait till all messages in the batch are sent.
 	wg.Wait()
+	if sent > 0 {
+		s.recordEvent(req.device, models.DeviceEvent{Type: models.DeviceEventTelemetrySent, Count: int(sent)})
+	}
 
 	now := time.Now()
 	req.device.telemetrySentTime = now
@@ -244,6 +278,9 @@ func (s *deviceSimulator) sendTelemetry(req *telemetryRequest) {
 func (s *deviceSimulator) sendTelemetryMessage(msg *telemetryMessage, req *telemetryRequest, wg *sync.WaitGroup) bool {
 	defer wg.Done()
 
+	_, span := tracing.Tracer().Start(req.context, "telemetrySend", trace.WithAttributes(attribute.Int("starling.sequence", msg.sequenceNumber)))
+	defer span.End()
+
 	// try to send telemetry couple of times before giving up
 	sentMessage := false
 	for i := 0; i < 2; i++ {
@@ -254,22 +291,33 @@ func (s *deviceSimulator) sendTelemetryMessage(msg *telemetryMessage, req *telem
 		} else {
 			// send telemetry to IoT Central
 			log.Trace().Str("payload", string(msg.body)).Int("size", len(msg.body)).Msg("about to send telemetry message")
-			timeoutCtx, _ := context.WithTimeout(req.device.context, time.Millisecond*time.Duration(s.config.TelemetryTimeout))
+			properties := map[string]string{
+				"iothub-creation-time-utc":    msg.creationTimeUtc.Format("2006-01-02T15:04:05"),
+				"iothub-connection-device-id": msg.connectionDeviceID,
+				"iothub-interface-id":         msg.interfaceId,
+			}
+			if consuming.Enabled() {
+				// system properties are not exported by IoT Central, so repeat the ids as message properties
+				properties["messageId"] = msg.messageID
+				properties["correlationId"] = msg.correlationID
+			}
+			timeoutCtx, cancel := context.WithTimeout(req.device.context, time.Millisecond*time.Duration(s.config.TelemetryTimeout))
 			err = req.device.iotHubClient.SendEvent(timeoutCtx, msg.body,
 				iotdevice.WithSendCorrelationID(msg.correlationID),
 				iotdevice.WithSendMessageID(msg.messageID),
-				iotdevice.WithSendProperties(map[string]string{
-					"iothub-creation-time-utc":    msg.creationTimeUtc.Format("2006-01-02T15:04:05"),
-					"iothub-connection-device-id": msg.connectionDeviceID,
-					"iothub-interface-id":         msg.interfaceId,
-				}))
+				iotdevice.WithSendProperties(properties))
+			cancel()
 		}
 		if err != nil {
 			log.Error().
 				Str("deviceID", req.device.deviceID).
 				Err(err).
 				Msg("error sending telemetry to hub")
-			telemetryMessageFailureTotal.WithLabelValues(s.simulation.ID, s.simulation.TargetID, req.device.model.ID, s.getErrorType(err)).Add(1)
+			errType := ErrorTypeOf(err)
+			telemetryMessageFailureTotal.WithLabelValues(s.simulation.ID, s.simulation.TargetID, req.device.model.ID, string(errType)).Add(1)
+			s.activity.recordError(errType)
+			s.recordFailure(req.device, models.DeviceEventTelemetryFailed, err)
+			tracing.Fail(span, err)
 			req.device.retryCount++
 		} else {
 			req.device.retryCount = 0
@@ -277,7 +325,12 @@ func (s *deviceSimulator) sendTelemetryMessage(msg *telemetryMessage, req *telem
 			latency := float64(time.Now().UnixNano()-start.UnixNano()) / float64(time.Second)
 			telemetryMessageSendLatency.WithLabelValues(s.simulation.ID, s.simulation.TargetID, req.device.model.ID).Observe(latency)
 			telemetrySentBytes.WithLabelValues(s.simulation.ID, s.simulation.TargetID, req.device.model.ID).Add(float64(len(msg.body)))
+			billableMessageUnitsTotal.WithLabelValues(s.simulation.ID, s.simulation.TargetID, req.device.model.ID).Add(float64(messageUnits(len(msg.body))))
 			telemetryDataPointsSentTotal.WithLabelValues(s.simulation.ID, s.simulation.TargetID, req.device.model.ID).Add(float64(msg.dataPointCount))
+			consuming.Track(msg.messageID, msg.correlationID, s.simulation.ID, s.simulation.TargetID, req.device.model.ID, req.device.deviceID, msg.sequenceNumber, msg.sentTime)
+			if s.verifier != nil {
+				s.verifier.recordSent(req.device, msg.sequenceNumber, msg.sentTime)
+			}
 			sentMessage = true
 			break
 		}
@@ -316,22 +369,26 @@ func (s *deviceSimulator) sendReportedProps(req *reportedPropsRequest) {
 	start := time.Now()
 	reportedProps, err := req.device.dataGenerator.GenerateReportedProperties(req.device)
 	if err != nil {
-		reportedPropsFailureTotal.WithLabelValues(s.simulation.ID, s.simulation.TargetID, req.device.model.ID, s.getErrorType(err)).Add(1)
+		reportedPropsFailureTotal.WithLabelValues(s.simulation.ID, s.simulation.TargetID, req.device.model.ID, string(ErrorTypeOf(err))).Add(1)
 		log.Debug().Err(err).Str("deviceID", req.device.deviceID).Msg("error generating reported property update")
 	}
 	log.Trace().Str("deviceID", req.device.deviceID).Msg(fmt.Sprintf("about to update reported props: %v", reportedProps))
 
 	// send the reported properties to IoT Central
-	timeoutCtx, _ := context.WithTimeout(req.device.context, time.Millisecond*time.Duration(s.config.TwinUpdateTimeout))
+	timeoutCtx, cancel := context.WithTimeout(req.device.context, time.Millisecond*time.Duration(s.config.TwinUpdateTimeout))
 	_, err = req.device.iotHubClient.UpdateTwinState(timeoutCtx, reportedProps)
+	cancel()
 	if err != nil {
-		reportedPropsFailureTotal.WithLabelValues(s.simulation.ID, s.simulation.TargetID, req.device.model.ID, s.getErrorType(err)).Add(1)
+		errType := ErrorTypeOf(err)
+		reportedPropsFailureTotal.WithLabelValues(s.simulation.ID, s.simulation.TargetID, req.device.model.ID, string(errType)).Add(1)
+		s.activity.recordError(errType)
 		log.Debug().Err(err).Str("deviceID", req.device.deviceID).Msg("error sending reported properties update")
 		req.device.retryCount++
 	} else {
 		end := time.Now()
 		latency := float64(end.UnixNano()-start.UnixNano()) / float64(time.Second)
 		reportedPropsSuccessTotal.WithLabelValues(s.simulation.ID, s.simulation.TargetID, req.device.model.ID).Add(1)
+		billableMessageUnitsTotal.WithLabelValues(s.simulation.ID, s.simulation.TargetID, req.device.model.ID).Add(float64(propertyUnits(reportedProps)))
 		reportedPropsSendLatency.WithLabelValues(s.simulation.ID, s.simulation.TargetID, req.device.model.ID).Observe(latency)
 		log.Trace().
 			Str("deviceID", req.device.deviceID).
@@ -345,13 +402,15 @@ func (s *deviceSimulator) sendReportedProps(req *reportedPropsRequest) {
 }
 
 // provisionDevice provision the device in Central
-func (s *deviceSimulator) provisionDevice(device *device, useCache bool) bool {
+func (s *deviceSimulator) provisionDevice(ctx context.Context, device *device, useCache bool) bool {
 	// see if the cache contains previously provisioned device
 	if useCache {
 		td, _ := storing.TargetDevices.Get(device.target.ID, device.deviceID)
 		if td != nil {
 			log.Trace().Str("deviceId", device.deviceID).Msg("found device in cache")
+			trace.SpanFromContext(ctx).AddEvent("found device in cache")
 			device.connectionString = td.ConnectionString
+			s.recordEvent(device, models.DeviceEvent{Type: models.DeviceEventProvisioned, Hub: getHubName(td.ConnectionString), Detail: "cached"})
 			return true
 		}
 	}
@@ -362,24 +421,30 @@ func (s *deviceSimulator) provisionDevice(device *device, useCache bool) bool {
 	// provision the device for the first time
 	req := &ProvisioningRequest{
 		DeviceID:   device.deviceID,
-		Context:    device.context,
+		Context:    ctx,
 		Target:     device.target,
 		Simulation: s.simulation,
 		Model:      device.model,
 	}
-	result := s.provisioner.Provision(req)
-	if result == nil {
+	result, err := s.provisioner.Provision(req)
+	if err != nil {
 		// remove provisioning throttle
 		<-s.provisionThrottle
+		s.activity.recordError(ErrorTypeOf(err))
+		s.recordFailure(device, models.DeviceEventProvisioningFailed, err)
 		return false
 	}
 	device.connectionString = result.ConnectionString
+	s.recordEvent(device, models.DeviceEvent{Type: models.DeviceEventProvisioned, Hub: getHubName(result.ConnectionString)})
 
 	// cache the device for future use
 	newDevice := models.SimulationTargetDevice{
 		TargetID:         req.Target.ID,
 		DeviceID:         req.DeviceID,
 		ConnectionString: result.ConnectionString,
+		SimulationID:     s.simulation.ID,
+		ModelID:          device.model.ID,
+		Index:            device.index,
 	}
 	if err := storing.TargetDevices.Set(&newDevice); err != nil {
 		// remove provisioning throttle
@@ -396,15 +461,20 @@ func (s *deviceSimulator) provisionDevice(device *device, useCache bool) bool {
 
 // connectDevice provisions and connects a given device
 func (s *deviceSimulator) connectDevice(device *device) bool {
+	ctx, span := tracing.Start(device.context, "connect", s.simulation.ID, s.simulation.TargetID, device.model.ID, device.deviceID)
+	defer span.End()
+
 	// provision the device for the first time
 	if len(device.connectionString) == 0 {
-		if s.provisionDevice(device, true) == false {
+		if s.provisionDevice(ctx, device, true) == false {
+			span.SetStatus(codes.Error, "provisioning failed")
 			return false
 		}
 	}
 
 	// if the device is in the middle of connecting, ignore this request
 	if device.isConnecting {
+		span.AddEvent("already connecting")
 		return false
 	}
 
@@ -428,21 +498,30 @@ func (s *deviceSimulator) connectDevice(device *device) bool {
 		if err != nil {
 			device.isConnecting = false
 			log.Error().Err(err).Str("deviceID", device.deviceID).Str("connectionString", device.connectionString).Msg("error parsing connection string")
+			s.recordFailure(device, models.DeviceEventConnectFailed, err)
+			tracing.Fail(span, err)
 			return false
 		}
 
 		log.Trace().Str("deviceID", device.deviceID).Str("connectionString", device.connectionString).Msg("trying to connect to iothub")
-		timeoutCtx, _ := context.WithTimeout(device.context, time.Millisecond*time.Duration(s.config.ConnectionTimeout))
-		if err = device.iotHubClient.Connect(timeoutCtx); err != nil {
+		timeoutCtx, cancel := context.WithTimeout(device.context, time.Millisecond*time.Duration(s.config.ConnectionTimeout))
+		err = device.iotHubClient.Connect(timeoutCtx)
+		cancel()
+		if err != nil {
 			device.isConnecting = false
 			log.Error().Err(err).Str("deviceID", device.deviceID).Msg("error connecting to IoT Hub")
+			s.activity.recordError(ErrorTypeOf(err))
+			s.recordFailure(device, models.DeviceEventConnectFailed, err)
+			span.RecordError(err)
 
 			// device might have moved to a different hub, provision and connect to hub again
 			errMsg := strings.ToLower(err.Error())
 			if errMsg == "not authorized" || errMsg == "server unavailable" || strings.Contains(errMsg, "network error") {
 				log.Trace().Str("deviceID", device.deviceID).Msg("detected hub fail over, re-provisioning device")
+				span.AddEvent("hub fail over", trace.WithAttributes(attribute.String("starling.hub", hub)))
 
-				if s.provisionDevice(device, false) == false {
+				if s.provisionDevice(ctx, device, false) == false {
+					span.SetStatus(codes.Error, "re-provisioning failed")
 					return false
 				}
 
@@ -452,19 +531,29 @@ func (s *deviceSimulator) connectDevice(device *device) bool {
 				}
 				device.iotHubClient = nil
 
+				s.recordEvent(device, models.DeviceEvent{
+					Type:   models.DeviceEventFailover,
+					Hub:    getHubName(device.connectionString),
+					Detail: fmt.Sprintf("failed over from hub %s", hub),
+				})
 				hub = getHubName(device.connectionString)
 				device.iotHubClient, _ = iotdevice.NewFromConnectionString(iotmqtt.New(), device.connectionString,
 					iotdevice.WithLogger(logger.New(logger.LevelDebug, func(lvl logger.Level, s string) {
 						log.Trace().Msg(s)
 					})))
-				timeoutCtx, _ := context.WithTimeout(device.context, time.Millisecond*time.Duration(s.config.ConnectionTimeout))
-				if err = device.iotHubClient.Connect(timeoutCtx); err != nil {
+				timeoutCtx, cancel := context.WithTimeout(device.context, time.Millisecond*time.Duration(s.config.ConnectionTimeout))
+				err = device.iotHubClient.Connect(timeoutCtx)
+				cancel()
+				if err != nil {
 					log.Error().Err(err).Str("deviceID", device.deviceID).Str("connectionString", device.connectionString).Msg("error connecting to IoT Hub")
+					s.recordFailure(device, models.DeviceEventConnectFailed, err)
+					tracing.Fail(span, err)
 					return false
 				}
 				deviceFailoverTotal.WithLabelValues(s.simulation.ID, s.simulation.TargetID, device.model.ID).Inc()
 				log.Debug().Str("deviceID", device.deviceID).Msg("detected hub fail over, reconnected to IoT Hub")
 			} else {
+				tracing.Fail(span, err)
 				return false
 			}
 		}
@@ -474,6 +563,7 @@ func (s *deviceSimulator) connectDevice(device *device) bool {
 		if s.config.EnableTwinUpdateAcks {
 			if s.subscribeTwinUpdates(device) == false {
 				device.isConnecting = false
+				span.SetStatus(codes.Error, "twin update subscription failed")
 				return false
 			}
 		}
@@ -482,15 +572,19 @@ func (s *deviceSimulator) connectDevice(device *device) bool {
 		if s.config.EnableCommandAcks {
 			if s.subscribeCommands(device) == false {
 				device.isConnecting = false
+				span.SetStatus(codes.Error, "command subscription failed")
 				return false
 			}
 		}
 	}
 
+	span.SetAttributes(attribute.String("starling.hub", hub))
 	device.isConnected = true
 	device.isConnecting = false
 	connectedDeviceGauge.WithLabelValues(s.simulation.ID, s.simulation.TargetID, device.model.ID, hub).Inc()
 	connectedDeviceByModelGauge.WithLabelValues(s.simulation.ID, s.simulation.TargetID, device.model.ID).Inc()
+	s.activity.recordConnect()
+	s.recordEvent(device, models.DeviceEvent{Type: models.DeviceEventConnected, Hub: hub})
 	return true
 }
 
@@ -529,6 +623,8 @@ func (s *deviceSimulator) disconnectDevice(device *device) bool {
 	if device.isConnected {
 		connectedDeviceGauge.WithLabelValues(s.simulation.ID, s.simulation.TargetID, device.model.ID, hub).Dec()
 		connectedDeviceByModelGauge.WithLabelValues(s.simulation.ID, s.simulation.TargetID, device.model.ID).Dec()
+		s.activity.recordDisconnect()
+		s.recordEvent(device, models.DeviceEvent{Type: models.DeviceEventDisconnected, Hub: hub})
 	}
 	device.isConnected = false
 
@@ -538,8 +634,9 @@ func (s *deviceSimulator) disconnectDevice(device *device) bool {
 // subscribeTwinUpdates creates subscription to monitor twin update (desired property) requests for a given device
 func (s *deviceSimulator) subscribeTwinUpdates(device *device) bool {
 	var err error
-	timeoutCtx, _ := context.WithTimeout(device.context, time.Millisecond*time.Duration(s.config.TwinUpdateTimeout))
+	timeoutCtx, cancel := context.WithTimeout(device.context, time.Millisecond*time.Duration(s.config.TwinUpdateTimeout))
 	device.twinSub, err = device.iotHubClient.SubscribeTwinUpdates(timeoutCtx)
+	cancel()
 	if err != nil {
 		// TODO: add retry
 		log.Err(err).Str("deviceID", device.deviceID).Msg("twin update subscription failed")
@@ -553,31 +650,43 @@ func (s *deviceSimulator) subscribeTwinUpdates(device *device) bool {
 				log.Trace().Str("deviceID", device.deviceID).Msg("device twin subscription stopped")
 				return
 			case desiredTwin := <-device.twinSub.C():
+				s.observeDesiredDelivery(device, desiredTwin, time.Now())
 				dt, _ := json.Marshal(desiredTwin)
 				log.Trace().Str("deviceID", device.deviceID).
 					Str("desiredTwin", fmt.Sprintf("%s", dt)).
 					Msg("got twin update")
+				s.recordEvent(device, models.DeviceEvent{Type: models.DeviceEventTwinUpdateReceived, Detail: fmt.Sprintf("version %d", desiredTwin.Version())})
 
 				// acknowledge twin update by echoing reported properties
+				_, span := tracing.Start(device.context, "twinUpdateAck", s.simulation.ID, s.simulation.TargetID, device.model.ID, device.deviceID)
+				span.SetAttributes(attribute.Int("starling.version", desiredTwin.Version()))
 				reportedTwin := device.dataGenerator.GenerateTwinUpdateAck(desiredTwin)
 				start := time.Now()
-				timeoutCtx, _ := context.WithTimeout(device.context, time.Millisecond*time.Duration(s.config.TwinUpdateTimeout))
+				timeoutCtx, cancel := context.WithTimeout(device.context, time.Millisecond*time.Duration(s.config.TwinUpdateTimeout))
 				_, err := device.iotHubClient.UpdateTwinState(timeoutCtx, reportedTwin)
+				cancel()
 				end := time.Now()
 				latency := float64(end.UnixNano()-start.UnixNano()) / float64(time.Second)
 
 				if err != nil {
-					twinUpdateFailureTotal.WithLabelValues(s.simulation.ID, s.simulation.TargetID, device.model.ID, s.getErrorType(err)).Add(1)
+					errType := ErrorTypeOf(err)
+					twinUpdateFailureTotal.WithLabelValues(s.simulation.ID, s.simulation.TargetID, device.model.ID, string(errType)).Add(1)
+					s.activity.recordError(errType)
+					s.recordFailure(device, models.DeviceEventTwinUpdateFailed, err)
+					tracing.Fail(span, err)
 					log.Err(err).Str("deviceID", device.deviceID).Msg("twin update failed")
 				} else {
 					twinUpdateSendLatency.WithLabelValues(s.simulation.ID, s.simulation.TargetID, device.model.ID).Observe(latency)
 					twinUpdateSuccessTotal.WithLabelValues(s.simulation.ID, s.simulation.TargetID, device.model.ID).Add(1)
+					billableMessageUnitsTotal.WithLabelValues(s.simulation.ID, s.simulation.TargetID, device.model.ID).Add(float64(propertyUnits(reportedTwin)))
+					s.recordEvent(device, models.DeviceEvent{Type: models.DeviceEventTwinUpdateAcked, Detail: fmt.Sprintf("version %d", desiredTwin.Version())})
 					rt, _ := json.Marshal(reportedTwin)
 					log.Trace().Str("deviceID", device.deviceID).
 						//Int("reportedVersion", reportedVersion).
 						Str("reportedProperties", fmt.Sprintf("%s", rt)).
 						Msg("acknowledged twin update")
 				}
+				span.End()
 			}
 		}
 	}()
@@ -600,15 +709,18 @@ func (s *deviceSimulator) subscribeCommands(device *device) bool {
 	for _, component := range device.dataGenerator.CapabilityModel.Components {
 		for _, command := range component.Commands {
 			if command.IsSync {
-				timeoutCtx, _ := context.WithTimeout(device.context, time.Millisecond*time.Duration(s.config.CommandTimeout))
+				timeoutCtx, cancel := context.WithTimeout(device.context, time.Millisecond*time.Duration(s.config.CommandTimeout))
 				err := device.iotHubClient.RegisterMethod(timeoutCtx, command.Name, func(p map[string]interface{}) (map[string]interface{}, error) {
 					// acknowledge the c2d command by a reply
 					// TODO: need to figure out how to respond with proper return types based on the DCM
 					resp := make(map[string]interface{})
+					s.observeCommandDelivery(device, p, nil, time.Now())
 					commandsSuccessTotal.WithLabelValues(s.simulation.ID, s.simulation.TargetID, device.model.ID).Add(1)
+					s.recordEvent(device, models.DeviceEvent{Type: models.DeviceEventCommandReceived, Detail: command.Name})
 					log.Trace().Str("deviceID", device.deviceID).Str("Method", command.Name).Msg("direct method acknowledged")
 					return resp, nil
 				})
+				cancel()
 
 				if err != nil {
 					log.Err(err).Str("deviceID", device.deviceID).Str("Method", command.Name).Msg("failed to register direct method")
@@ -623,8 +735,9 @@ func (s *deviceSimulator) subscribeCommands(device *device) bool {
 	// register for C2D (Async) Commands
 	if hasAsyncCommands {
 		var err error
-		timeoutCtx, _ := context.WithTimeout(device.context, time.Millisecond*time.Duration(s.config.CommandTimeout))
+		timeoutCtx, cancel := context.WithTimeout(device.context, time.Millisecond*time.Duration(s.config.CommandTimeout))
 		device.c2dSub, err = device.iotHubClient.SubscribeEvents(timeoutCtx)
+		cancel()
 		if err != nil {
 			log.Err(err).Str("deviceID", device.deviceID).Msg("c2d command subscription failed")
 			return false
@@ -637,8 +750,10 @@ func (s *deviceSimulator) subscribeCommands(device *device) bool {
 					return
 				case msg := <-device.c2dSub.C():
 					if msg != nil {
+						s.observeCommandDelivery(device, msg.Payload, msg.EnqueuedTime, time.Now())
 						log.Trace().Str("msg", string(msg.Properties["method-name"])).Str("msg", fmt.Sprintf("%v", msg)).Msg("received c2d command")
 						commandsSuccessTotal.WithLabelValues(s.simulation.ID, s.simulation.TargetID, device.model.ID).Add(1)
+						s.recordEvent(device, models.DeviceEvent{Type: models.DeviceEventCommandReceived, Detail: string(msg.Properties["method-name"])})
 
 						// send ack to c2d command
 						//s.sendC2DAck(device, msg)
@@ -692,26 +807,34 @@ func (s *deviceSimulator) getNextTelemetryBatch(device *device) *telemetryBatch
 	return &batch
 }
 
-// getErrorType groups the error messages into meaningful errors for metrics
-func (s *deviceSimulator) getErrorType(err error) string {
-	errMsg := "error"
-	if err != nil {
-		errMsg = err.Error()
-	}
-	if strings.Contains(errMsg, "429") {
-		return "throttled"
-	} else if strings.Contains(errMsg, "use of closed connection") || strings.Contains(errMsg, "use of closed network connection") || strings.Contains(errMsg, "forcibly closed by the remote host") {
-		return "connection closed"
-	} else if strings.Contains(errMsg, "Not Authorized") {
-		return "not authorized"
-	} else if strings.Contains(errMsg, "context deadline exceeded") {
-		return "timeout"
-	} else if strings.Contains(reflect.TypeOf(err).String(), "tls.permanentError") {
-		return "network error"
-	}
-
-	//return errMsg
-	return reflect.TypeOf(err).String()
+// recordConnect counts a device connection.
+func (a *deviceActivity) recordConnect() {
+	a.Lock()
+	defer a.Unlock()
+	a.connects++
+}
+
+// recordDisconnect counts a device disconnection.
+func (a *deviceActivity) recordDisconnect() {
+	a.Lock()
+	defer a.Unlock()
+	a.disconnects++
+}
+
+// recordError counts an error of the given type.
+func (a *deviceActivity) recordError(errType models.ErrorType) {
+	a.Lock()
+	defer a.Unlock()
+	a.errors[string(errType)]++
+}
+
+// reset returns the activity recorded so far and starts counting again.
+func (a *deviceActivity) reset() (connects int, disconnects int, errors map[string]int) {
+	a.Lock()
+	defer a.Unlock()
+	connects, disconnects, errors = a.connects, a.disconnects, a.errors
+	a.connects, a.disconnects, a.errors = 0, 0, map[string]int{}
+	return connects, disconnects, errors
 }
 
 func getHubName(connectionString string) string {
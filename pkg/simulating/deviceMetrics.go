@@ -0,0 +1,57 @@
+package simulating
+
+import (
+	"github.com/iot-for-all/starling/pkg/consuming"
+	"github.com/iot-for-all/starling/pkg/models"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// maxDeviceMetricsDevices is the largest number of devices of a simulation reporting metrics per device.
+	// Every device adds its own series, so larger simulations would overwhelm Prometheus.
+	maxDeviceMetricsDevices = 100
+)
+
+// enableDeviceMetrics turns on the metrics per device if the simulation asks for them and is small enough.
+func (s *Simulator) enableDeviceMetrics() {
+	if !s.simulation.DeviceMetrics {
+		return
+	}
+
+	devices := 0
+	for _, dc := range s.deviceConfigs {
+		devices += dc.DeviceCount
+	}
+	if devices > maxDeviceMetricsDevices {
+		log.Warn().
+			Str("simID", s.simulation.ID).
+			Int("devices", devices).
+			Int("maxDevices", maxDeviceMetricsDevices).
+			Msg("simulation has too many devices to report metrics per device")
+		return
+	}
+
+	s.deviceSimulator.deviceMetrics = true
+	consuming.EnableDeviceMetrics(s.simulation.ID)
+}
+
+// observeDevice updates the metrics of a device from a lifecycle event, if metrics per device are enabled.
+func (s *deviceSimulator) observeDevice(device *device, event models.DeviceEvent) {
+	if !s.deviceMetrics {
+		return
+	}
+
+	sim, target, model, id := s.simulation.ID, s.simulation.TargetID, device.model.ID, device.deviceID
+	deviceEventsTotal.WithLabelValues(sim, target, model, id, string(event.Type)).Inc()
+	switch event.Type {
+	case models.DeviceEventConnected:
+		deviceConnectedGauge.WithLabelValues(sim, target, model, id).Set(1)
+	case models.DeviceEventDisconnected:
+		deviceConnectedGauge.WithLabelValues(sim, target, model, id).Set(0)
+	case models.DeviceEventTelemetrySent:
+		deviceTelemetryMessagesTotal.WithLabelValues(sim, target, model, id).Add(float64(event.Count))
+	}
+	if len(event.ErrorType) > 0 {
+		deviceFailuresTotal.WithLabelValues(sim, target, model, id, string(event.ErrorType)).Inc()
+	}
+}
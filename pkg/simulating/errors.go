@@ -0,0 +1,188 @@
+package simulating
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+
+	"github.com/iot-for-all/starling/pkg/models"
+)
+
+const (
+	// iotHubQuotaExceeded is the error code of IoT Hub rejecting requests once its daily message quota is exhausted.
+	iotHubQuotaExceeded = 403002
+)
+
+type (
+	// DeviceError is an error of a simulated device operation classified into an error type.
+	// It wraps the error of the transport or provisioning service and reports its message unchanged.
+	DeviceError struct {
+		Op   string           // operation that failed e.g. telemetry, twinUpdate, connect, provision.
+		Type models.ErrorType // classification of the error.
+		Err  error            // the underlying error.
+	}
+)
+
+// newDeviceError wraps the error of an operation, classifying it unless it is already classified.
+func newDeviceError(op string, err error) *DeviceError {
+	var de *DeviceError
+	if errors.As(err, &de) {
+		return &DeviceError{Op: op, Type: de.Type, Err: err}
+	}
+
+	return &DeviceError{Op: op, Type: classifyError(err), Err: err}
+}
+
+// Error returns the message of the underlying error.
+func (e *DeviceError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *DeviceError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorTypeOf returns the error type of an error, classifying it if it was not produced by a device operation.
+func ErrorTypeOf(err error) models.ErrorType {
+	var de *DeviceError
+	if errors.As(err, &de) {
+		return de.Type
+	}
+
+	return classifyError(err)
+}
+
+// classifyError determines the error type from the errors of the network stack, the MQTT transport and the
+// IoT Hub responses wrapped in the error.
+func classifyError(err error) models.ErrorType {
+	if err == nil {
+		return models.ErrorUnknown
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return models.ErrorCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return models.ErrorTimeout
+	}
+
+	var regErr *registrationError
+	if errors.As(err, &regErr) {
+		return regErr.errorType()
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return models.ErrorDNS
+	}
+
+	if isTLSError(err) {
+		return models.ErrorTLS
+	}
+
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return models.ErrorHubUnavailable
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return models.ErrorConnectionReset
+	case errors.Is(err, net.ErrClosed):
+		return models.ErrorConnectionClosed
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return models.ErrorTimeout
+	}
+
+	// IoT Hub responses to twin requests only carry the status code in the message, without the error code. The device
+	// is connected, so its credentials were accepted, and IoT Hub only forbids its requests once the quota is exhausted.
+	var statusCode int
+	if _, e := fmt.Sscanf(innermostMessage(err.Error()), "request failed with %d response code", &statusCode); e == nil {
+		if statusCode == http.StatusForbidden {
+			return models.ErrorQuotaExceeded
+		}
+		return statusErrorType(statusCode, 0)
+	}
+
+	// the MQTT transport reports connection failures as plain errors
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "not authorized"), strings.Contains(msg, "bad user name or password"):
+		return models.ErrorUnauthorized
+	case strings.Contains(msg, "server unavailable"):
+		return models.ErrorHubUnavailable
+	case strings.Contains(msg, "network error"), strings.Contains(msg, "forcibly closed by the remote host"):
+		return models.ErrorConnectionReset
+	case strings.Contains(msg, "not connected"), msg == "closed", strings.Contains(msg, "use of closed"):
+		return models.ErrorConnectionClosed
+	case strings.Contains(msg, "429"):
+		return models.ErrorThrottled
+	}
+
+	return models.ErrorUnknown
+}
+
+// statusErrorType determines the error type from an HTTP style status code returned by IoT Hub or DPS, refined by
+// the error code of the response if there is one.
+func statusErrorType(statusCode int, errorCode int) models.ErrorType {
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return models.ErrorThrottled
+	case statusCode == http.StatusUnauthorized:
+		return models.ErrorUnauthorized
+	case statusCode == http.StatusForbidden && errorCode == iotHubQuotaExceeded:
+		return models.ErrorQuotaExceeded
+	case statusCode == http.StatusForbidden:
+		return models.ErrorUnauthorized
+	case statusCode == http.StatusNotFound:
+		return models.ErrorNotFound
+	case statusCode == http.StatusRequestEntityTooLarge:
+		return models.ErrorPayloadTooLarge
+	case statusCode == http.StatusRequestTimeout, statusCode == http.StatusGatewayTimeout:
+		return models.ErrorTimeout
+	case statusCode >= http.StatusInternalServerError:
+		return models.ErrorHubUnavailable
+	case statusCode >= http.StatusBadRequest:
+		return models.ErrorInvalidRequest
+	}
+
+	return models.ErrorUnknown
+}
+
+// isTLSError reports whether the error was caused by the TLS handshake or certificate validation.
+func isTLSError(err error) bool {
+	var (
+		verificationErr *tls.CertificateVerificationError
+		recordErr       tls.RecordHeaderError
+		alertErr        tls.AlertError
+		authorityErr    x509.UnknownAuthorityError
+		invalidErr      x509.CertificateInvalidError
+		hostnameErr     x509.HostnameError
+		rootsErr        x509.SystemRootsError
+	)
+
+	return errors.As(err, &verificationErr) ||
+		errors.As(err, &recordErr) ||
+		errors.As(err, &alertErr) ||
+		errors.As(err, &authorityErr) ||
+		errors.As(err, &invalidErr) ||
+		errors.As(err, &hostnameErr) ||
+		errors.As(err, &rootsErr)
+}
+
+// innermostMessage returns the innermost part of an error message built by wrapping errors with a colon.
+func innermostMessage(msg string) string {
+	if i := strings.LastIndex(msg, ": "); i >= 0 {
+		return msg[i+2:]
+	}
+
+	return msg
+}
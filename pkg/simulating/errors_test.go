@@ -0,0 +1,34 @@
+package simulating
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/iot-for-all/starling/pkg/models"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected models.ErrorType
+	}{
+		{"twin quota", fmt.Errorf("twin update: %w", errors.New("request failed with 403 response code")), models.ErrorQuotaExceeded},
+		{"twin throttled", errors.New("request failed with 429 response code"), models.ErrorThrottled},
+		{"twin unauthorized", errors.New("request failed with 401 response code"), models.ErrorUnauthorized},
+		{"provisioning quota", &registrationError{StatusCode: 403, ErrorCode: iotHubQuotaExceeded}, models.ErrorQuotaExceeded},
+		{"provisioning forbidden", &registrationError{StatusCode: 403, ErrorCode: 403000}, models.ErrorUnauthorized},
+		{"connection refused", errors.New("not Authorized"), models.ErrorUnauthorized},
+		{"timeout", fmt.Errorf("send: %w", context.DeadlineExceeded), models.ErrorTimeout},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if errType := classifyError(test.err); errType != test.expected {
+				t.Errorf("expected error type '%s', got '%s'", test.expected, errType)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package simulating
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/iot-for-all/starling/pkg/models"
+)
+
+const (
+	// maxFailureReasons limits the number of distinct failure reasons kept per simulation.
+	maxFailureReasons = 100
+)
+
+type (
+	// failureReasons counts the provisioning failures of the simulations by reason.
+	failureReasons struct {
+		sync.Mutex
+		simulations map[string]map[string]*models.ProvisioningFailure // failures by simulation id and reason.
+	}
+)
+
+var (
+	provisioningFailures = &failureReasons{simulations: map[string]map[string]*models.ProvisioningFailure{}} // reasons devices failed provisioning
+)
+
+// ProvisioningFailures lists the most frequent reasons devices of a simulation failed provisioning, up to limit reasons.
+func ProvisioningFailures(simulationID string, limit int) []models.ProvisioningFailure {
+	provisioningFailures.Lock()
+	defer provisioningFailures.Unlock()
+
+	failures := make([]models.ProvisioningFailure, 0, len(provisioningFailures.simulations[simulationID]))
+	for _, f := range provisioningFailures.simulations[simulationID] {
+		failures = append(failures, *f)
+	}
+	sort.Slice(failures, func(i, j int) bool {
+		if failures[i].Count != failures[j].Count {
+			return failures[i].Count > failures[j].Count
+		}
+		return failures[i].LastTime.After(failures[j].LastTime)
+	})
+	if len(failures) > limit {
+		failures = failures[:limit]
+	}
+
+	return failures
+}
+
+// ResetProvisioningFailures forgets the provisioning failures of a simulation.
+func ResetProvisioningFailures(simulationID string) {
+	provisioningFailures.Lock()
+	defer provisioningFailures.Unlock()
+
+	delete(provisioningFailures.simulations, simulationID)
+}
+
+// record counts a provisioning failure of a simulation. Failures reported by DPS are told apart by their status
+// and error code, other failures by their error type.
+func (f *failureReasons) record(simulationID string, err *DeviceError) {
+	reason := string(err.Type)
+	var regErr *registrationError
+	if errors.As(err, &regErr) {
+		reason = regErr.reason()
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	reasons, ok := f.simulations[simulationID]
+	if !ok {
+		reasons = map[string]*models.ProvisioningFailure{}
+		f.simulations[simulationID] = reasons
+	}
+	failure, ok := reasons[reason]
+	if !ok {
+		if len(reasons) >= maxFailureReasons {
+			return
+		}
+		failure = &models.ProvisioningFailure{ErrorType: err.Type, Reason: reason}
+		reasons[reason] = failure
+	}
+	failure.Count++
+	failure.Message = err.Error()
+	failure.LastTime = time.Now().UTC()
+}
@@ -0,0 +1,235 @@
+package simulating
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/iot-for-all/starling/pkg/models"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// journalSinkBuffer is the number of events queued for the journal file before events are dropped.
+	journalSinkBuffer = 10000
+)
+
+type (
+	// eventRing keeps the most recent events of a device, overwriting the oldest event when full.
+	eventRing struct {
+		events []models.DeviceEvent // recorded events, in order of recording until the ring wraps.
+		next   int                  // position the next event is written to.
+		full   bool                 // has the ring wrapped around.
+	}
+
+	// journalFile appends the events of all running simulations to the JSON lines file from a single writer, so that
+	// the lines of concurrent simulations never interleave.
+	journalFile struct {
+		events chan models.DeviceEvent // events queued for the writer.
+		sims   map[string]int          // number of runs appending to the file by simulation id.
+		closed chan struct{}           // closed once the writer drained the queue and closed the file.
+	}
+
+	// deviceJournal keeps the recent lifecycle events of the simulated devices per simulation, and optionally
+	// appends all events to a JSON lines file for post-mortem analysis.
+	deviceJournal struct {
+		sync.Mutex
+		sizes   map[string]int                   // number of events kept per device by simulation id.
+		devices map[string]map[string]*eventRing // events by simulation id and device id.
+		file    *journalFile                     // writer of the journal file, nil while no simulation appends to it.
+		closed  chan struct{}                    // closed once the last writer of the journal file finished.
+	}
+)
+
+var (
+	journal = &deviceJournal{
+		sizes:   map[string]int{},
+		devices: map[string]map[string]*eventRing{},
+	} // recent lifecycle events of the simulated devices
+)
+
+// DeviceEvents lists the recent lifecycle events of a device of a simulation, oldest first.
+// It returns nil if no events were recorded for the device.
+func DeviceEvents(simulationID string, deviceID string) []models.DeviceEvent {
+	journal.Lock()
+	defer journal.Unlock()
+
+	ring, ok := journal.devices[simulationID][deviceID]
+	if !ok {
+		return nil
+	}
+
+	return ring.list()
+}
+
+// reset forgets the events recorded for a simulation and keeps up to size events per device from now on.
+func (j *deviceJournal) reset(simulationID string, size int) {
+	j.Lock()
+	defer j.Unlock()
+
+	j.sizes[simulationID] = size
+	j.devices[simulationID] = map[string]*eventRing{}
+}
+
+// record adds an event to the journal of its device and queues it for the journal file.
+func (j *deviceJournal) record(event models.DeviceEvent) {
+	j.Lock()
+	defer j.Unlock()
+
+	if size := j.sizes[event.SimulationID]; size > 0 {
+		devices, ok := j.devices[event.SimulationID]
+		if !ok {
+			devices = map[string]*eventRing{}
+			j.devices[event.SimulationID] = devices
+		}
+		ring, ok := devices[event.DeviceID]
+		if !ok {
+			ring = &eventRing{}
+			devices[event.DeviceID] = ring
+		}
+		ring.add(event, size)
+	}
+
+	if j.file != nil && j.file.sims[event.SimulationID] > 0 {
+		// never block the devices on the file, drop the event instead
+		select {
+		case j.file.events <- event:
+		default:
+		}
+	}
+}
+
+// startSink appends the events of a simulation to the given JSON lines file until the context is done.
+func (j *deviceJournal) startSink(ctx context.Context, simulationID string, path string) {
+	j.Lock()
+	defer j.Unlock()
+
+	if j.file == nil {
+		// let the writer of earlier runs finish draining its queue, so that only one writer appends to the file
+		if j.closed != nil {
+			<-j.closed
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0744); err != nil {
+			log.Error().Err(err).Str("file", path).Msg("error creating device journal directory")
+			return
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Error().Err(err).Str("file", path).Msg("error opening device journal file")
+			return
+		}
+
+		j.file = &journalFile{
+			events: make(chan models.DeviceEvent, journalSinkBuffer),
+			sims:   map[string]int{},
+			closed: make(chan struct{}),
+		}
+		j.closed = j.file.closed
+		go j.file.write(file, path)
+	}
+
+	f := j.file
+	f.sims[simulationID]++
+	go func() {
+		<-ctx.Done()
+		j.stopSink(f, simulationID)
+	}()
+}
+
+// stopSink stops appending the events of a run of a simulation to the journal file, and lets the writer drain its
+// queue and close the file once no simulation appends to it anymore.
+func (j *deviceJournal) stopSink(f *journalFile, simulationID string) {
+	j.Lock()
+	defer j.Unlock()
+
+	f.sims[simulationID]--
+	if f.sims[simulationID] <= 0 {
+		delete(f.sims, simulationID)
+	}
+	if len(f.sims) == 0 && j.file == f {
+		close(f.events)
+		j.file = nil
+	}
+}
+
+// write appends the queued events to the file until the queue is closed and drained.
+func (f *journalFile) write(file *os.File, path string) {
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	defer func() {
+		if err := writer.Flush(); err != nil {
+			log.Error().Err(err).Str("file", path).Msg("error writing device journal file")
+		}
+		_ = file.Close()
+		close(f.closed)
+	}()
+
+	failed := false
+	for event := range f.events {
+		if failed {
+			continue
+		}
+		if err := encoder.Encode(event); err != nil {
+			log.Error().Err(err).Str("file", path).Msg("error writing device journal file")
+			failed = true
+			continue
+		}
+		// flush once the queue is drained so that the file is current when the simulation is idle
+		if len(f.events) == 0 {
+			_ = writer.Flush()
+		}
+	}
+}
+
+// add appends an event, overwriting the oldest event once size events are kept.
+func (r *eventRing) add(event models.DeviceEvent, size int) {
+	if !r.full && len(r.events) < size {
+		r.events = append(r.events, event)
+		r.next = len(r.events) % size
+		r.full = r.next == 0
+		return
+	}
+
+	r.events[r.next] = event
+	r.next = (r.next + 1) % len(r.events)
+}
+
+// list returns a copy of the events, oldest first.
+func (r *eventRing) list() []models.DeviceEvent {
+	events := make([]models.DeviceEvent, 0, len(r.events))
+	if r.full {
+		events = append(events, r.events[r.next:]...)
+		events = append(events, r.events[:r.next]...)
+		return events
+	}
+
+	return append(events, r.events...)
+}
+
+// recordEvent records a lifecycle event of a device in the journal.
+func (s *deviceSimulator) recordEvent(device *device, event models.DeviceEvent) {
+	event.Time = time.Now().UTC()
+	event.SimulationID = s.simulation.ID
+	event.DeviceID = device.deviceID
+	event.ModelID = device.model.ID
+	journal.record(event)
+	s.observeDevice(device, event)
+}
+
+// recordFailure records a failed lifecycle operation of a device in the journal.
+func (s *deviceSimulator) recordFailure(device *device, eventType models.DeviceEventType, err error) {
+	event := models.DeviceEvent{
+		Type:      eventType,
+		ErrorType: ErrorTypeOf(err),
+		Error:     err.Error(),
+	}
+	if len(device.connectionString) > 0 {
+		event.Hub = getHubName(device.connectionString)
+	}
+	s.recordEvent(device, event)
+}
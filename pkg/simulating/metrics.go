@@ -3,30 +3,56 @@ package simulating
 import "github.com/prometheus/client_golang/prometheus"
 
 var (
-	simulatedDeviceGauge         *prometheus.GaugeVec
-	connectedDeviceGauge         *prometheus.GaugeVec
-	connectedDeviceByModelGauge  *prometheus.GaugeVec
-	deviceConnectLatency         *prometheus.HistogramVec
-	deviceFailoverTotal          *prometheus.CounterVec
-	provisionSuccessTotal        *prometheus.CounterVec
-	provisionFailuresTotal       *prometheus.CounterVec
-	provisionLatency             *prometheus.HistogramVec
-	telemetryBatchSuccessTotal   *prometheus.CounterVec
-	telemetryBatchSkippedTotal   *prometheus.CounterVec
-	telemetryBatchSendLatency    *prometheus.HistogramVec
-	telemetryMessageSuccessTotal *prometheus.CounterVec
-	telemetryMessageFailureTotal *prometheus.CounterVec
-	telemetryMessageSendLatency  *prometheus.HistogramVec
-	telemetrySentBytes           *prometheus.CounterVec
-	telemetryDataPointsSentTotal *prometheus.CounterVec
-	twinUpdateSuccessTotal       *prometheus.CounterVec
-	twinUpdateFailureTotal       *prometheus.CounterVec
-	twinUpdateSendLatency        *prometheus.HistogramVec
-	reportedPropsSkippedTotal    *prometheus.CounterVec
-	reportedPropsSuccessTotal    *prometheus.CounterVec
-	reportedPropsFailureTotal    *prometheus.CounterVec
-	reportedPropsSendLatency     *prometheus.HistogramVec
-	commandsSuccessTotal         *prometheus.CounterVec
+	simulatedDeviceGauge          *prometheus.GaugeVec
+	connectedDeviceGauge          *prometheus.GaugeVec
+	connectedDeviceByModelGauge   *prometheus.GaugeVec
+	deviceConnectLatency          *prometheus.HistogramVec
+	deviceFailoverTotal           *prometheus.CounterVec
+	provisionSuccessTotal         *prometheus.CounterVec
+	provisionFailuresTotal        *prometheus.CounterVec
+	provisionRegistrationAttempts *prometheus.HistogramVec
+	provisionRetryAfter           *prometheus.HistogramVec
+	provisionLatency              *prometheus.HistogramVec
+	telemetryBatchSuccessTotal    *prometheus.CounterVec
+	telemetryBatchSkippedTotal    *prometheus.CounterVec
+	telemetryBatchSendLatency     *prometheus.HistogramVec
+	telemetryMessageSuccessTotal  *prometheus.CounterVec
+	telemetryMessageFailureTotal  *prometheus.CounterVec
+	telemetryMessageSendLatency   *prometheus.HistogramVec
+	telemetrySentBytes            *prometheus.CounterVec
+	billableMessageUnitsTotal     *prometheus.CounterVec
+	telemetryDataPointsSentTotal  *prometheus.CounterVec
+	twinUpdateSuccessTotal        *prometheus.CounterVec
+	twinUpdateFailureTotal        *prometheus.CounterVec
+	twinUpdateSendLatency         *prometheus.HistogramVec
+	reportedPropsSkippedTotal     *prometheus.CounterVec
+	reportedPropsSuccessTotal     *prometheus.CounterVec
+	reportedPropsFailureTotal     *prometheus.CounterVec
+	reportedPropsSendLatency      *prometheus.HistogramVec
+	commandsSuccessTotal          *prometheus.CounterVec
+	desiredPropsDeliveryLatency   *prometheus.HistogramVec
+	twinVersionsOutOfOrderTotal   *prometheus.CounterVec
+	commandDeliveryLatency        *prometheus.HistogramVec
+
+	deliverySentTotal               *prometheus.CounterVec
+	deliveryVerifiedTotal           *prometheus.CounterVec
+	deliveryLostTotal               *prometheus.CounterVec
+	deliveryLossRatio               *prometheus.GaugeVec
+	deliveryIngestionLag            *prometheus.HistogramVec
+	deliveryVerificationErrorsTotal *prometheus.CounterVec
+
+	deviceConnectedGauge         *prometheus.GaugeVec
+	deviceEventsTotal            *prometheus.CounterVec
+	deviceTelemetryMessagesTotal *prometheus.CounterVec
+	deviceFailuresTotal          *prometheus.CounterVec
+)
+
+type (
+	// metricVec is a collector of series labelled with the simulation whose series can be deleted.
+	metricVec interface {
+		prometheus.Collector
+		Delete(labels prometheus.Labels) bool
+	}
 )
 
 // init initializes the metrics used in simulation
@@ -97,6 +123,28 @@ func init() {
 			Name:      "failure_total",
 			Help:      "Total devices failed provisioning",
 		},
+		[]string{"sim", "target", "model", "error"},
+	)
+
+	provisionRegistrationAttempts = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "starling",
+			Subsystem: "provisioning",
+			Name:      "registration_status_attempts",
+			Help:      "Number of registration status requests sent for a registration, whether it completed, failed or timed out",
+			Buckets:   []float64{1, 2, 3, 4, 5, 6, 8, 10, 15, 20},
+		},
+		[]string{"sim", "target", "model"},
+	)
+
+	provisionRetryAfter = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "starling",
+			Subsystem: "provisioning",
+			Name:      "retry_after_seconds",
+			Help:      "Backoff requested by DPS while a registration is in progress",
+			Buckets:   []float64{1, 2, 3, 5, 10, 20, 30, 60},
+		},
 		[]string{"sim", "target", "model"},
 	)
 
@@ -183,6 +231,16 @@ func init() {
 		[]string{"sim", "target", "model"},
 	)
 
+	billableMessageUnitsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "starling",
+			Subsystem: "simulating",
+			Name:      "billable_message_units_total",
+			Help:      "Total IoT Central billable message units of 4 KB sent by telemetry and property updates.",
+		},
+		[]string{"sim", "target", "model"},
+	)
+
 	telemetryDataPointsSentTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: "starling",
@@ -275,7 +333,147 @@ func init() {
 		[]string{"sim", "target", "model"},
 	)
 
-	prometheus.MustRegister(
+	desiredPropsDeliveryLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "starling",
+			Subsystem: "simulating",
+			Name:      "desired_props_delivery_latency_seconds",
+			Help:      "Latency of delivering desired property updates from IoT Central to the device",
+			Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 20, 30, 60, 120, 240, 480, 960},
+		},
+		[]string{"sim", "target", "model"},
+	)
+
+	twinVersionsOutOfOrderTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "starling",
+			Subsystem: "simulating",
+			Name:      "twin_versions_out_of_order_total",
+			Help:      "Total desired property updates received with a version not newer than the last update.",
+		},
+		[]string{"sim", "target", "model"},
+	)
+
+	commandDeliveryLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "starling",
+			Subsystem: "simulating",
+			Name:      "command_delivery_latency_seconds",
+			Help:      "Latency of delivering commands from IoT Central to the device",
+			Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 20, 30, 60, 120, 240, 480, 960},
+		},
+		[]string{"sim", "target", "model"},
+	)
+
+	deliverySentTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "starling",
+			Subsystem: "delivery",
+			Name:      "sent_total",
+			Help:      "Total telemetry messages sent by sampled devices awaiting verification in IoT Central.",
+		},
+		[]string{"sim", "target", "model"},
+	)
+
+	deliveryVerifiedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "starling",
+			Subsystem: "delivery",
+			Name:      "verified_total",
+			Help:      "Total telemetry messages of sampled devices found in IoT Central.",
+		},
+		[]string{"sim", "target", "model"},
+	)
+
+	deliveryLostTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "starling",
+			Subsystem: "delivery",
+			Name:      "lost_total",
+			Help:      "Total telemetry messages of sampled devices not found in IoT Central within the grace period.",
+		},
+		[]string{"sim", "target", "model"},
+	)
+
+	deliveryLossRatio = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "starling",
+			Subsystem: "delivery",
+			Name:      "loss_ratio",
+			Help:      "Ratio of verified telemetry messages of sampled devices that were lost.",
+		},
+		[]string{"sim", "target", "model"},
+	)
+
+	deliveryIngestionLag = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "starling",
+			Subsystem: "delivery",
+			Name:      "ingestion_lag_seconds",
+			Help:      "Time from sending a telemetry message until IoT Central ingested it",
+			Buckets:   []float64{1, 2.5, 5, 10, 20, 30, 60, 120, 240, 480, 960},
+		},
+		[]string{"sim", "target", "model"},
+	)
+
+	deliveryVerificationErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "starling",
+			Subsystem: "delivery",
+			Name:      "verification_errors_total",
+			Help:      "Total failures reading back telemetry from IoT Central.",
+		},
+		[]string{"sim", "target", "model"},
+	)
+
+	deviceConnectedGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "starling",
+			Subsystem: "device",
+			Name:      "connected",
+			Help:      "Whether the device is connected, only reported for simulations with device metrics.",
+		},
+		[]string{"sim", "target", "model", "device"},
+	)
+
+	deviceEventsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "starling",
+			Subsystem: "device",
+			Name:      "events_total",
+			Help:      "Total lifecycle events of the device by type, only reported for simulations with device metrics.",
+		},
+		[]string{"sim", "target", "model", "device", "type"},
+	)
+
+	deviceTelemetryMessagesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "starling",
+			Subsystem: "device",
+			Name:      "telemetry_messages_total",
+			Help:      "Total telemetry messages sent by the device, only reported for simulations with device metrics.",
+		},
+		[]string{"sim", "target", "model", "device"},
+	)
+
+	deviceFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "starling",
+			Subsystem: "device",
+			Name:      "failures_total",
+			Help:      "Total failed operations of the device by error type, only reported for simulations with device metrics.",
+		},
+		[]string{"sim", "target", "model", "device", "error"},
+	)
+
+	for _, vec := range metricVecs() {
+		prometheus.MustRegister(vec)
+	}
+}
+
+// metricVecs lists the collectors of the simulation metrics.
+func metricVecs() []metricVec {
+	return []metricVec{
 		simulatedDeviceGauge,
 		deviceConnectLatency,
 		connectedDeviceGauge,
@@ -283,6 +481,8 @@ func init() {
 		deviceFailoverTotal,
 		provisionSuccessTotal,
 		provisionFailuresTotal,
+		provisionRegistrationAttempts,
+		provisionRetryAfter,
 		provisionLatency,
 		telemetryBatchSuccessTotal,
 		telemetryBatchSkippedTotal,
@@ -291,6 +491,7 @@ func init() {
 		telemetryMessageFailureTotal,
 		telemetryMessageSendLatency,
 		telemetrySentBytes,
+		billableMessageUnitsTotal,
 		telemetryDataPointsSentTotal,
 		twinUpdateSuccessTotal,
 		twinUpdateFailureTotal,
@@ -300,5 +501,18 @@ func init() {
 		reportedPropsFailureTotal,
 		reportedPropsSendLatency,
 		commandsSuccessTotal,
-	)
+		desiredPropsDeliveryLatency,
+		twinVersionsOutOfOrderTotal,
+		commandDeliveryLatency,
+		deliverySentTotal,
+		deliveryVerifiedTotal,
+		deliveryLostTotal,
+		deliveryLossRatio,
+		deliveryIngestionLag,
+		deliveryVerificationErrorsTotal,
+		deviceConnectedGauge,
+		deviceEventsTotal,
+		deviceTelemetryMessagesTotal,
+		deviceFailuresTotal,
+	}
 }
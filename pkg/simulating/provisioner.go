@@ -6,13 +6,19 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/iot-for-all/starling/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog/log"
+	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/iot-for-all/starling/pkg/models"
+	"github.com/iot-for-all/starling/pkg/tracing"
 	"github.com/iot-for-all/starling/pkg/util"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type (
@@ -53,11 +59,34 @@ type (
 	// registrationResult is the result of the registration request
 	registrationResult struct {
 		RegistrationState struct {
-			AssignedHub string `json:"assignedHub"`
-			DeviceID    string `json:"deviceId"`
-			Status      string `json:"status"`
+			AssignedHub  string `json:"assignedHub"`
+			DeviceID     string `json:"deviceId"`
+			Status       string `json:"status"`
+			ErrorCode    int    `json:"errorCode"`
+			ErrorMessage string `json:"errorMessage"`
 		} `json:"registrationState"`
 	}
+
+	// registrationError is a request rejected by DPS or a registration DPS could not complete.
+	registrationError struct {
+		StatusCode int    // HTTP status code of the response, 0 if the registration itself failed.
+		ErrorCode  int    // DPS error code e.g. 401002, 0 if not reported.
+		Status     string // assignment status of a failed registration e.g. failed or disabled.
+		Message    string // error message reported by DPS.
+	}
+
+	// dpsErrorResponse is the body of an error response sent by DPS.
+	dpsErrorResponse struct {
+		ErrorCode int    `json:"errorCode"`
+		Message   string `json:"message"`
+	}
+)
+
+const (
+	// registrationStatusAssigned is the status of a registration that assigned the device to an IoT Hub.
+	registrationStatusAssigned = "assigned"
+	// registrationStatusDisabled is the status of a registration of a disabled enrollment or device.
+	registrationStatusDisabled = "disabled"
 )
 
 // NewProvisioner creates a new deviceProvisioner.
@@ -74,20 +103,30 @@ func NewProvisioner(ctx context.Context, cfg *config.SimulationConfig) *DevicePr
 }
 
 // Provision provisions a device in IoT Central
-func (p *DeviceProvisioner) Provision(req *ProvisioningRequest) *ProvisioningResponse {
+func (p *DeviceProvisioner) Provision(req *ProvisioningRequest) (*ProvisioningResponse, error) {
 	log.Trace().Str("deviceID", req.DeviceID).Msg("provisioning device")
 
+	// requests are cancelled with the provisioner, while the span continues the trace of the caller
+	ctx := p.context
+	if req.Context != nil {
+		ctx = trace.ContextWithSpan(ctx, trace.SpanFromContext(req.Context))
+	}
+	ctx, span := tracing.Start(ctx, "provision", req.Simulation.ID, req.Simulation.TargetID, req.Model.ID, req.DeviceID)
+	defer span.End()
+
 	key, err := util.ComputeHmac(req.Target.MasterKey, req.DeviceID)
 	if err != nil {
 		log.Error().Err(err).Str("deviceId", req.DeviceID).Msg("failed to compute device key for device")
-		return nil
+		tracing.Fail(span, err)
+		return nil, newDeviceError("provision", fmt.Errorf("failed to compute device key for device: %w", err))
 	}
 
 	keyRes := fmt.Sprintf("%s/registrations/%s", req.Target.IDScope, req.DeviceID)
 	token, err := util.CreateSasToken(key, keyRes, "registration", 1*time.Minute)
 	if err != nil {
 		log.Error().Err(err).Str("deviceId", req.DeviceID).Msg("failed to compute sas key for device")
-		return nil
+		tracing.Fail(span, err)
+		return nil, newDeviceError("provision", fmt.Errorf("failed to compute sas key for device: %w", err))
 	}
 
 	start := time.Now()
@@ -98,6 +137,7 @@ func (p *DeviceProvisioner) Provision(req *ProvisioningRequest) *ProvisioningRes
 	}
 
 	opdID, err := p.sendRegisterRequest(
+		ctx,
 		req.Target.ProvisioningURL,
 		req.Target.IDScope,
 		req.DeviceID,
@@ -106,24 +146,28 @@ func (p *DeviceProvisioner) Provision(req *ProvisioningRequest) *ProvisioningRes
 
 	if err != nil {
 		log.Error().Err(err).Str("deviceId", req.DeviceID).Msg("failed to register device")
-		provisionFailuresTotal.WithLabelValues(req.Simulation.ID, req.Simulation.TargetID, req.Model.ID).Add(1)
-		return nil
+		tracing.Fail(span, err)
+		return nil, p.fail(req, fmt.Errorf("failed to register device: %w", err))
 	}
 
 	log.Trace().Str("deviceID", req.DeviceID).Msg("checking registration status")
 
 	reg, err := p.getRegistrationStatus(
+		ctx,
 		req.Target.ProvisioningURL,
 		req.Target.IDScope,
 		req.DeviceID,
-		opdID, token)
+		opdID, token,
+		provisionRegistrationAttempts.WithLabelValues(req.Simulation.ID, req.Simulation.TargetID, req.Model.ID),
+		provisionRetryAfter.WithLabelValues(req.Simulation.ID, req.Simulation.TargetID, req.Model.ID))
 
 	if err != nil {
 		log.Error().Err(err).Str("deviceId", req.DeviceID).Msg("failed to get device registration result")
-		provisionFailuresTotal.WithLabelValues(req.Simulation.ID, req.Simulation.TargetID, req.Model.ID).Add(1)
-		return nil
+		tracing.Fail(span, err)
+		return nil, p.fail(req, fmt.Errorf("failed to get device registration result: %w", err))
 	}
 
+	span.SetAttributes(attribute.String("starling.hub", reg.RegistrationState.AssignedHub))
 	connStr := fmt.Sprintf("HostName=%s;DeviceId=%s;SharedAccessKey=%s",
 		reg.RegistrationState.AssignedHub,
 		req.DeviceID,
@@ -139,7 +183,7 @@ func (p *DeviceProvisioner) Provision(req *ProvisioningRequest) *ProvisioningRes
 	return &ProvisioningResponse{
 		ProvisioningRequest: req,
 		ConnectionString:    connStr,
-	}
+	}, nil
 }
 
 // sendRegisterRequest sends the registration request to DPS for registering the device
@@ -149,11 +193,15 @@ func (p *DeviceProvisioner) Provision(req *ProvisioningRequest) *ProvisioningRes
 // modelID is the id of the model to register the device as.
 // token is the shared access token used for authorization.
 func (p *DeviceProvisioner) sendRegisterRequest(
+	ctx context.Context,
 	host string,
 	idScope string,
 	deviceID string,
 	modelID string,
 	token string) (string, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "sendRegisterRequest")
+	defer span.End()
+
 	// todo: handle error conditions
 	// todo: handle retry
 	path := fmt.Sprintf("https://%s/%s/registrations/%s/register?api-version=2019-03-31", host, idScope, deviceID)
@@ -165,12 +213,12 @@ func (p *DeviceProvisioner) sendRegisterRequest(
 		},
 	})
 	if err != nil {
-		return "", fmt.Errorf("error creating device registration object (%s)", err.Error())
+		return "", fmt.Errorf("error creating device registration object: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(p.context, "PUT", path, bytes.NewReader(reqData))
+	req, err := http.NewRequestWithContext(ctx, "PUT", path, bytes.NewReader(reqData))
 	if err != nil {
-		return "", fmt.Errorf("error creating device registration request to DPS (%s)", err.Error())
+		return "", fmt.Errorf("error creating device registration request to DPS: %w", err)
 	}
 
 	req.Header.Add("Content-Type", "application/json")
@@ -179,28 +227,45 @@ func (p *DeviceProvisioner) sendRegisterRequest(
 
 	res, err := p.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("error sending device registration request to DPS (%s)", err.Error())
+		tracing.Fail(span, err)
+		return "", fmt.Errorf("error sending device registration request to DPS: %w", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+	span.SetAttributes(attribute.Int("http.status_code", res.StatusCode))
+
+	if res.StatusCode >= http.StatusBadRequest {
+		err = newRegistrationError(res)
+		tracing.Fail(span, err)
+		return "", err
 	}
 
 	var resData registrationResponse
 	err = json.NewDecoder(res.Body).Decode(&resData)
 	if err != nil {
-		return "", fmt.Errorf("error parsing device registration response from DPS (%s)", err.Error())
+		tracing.Fail(span, err)
+		return "", fmt.Errorf("error parsing device registration response from DPS: %w", err)
 	}
 
 	return resData.OperationID, nil
 }
 
 // getRegistrationStatus get the registration status of a registration request
+// attempts observes the number of status requests sent, whether the registration completed, failed or timed out.
+// retryAfter observes the backoff requested by DPS while the registration is in progress.
 func (p *DeviceProvisioner) getRegistrationStatus(
+	ctx context.Context,
 	host string,
 	idScope string,
 	deviceID string,
 	operationID string,
-	token string) (*registrationResult, error) {
+	token string,
+	attempts prometheus.Observer,
+	retryAfter prometheus.Observer) (*registrationResult, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "getRegistrationStatus")
+	defer span.End()
 
 	path := fmt.Sprintf("https://%s/%s/registrations/%s/operations/%s?api-version=2019-03-31", host, idScope, deviceID, operationID)
-	req, err := http.NewRequestWithContext(p.context, "GET", path, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", path, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -209,36 +274,131 @@ func (p *DeviceProvisioner) getRegistrationStatus(
 	req.Header.Add("Encoding", "utf-8")
 	req.Header.Add("Authorization", token)
 
+	// slow and failing registrations are counted too, so that they show in the distribution
+	sent := 0
+	defer func() {
+		attempts.Observe(float64(sent))
+		span.SetAttributes(attribute.Int("attempts", sent))
+	}()
+
 	for i := 1; i <= p.config.MaxRegistrationAttempts; i++ {
 		select {
-		case <-p.context.Done():
-			return nil, fmt.Errorf("operation cancelled")
+		case <-ctx.Done():
+			tracing.Fail(span, ctx.Err())
+			return nil, fmt.Errorf("operation cancelled: %w", ctx.Err())
 		default:
+			sent = i
 			res, err := p.client.Do(req)
 			if err != nil {
+				tracing.Fail(span, err)
+				return nil, err
+			}
+
+			if res.StatusCode >= http.StatusBadRequest {
+				err = newRegistrationError(res)
+				_ = res.Body.Close()
+				tracing.Fail(span, err)
 				return nil, err
 			}
 
 			if res.StatusCode == http.StatusAccepted {
+				_ = res.Body.Close()
 				backoff, err := strconv.Atoi(res.Header.Get("Retry-After"))
 				if err != nil {
 					backoff = 3
 				}
+				retryAfter.Observe(float64(backoff))
 
 				log.Trace().Str("deviceID", deviceID).Int("backoff", backoff).Int("attempt", i).Msg("Registration status")
+				span.AddEvent("registration pending", trace.WithAttributes(attribute.Int("attempt", i), attribute.Int("backoff", backoff)))
 				time.Sleep(time.Duration(backoff) * time.Second)
 				continue
 			}
 
 			var resData registrationResult
 			err = json.NewDecoder(res.Body).Decode(&resData)
+			_ = res.Body.Close()
 			if err != nil {
+				tracing.Fail(span, err)
 				return nil, err
 			}
 
+			span.SetAttributes(attribute.String("status", resData.RegistrationState.Status))
+
+			// the operation completes without assigning a hub when the registration failed or is disabled
+			state := resData.RegistrationState
+			if state.Status != registrationStatusAssigned {
+				err = &registrationError{ErrorCode: state.ErrorCode, Status: state.Status, Message: state.ErrorMessage}
+				tracing.Fail(span, err)
+				return nil, err
+			}
 			return &resData, nil
 		}
 	}
 
-	return nil, fmt.Errorf("failed to evaluate registration status. all retry attempts failed")
+	err = fmt.Errorf("failed to evaluate registration status. all retry attempts failed")
+	tracing.Fail(span, err)
+	return nil, err
+}
+
+// fail counts a failed provisioning request by its error type and remembers the reason of the failure.
+func (p *DeviceProvisioner) fail(req *ProvisioningRequest, err error) error {
+	de := newDeviceError("provision", err)
+	provisionFailuresTotal.WithLabelValues(req.Simulation.ID, req.Simulation.TargetID, req.Model.ID, string(de.Type)).Inc()
+	provisioningFailures.record(req.Simulation.ID, de)
+	return de
+}
+
+// newRegistrationError creates the error of a request rejected by DPS from its response.
+func newRegistrationError(res *http.Response) *registrationError {
+	e := &registrationError{StatusCode: res.StatusCode}
+	body, _ := ioutil.ReadAll(res.Body)
+	var dpsErr dpsErrorResponse
+	if err := json.Unmarshal(body, &dpsErr); err == nil {
+		e.ErrorCode = dpsErr.ErrorCode
+		e.Message = dpsErr.Message
+	} else {
+		e.Message = strings.TrimSpace(string(body))
+	}
+
+	return e
+}
+
+// Error describes the failure as reported by DPS.
+func (e *registrationError) Error() string {
+	msg := e.reason()
+	if len(e.Message) > 0 {
+		msg = fmt.Sprintf("%s: %s", msg, e.Message)
+	}
+
+	return msg
+}
+
+// reason summarizes the failure by its status and error code, leaving out the message which may contain ids.
+func (e *registrationError) reason() string {
+	var reason string
+	if e.StatusCode > 0 {
+		reason = fmt.Sprintf("DPS returned %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	} else {
+		reason = fmt.Sprintf("registration %s", e.Status)
+	}
+	if e.ErrorCode > 0 {
+		reason = fmt.Sprintf("%s (error code %d)", reason, e.ErrorCode)
+	}
+
+	return reason
+}
+
+// errorType classifies the failure. DPS error codes start with the HTTP status code they refine.
+func (e *registrationError) errorType() models.ErrorType {
+	switch {
+	case e.Status == registrationStatusDisabled:
+		return models.ErrorDeviceDisabled
+	case e.StatusCode == 0:
+		return models.ErrorRegistrationFailed
+	case e.ErrorCode >= 100000:
+		return statusErrorType(e.ErrorCode/1000, e.ErrorCode)
+	}
+
+	return statusErrorType(e.StatusCode, e.ErrorCode)
 }
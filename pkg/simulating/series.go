@@ -0,0 +1,158 @@
+package simulating
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/iot-for-all/starling/pkg/consuming"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rs/zerolog/log"
+)
+
+type (
+	// metricSeries tracks the custom labels of the simulations and the pending cleanups of the series of stopped
+	// simulations, so that the label sets of finished simulations do not pile up.
+	metricSeries struct {
+		sync.Mutex
+		labels   map[string]map[string]string // custom labels by simulation id.
+		cleanups map[string]*time.Timer       // pending series cleanups by simulation id.
+	}
+)
+
+var (
+	series = &metricSeries{
+		labels:   map[string]map[string]string{},
+		cleanups: map[string]*time.Timer{},
+	} // custom labels and pending cleanups of the simulation series
+
+	// Gatherer gathers the registered metrics, adding the custom labels of the simulation to every series
+	// labelled with a simulation that has custom labels.
+	Gatherer prometheus.Gatherer = prometheus.GathererFunc(series.gather)
+)
+
+// DeleteMetrics deletes all series of a simulation and forgets its custom labels.
+func DeleteMetrics(simulationID string) {
+	series.Lock()
+	if cleanup, ok := series.cleanups[simulationID]; ok {
+		cleanup.Stop()
+		delete(series.cleanups, simulationID)
+	}
+	delete(series.labels, simulationID)
+	series.Unlock()
+
+	deleteSeries(simulationID)
+}
+
+// keep cancels the pending cleanup of a simulation that starts running and applies its custom labels from now on.
+func (m *metricSeries) keep(simulationID string, labels map[string]string) {
+	m.Lock()
+	defer m.Unlock()
+
+	if cleanup, ok := m.cleanups[simulationID]; ok {
+		cleanup.Stop()
+		delete(m.cleanups, simulationID)
+	}
+
+	if len(labels) == 0 {
+		delete(m.labels, simulationID)
+		return
+	}
+	custom := make(map[string]string, len(labels))
+	for name, value := range labels {
+		custom[name] = value
+	}
+	m.labels[simulationID] = custom
+}
+
+// expire deletes the series of a stopped simulation once they were kept for the retention period, giving
+// Prometheus the time to scrape their final values. Series are kept until the simulation is deleted if the
+// retention is not positive.
+func (m *metricSeries) expire(simulationID string, retention time.Duration) {
+	if retention <= 0 {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if cleanup, ok := m.cleanups[simulationID]; ok {
+		cleanup.Stop()
+	}
+
+	var cleanup *time.Timer
+	cleanup = time.AfterFunc(retention, func() {
+		m.Lock()
+		if m.cleanups[simulationID] != cleanup {
+			// the simulation was started again or deleted in the meantime
+			m.Unlock()
+			return
+		}
+		delete(m.cleanups, simulationID)
+		delete(m.labels, simulationID)
+		m.Unlock()
+
+		deleteSeries(simulationID)
+		log.Debug().Str("simID", simulationID).Msg("deleted metrics of stopped simulation")
+	})
+	m.cleanups[simulationID] = cleanup
+}
+
+// gather gathers the registered metrics and adds the custom labels of the simulations to their series.
+func (m *metricSeries) gather() ([]*dto.MetricFamily, error) {
+	families, err := prometheus.DefaultGatherer.Gather()
+
+	m.Lock()
+	defer m.Unlock()
+	if len(m.labels) == 0 {
+		return families, err
+	}
+
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			var custom map[string]string
+			present := make(map[string]bool, len(metric.GetLabel()))
+			for _, lp := range metric.GetLabel() {
+				present[lp.GetName()] = true
+				if lp.GetName() == "sim" {
+					custom = m.labels[lp.GetValue()]
+				}
+			}
+			if len(custom) == 0 {
+				continue
+			}
+
+			for name, value := range custom {
+				if present[name] {
+					continue
+				}
+				name, value := name, value
+				metric.Label = append(metric.Label, &dto.LabelPair{Name: &name, Value: &value})
+			}
+			sort.Slice(metric.Label, func(i, j int) bool { return metric.Label[i].GetName() < metric.Label[j].GetName() })
+		}
+	}
+
+	return families, err
+}
+
+// deleteSeries deletes the series of a simulation from all simulation metrics, including the metrics of the consumer
+// and the sequence numbers of its devices.
+func deleteSeries(simulationID string) {
+	vecs := metricVecs()
+	for _, vec := range consuming.SimulationMetrics() {
+		vecs = append(vecs, vec)
+	}
+
+	for _, vec := range vecs {
+		var stale []prometheus.Labels
+		collect(vec, simulationID, func(labels map[string]string, _ *dto.Metric) {
+			stale = append(stale, labels)
+		})
+		for _, labels := range stale {
+			vec.Delete(labels)
+		}
+	}
+	consuming.ResetSequences(simulationID)
+}
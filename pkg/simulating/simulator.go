@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"github.com/iot-for-all/starling/pkg/config"
+	"github.com/iot-for-all/starling/pkg/consuming"
+	"github.com/iot-for-all/starling/pkg/eventing"
 	"github.com/rs/zerolog/log"
 	"math/rand"
 	"runtime"
@@ -15,6 +17,11 @@ import (
 	dto "github.com/prometheus/client_model/go"
 )
 
+const (
+	// eventInterval is the interval at which device activity is published to simulation event subscribers.
+	eventInterval = 5 * time.Second
+)
+
 type (
 	// Simulator simulates a number of devices connecting to IoT Central
 	Simulator struct {
@@ -38,6 +45,8 @@ type (
 		provisioner *DeviceProvisioner
 		// the device simulator handling simulation of deviceSimulator.
 		deviceSimulator *deviceSimulator
+		// whether the projected message usage was reported to exceed the budget.
+		budgetWarned bool
 	}
 )
 
@@ -72,6 +81,15 @@ func Start(
 		simulatedDeviceGauge.WithLabelValues(simulation.ID, simulation.TargetID, deviceConfig.ModelID).Set(float64(deviceConfig.DeviceCount))
 	}
 
+	// sequence numbers of the devices start over
+	consuming.ResetSequences(simulation.ID)
+
+	// the device journals start over
+	journal.reset(simulation.ID, config.DeviceJournalSize)
+
+	// series of the previous run are kept and labelled with the current custom labels
+	series.keep(simulation.ID, simulation.Labels)
+
 	simContext, cancel := context.WithCancel(ctx)
 	simulator := &Simulator{
 		cancel:          cancel,
@@ -86,6 +104,8 @@ func Start(
 		deviceSimulator: newDeviceSimulator(simContext, config, simulation),
 	}
 
+	simulator.enableDeviceMetrics()
+
 	// distribute all the devices into groups
 	simulator.distributeDeviceGroups()
 
@@ -116,9 +136,27 @@ func (s *Simulator) start() {
 		Str("simID", s.simulation.ID).
 		Msg("starting simulation")
 
+	// append device lifecycle events to the journal file
+	if len(s.config.DeviceJournalFile) > 0 {
+		journal.startSink(s.context, s.simulation.ID, s.config.DeviceJournalFile)
+	}
+
+	// warn if the configured rates would exceed the message budget
+	s.checkPlannedBudget()
+
 	// start device simulator
 	s.deviceSimulator.start(totalDevices)
 
+	// start verifying the delivery of telemetry before any is sent
+	if s.config.EnableTelemetry && s.simulation.VerifyDelivery != nil {
+		devices := make([]*device, 0, totalDevices)
+		for _, devs := range s.deviceGroups {
+			devices = append(devices, devs.devices...)
+		}
+		s.deviceSimulator.verifier = newDeliveryVerifier(s.context, s.simulation, s.target, devices)
+		go s.deviceSimulator.verifier.start()
+	}
+
 	// start telemetry request generator pump
 	if s.config.EnableTelemetry {
 		go s.startTelemetryRequestPump()
@@ -129,6 +167,12 @@ func (s *Simulator) start() {
 		go s.startReportedPropertyRequestPump()
 	}
 
+	// start the pump publishing device activity to the simulation event subscribers
+	go s.startEventPump()
+
+	// start the pump keeping recent metrics for the summary
+	go s.startSummaryPump()
+
 	// update the status of simulation
 	if err := updateSimulationStatus(s.simulation, models.SimulationStatusRunning); err != nil {
 		log.Error().Err(err).Msg("error updating simulation status")
@@ -266,6 +310,42 @@ func (s *Simulator) startReportedPropertyRequestPump() {
 	}
 }
 
+// startEventPump periodically publishes the connected device counts and the errors encountered by the devices
+func (s *Simulator) startEventPump() {
+	for {
+		select {
+		case <-s.context.Done():
+			return
+		case <-time.After(eventInterval):
+			connects, disconnects, errors := s.deviceSimulator.activity.reset()
+			if !eventing.HasSubscribers(s.simulation.ID) {
+				continue
+			}
+
+			connected := 0
+			for modelID := range s.models {
+				connected += s.GetConnectedDeviceCount(modelID)
+			}
+
+			eventing.Publish(&models.SimulationEvent{
+				SimulationID: s.simulation.ID,
+				Type:         models.SimulationEventConnections,
+				Connected:    connected,
+				Connects:     connects,
+				Disconnects:  disconnects,
+			})
+
+			if len(errors) > 0 {
+				eventing.Publish(&models.SimulationEvent{
+					SimulationID: s.simulation.ID,
+					Type:         models.SimulationEventErrors,
+					Errors:       errors,
+				})
+			}
+		}
+	}
+}
+
 // Stop stops the simulation
 func (s *Simulator) Stop() error {
 	// update the status of simulation
@@ -287,6 +367,9 @@ func (s *Simulator) Stop() error {
 		}
 	}
 
+	// the series of the stopped simulation are deleted once Prometheus had the time to scrape their final values
+	series.expire(s.simulation.ID, time.Duration(s.config.MetricsRetention)*time.Second)
+
 	// update the status of simulation
 	if err := updateSimulationStatus(s.simulation, models.SimulationStatusReady); err != nil {
 		return err
@@ -327,13 +410,7 @@ func (s *Simulator) distributeDeviceGroups() {
 	// go over all device models and divide all devices into wave groups based on above calculations
 	for _, deviceCfg := range s.deviceConfigs {
 		model := s.models[deviceCfg.ModelID]
-		for i := 1; i <= deviceCfg.DeviceCount; i++ {
-			deviceID := fmt.Sprintf("%s-%s-%s-%d",
-				s.simulation.ID,
-				s.target.ID,
-				deviceCfg.ID,
-				i)
-
+		for _, simDevice := range s.simulatedDevices(deviceCfg) {
 			group := devicesAdded / devicesPerWave
 			if group > waveGroupCount {
 				// handle odd cases; e.g.: total devices = 7, wave groups = 2, device #7 should be part of wave group 2
@@ -346,7 +423,8 @@ func (s *Simulator) distributeDeviceGroups() {
 
 			deviceContext, deviceCancel := context.WithCancel(s.context)
 			d := device{
-				deviceID:                deviceID,
+				deviceID:                simDevice.DeviceID,
+				index:                   simDevice.Index,
 				model:                   model,
 				target:                  s.target,
 				connectionString:        "",
@@ -371,6 +449,48 @@ func (s *Simulator) distributeDeviceGroups() {
 	}
 }
 
+// simulatedDevices picks the devices to simulate for the device config. Devices that are already provisioned
+// are simulated first; the remaining ones are named after the device config and get provisioned when they connect.
+func (s *Simulator) simulatedDevices(deviceCfg *models.SimulationDeviceConfig) []models.SimulationTargetDevice {
+	provisioned, err := storing.TargetDevices.ListByModel(s.target.ID, s.simulation.ID, deviceCfg.ModelID)
+	if err != nil {
+		log.Error().Err(err).Str("simID", s.simulation.ID).Str("modelID", deviceCfg.ModelID).Msg("error listing provisioned devices")
+		provisioned = nil
+	}
+
+	devices := make([]models.SimulationTargetDevice, 0, deviceCfg.DeviceCount)
+	used := make(map[string]bool, len(provisioned))
+	maxDeviceIndex := 0
+	for _, d := range provisioned {
+		used[d.DeviceID] = true
+		if maxDeviceIndex < d.DeviceIndex() {
+			maxDeviceIndex = d.DeviceIndex()
+		}
+		if len(devices) < deviceCfg.DeviceCount {
+			devices = append(devices, models.SimulationTargetDevice{DeviceID: d.DeviceID, Index: d.DeviceIndex()})
+		}
+	}
+
+	// explicit device ids are used in order skipping the ones already provisioned
+	index := maxDeviceIndex
+	if deviceCfg.MaxDevices() >= 0 {
+		index = 0
+	}
+	for len(devices) < deviceCfg.DeviceCount {
+		index++
+		deviceID := deviceCfg.DeviceID(s.simulation.ID, s.target.ID, index)
+		if len(deviceID) == 0 {
+			break
+		}
+		if used[deviceID] {
+			continue
+		}
+		devices = append(devices, models.SimulationTargetDevice{DeviceID: deviceID, Index: index})
+	}
+
+	return devices
+}
+
 // sleep sleeps for the given duration with cancellation context
 func sleep(ctx context.Context, duration time.Duration) {
 	select {
@@ -391,5 +511,10 @@ func updateSimulationStatus(simulation *models.Simulation, status models.Simulat
 	simulation.LastUpdatedTime = time.Now()
 
 	err := storing.Simulations.Set(simulation)
-	return err
+	if err != nil {
+		return err
+	}
+
+	eventing.PublishStatus(simulation)
+	return nil
 }
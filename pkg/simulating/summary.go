@@ -0,0 +1,399 @@
+package simulating
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/iot-for-all/starling/pkg/models"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	// summaryInterval is the interval at which the metrics of running simulations are sampled.
+	summaryInterval = 5 * time.Second
+	// summarySamples is the number of samples kept per simulation, a rolling window of five minutes.
+	summarySamples = 60
+)
+
+type (
+	// histogramSnapshot is the state of a latency histogram at some point in time.
+	histogramSnapshot struct {
+		bounds []float64 // upper bounds of the buckets.
+		counts []float64 // cumulative number of observations per bucket.
+		count  float64   // total number of observations.
+		sum    float64   // sum of all observations.
+	}
+
+	// modelSnapshot is the state of the metrics of a model at some point in time.
+	modelSnapshot struct {
+		devices    float64                       // number of devices simulated.
+		connected  float64                       // number of devices connected.
+		counters   map[string]float64            // counters by name.
+		errors     map[string]map[string]float64 // failures by operation and error type.
+		histograms map[string]*histogramSnapshot // latency histograms by operation.
+	}
+
+	// metricsSnapshot is the state of the metrics of a simulation at some point in time.
+	metricsSnapshot struct {
+		time   time.Time                 // when the snapshot was taken.
+		models map[string]*modelSnapshot // metrics by model id.
+	}
+
+	// metricsHistory keeps a rolling window of metric snapshots per simulation.
+	metricsHistory struct {
+		sync.Mutex
+		samples map[string][]*metricsSnapshot // snapshots by simulation id, oldest first.
+	}
+)
+
+var (
+	history = &metricsHistory{samples: map[string][]*metricsSnapshot{}} // recent metric snapshots of the simulations
+)
+
+// summaryCounters lists the counters included in the summary by name.
+func summaryCounters() map[string]*prometheus.CounterVec {
+	return map[string]*prometheus.CounterVec{
+		"provisionSuccess":        provisionSuccessTotal,
+		"provisionFailures":       provisionFailuresTotal,
+		"deviceFailovers":         deviceFailoverTotal,
+		"telemetryBatchesSent":    telemetryBatchSuccessTotal,
+		"telemetryBatchesSkipped": telemetryBatchSkippedTotal,
+		"telemetryMessagesSent":   telemetryMessageSuccessTotal,
+		"telemetryMessagesFailed": telemetryMessageFailureTotal,
+		"telemetryBytesSent":      telemetrySentBytes,
+		"telemetryDataPointsSent": telemetryDataPointsSentTotal,
+		"billableMessageUnits":    billableMessageUnitsTotal,
+		"twinUpdatesSent":         twinUpdateSuccessTotal,
+		"twinUpdatesFailed":       twinUpdateFailureTotal,
+		"reportedPropsSent":       reportedPropsSuccessTotal,
+		"reportedPropsFailed":     reportedPropsFailureTotal,
+		"reportedPropsSkipped":    reportedPropsSkippedTotal,
+		"commandsReceived":        commandsSuccessTotal,
+		"twinVersionsOutOfOrder":  twinVersionsOutOfOrderTotal,
+	}
+}
+
+// summaryErrors lists the counters of failures by error type included in the summary by operation.
+func summaryErrors() map[string]*prometheus.CounterVec {
+	return map[string]*prometheus.CounterVec{
+		"provision":     provisionFailuresTotal,
+		"telemetry":     telemetryMessageFailureTotal,
+		"twinUpdate":    twinUpdateFailureTotal,
+		"reportedProps": reportedPropsFailureTotal,
+	}
+}
+
+// summaryHistograms lists the latency histograms included in the summary by operation.
+func summaryHistograms() map[string]*prometheus.HistogramVec {
+	return map[string]*prometheus.HistogramVec{
+		"connect":              deviceConnectLatency,
+		"provision":            provisionLatency,
+		"telemetryBatchSend":   telemetryBatchSendLatency,
+		"telemetrySend":        telemetryMessageSendLatency,
+		"twinUpdateSend":       twinUpdateSendLatency,
+		"reportedPropsSend":    reportedPropsSendLatency,
+		"desiredPropsDelivery": desiredPropsDeliveryLatency,
+		"commandDelivery":      commandDeliveryLatency,
+	}
+}
+
+// Summary summarizes the current metrics of a simulation. Rates and latencies cover the samples kept
+// while the simulation was running; totals are read from the collectors directly.
+func Summary(simulationID string) *models.SimulationMetricsSummary {
+	now := snapshotMetrics(simulationID)
+
+	history.Lock()
+	samples := append([]*metricsSnapshot{}, history.samples[simulationID]...)
+	history.Unlock()
+
+	summary := &models.SimulationMetricsSummary{
+		SimulationID: simulationID,
+		Time:         now.time,
+		Models:       []models.ModelMetricsSummary{},
+		Samples:      []models.MetricsSample{},
+	}
+
+	var base *metricsSnapshot
+	if len(samples) > 0 {
+		base = samples[0]
+		summary.Window = now.time.Sub(base.time).Seconds()
+	}
+
+	for modelID, ms := range now.models {
+		mm := models.ModelMetricsSummary{
+			ModelID:   modelID,
+			Devices:   ms.devices,
+			Connected: ms.connected,
+			Totals:    ms.counters,
+			Rates:     map[string]float64{},
+			Errors:    ms.errors,
+			Latency:   map[string]models.Percentiles{},
+		}
+
+		var previous *modelSnapshot
+		if base != nil {
+			previous = base.models[modelID]
+		}
+		for name, value := range ms.counters {
+			if summary.Window > 0 {
+				mm.Rates[name] = (value - previous.counter(name)) / summary.Window
+			}
+		}
+		for name, h := range ms.histograms {
+			mm.Latency[name] = h.since(previous.histogram(name)).percentiles()
+		}
+
+		summary.Models = append(summary.Models, mm)
+	}
+	sort.Slice(summary.Models, func(i, j int) bool { return summary.Models[i].ModelID < summary.Models[j].ModelID })
+
+	samples = append(samples, now)
+	for i := 1; i < len(samples); i++ {
+		summary.Samples = append(summary.Samples, sample(samples[i-1], samples[i]))
+	}
+
+	return summary
+}
+
+// startSummaryPump samples the metrics of the simulation until it is stopped. The samples are kept
+// after the simulation stopped so that its last minutes can still be summarized.
+func (s *Simulator) startSummaryPump() {
+	history.Lock()
+	history.samples[s.simulation.ID] = []*metricsSnapshot{snapshotMetrics(s.simulation.ID)}
+	history.Unlock()
+
+	for i := 1; ; i++ {
+		select {
+		case <-s.context.Done():
+			return
+		case <-time.After(summaryInterval):
+			snapshot := snapshotMetrics(s.simulation.ID)
+
+			history.Lock()
+			samples := append(history.samples[s.simulation.ID], snapshot)
+			if len(samples) > summarySamples {
+				samples = samples[len(samples)-summarySamples:]
+			}
+			history.samples[s.simulation.ID] = samples
+			history.Unlock()
+
+			if i%budgetCheckSamples == 0 {
+				s.checkBudget()
+			}
+		}
+	}
+}
+
+// sample computes the throughput and latency of the whole simulation between two snapshots.
+func sample(from *metricsSnapshot, to *metricsSnapshot) models.MetricsSample {
+	s := models.MetricsSample{Time: to.time}
+	seconds := to.time.Sub(from.time).Seconds()
+
+	latency := &histogramSnapshot{}
+	for modelID, ms := range to.models {
+		previous := from.models[modelID]
+		s.Connected += ms.connected
+		if seconds > 0 {
+			s.TelemetryRate += (ms.counter("telemetryMessagesSent") - previous.counter("telemetryMessagesSent")) / seconds
+			for _, name := range []string{"telemetryMessagesFailed", "twinUpdatesFailed", "reportedPropsFailed", "provisionFailures"} {
+				s.ErrorRate += (ms.counter(name) - previous.counter(name)) / seconds
+			}
+		}
+		latency.add(ms.histogram("telemetrySend").since(previous.histogram("telemetrySend")))
+	}
+
+	p := latency.percentiles()
+	s.TelemetryLatencyP50 = p.P50
+	s.TelemetryLatencyP99 = p.P99
+	return s
+}
+
+// snapshotMetrics reads the current values of the collectors for a simulation.
+func snapshotMetrics(simulationID string) *metricsSnapshot {
+	snapshot := &metricsSnapshot{
+		time:   time.Now(),
+		models: map[string]*modelSnapshot{},
+	}
+	model := func(labels map[string]string) *modelSnapshot {
+		ms, ok := snapshot.models[labels["model"]]
+		if !ok {
+			ms = &modelSnapshot{
+				counters:   map[string]float64{},
+				errors:     map[string]map[string]float64{},
+				histograms: map[string]*histogramSnapshot{},
+			}
+			snapshot.models[labels["model"]] = ms
+		}
+		return ms
+	}
+
+	collect(simulatedDeviceGauge, simulationID, func(labels map[string]string, m *dto.Metric) {
+		model(labels).devices += m.GetGauge().GetValue()
+	})
+	collect(connectedDeviceByModelGauge, simulationID, func(labels map[string]string, m *dto.Metric) {
+		model(labels).connected += m.GetGauge().GetValue()
+	})
+	for name, c := range summaryCounters() {
+		name := name
+		collect(c, simulationID, func(labels map[string]string, m *dto.Metric) {
+			model(labels).counters[name] += m.GetCounter().GetValue()
+		})
+	}
+	for op, c := range summaryErrors() {
+		op := op
+		collect(c, simulationID, func(labels map[string]string, m *dto.Metric) {
+			ms := model(labels)
+			if _, ok := ms.errors[op]; !ok {
+				ms.errors[op] = map[string]float64{}
+			}
+			ms.errors[op][labels["error"]] += m.GetCounter().GetValue()
+		})
+	}
+	for name, h := range summaryHistograms() {
+		name := name
+		collect(h, simulationID, func(labels map[string]string, m *dto.Metric) {
+			ms := model(labels)
+			hs, ok := ms.histograms[name]
+			if !ok {
+				hs = &histogramSnapshot{}
+				ms.histograms[name] = hs
+			}
+			hs.add(newHistogramSnapshot(m.GetHistogram()))
+		})
+	}
+
+	return snapshot
+}
+
+// collect hands the metrics of a collector belonging to the simulation to the callback along with their labels.
+func collect(c prometheus.Collector, simulationID string, fn func(labels map[string]string, m *dto.Metric)) {
+	ch := make(chan prometheus.Metric, 64)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+
+	for metric := range ch {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			continue
+		}
+		labels := make(map[string]string, len(m.GetLabel()))
+		for _, l := range m.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		if labels["sim"] == simulationID {
+			fn(labels, &m)
+		}
+	}
+}
+
+// counter returns the value of a counter, zero if the snapshot or counter does not exist.
+func (ms *modelSnapshot) counter(name string) float64 {
+	if ms == nil {
+		return 0
+	}
+
+	return ms.counters[name]
+}
+
+// histogram returns a latency histogram, nil if the snapshot or histogram does not exist.
+func (ms *modelSnapshot) histogram(name string) *histogramSnapshot {
+	if ms == nil {
+		return nil
+	}
+
+	return ms.histograms[name]
+}
+
+// newHistogramSnapshot copies the state of a histogram.
+func newHistogramSnapshot(h *dto.Histogram) *histogramSnapshot {
+	hs := &histogramSnapshot{
+		count: float64(h.GetSampleCount()),
+		sum:   h.GetSampleSum(),
+	}
+	for _, b := range h.GetBucket() {
+		hs.bounds = append(hs.bounds, b.GetUpperBound())
+		hs.counts = append(hs.counts, float64(b.GetCumulativeCount()))
+	}
+
+	return hs
+}
+
+// add adds the observations of another histogram with the same buckets.
+func (h *histogramSnapshot) add(other *histogramSnapshot) {
+	if other == nil {
+		return
+	}
+	if len(h.bounds) == 0 {
+		h.bounds = append([]float64{}, other.bounds...)
+		h.counts = make([]float64, len(other.counts))
+	}
+	for i := range h.counts {
+		if i < len(other.counts) {
+			h.counts[i] += other.counts[i]
+		}
+	}
+	h.count += other.count
+	h.sum += other.sum
+}
+
+// since returns the observations made after the earlier snapshot of the same histogram.
+func (h *histogramSnapshot) since(earlier *histogramSnapshot) *histogramSnapshot {
+	if h == nil {
+		return nil
+	}
+	if earlier == nil {
+		return h
+	}
+
+	delta := &histogramSnapshot{
+		bounds: h.bounds,
+		counts: make([]float64, len(h.counts)),
+		count:  h.count - earlier.count,
+		sum:    h.sum - earlier.sum,
+	}
+	for i := range h.counts {
+		delta.counts[i] = h.counts[i]
+		if i < len(earlier.counts) {
+			delta.counts[i] -= earlier.counts[i]
+		}
+	}
+
+	return delta
+}
+
+// percentiles estimates the percentiles by interpolating linearly within the buckets.
+func (h *histogramSnapshot) percentiles() models.Percentiles {
+	if h == nil || h.count <= 0 {
+		return models.Percentiles{}
+	}
+
+	return models.Percentiles{
+		Count: h.count,
+		Mean:  h.sum / h.count,
+		P50:   h.quantile(0.5),
+		P90:   h.quantile(0.9),
+		P99:   h.quantile(0.99),
+	}
+}
+
+// quantile estimates the given quantile, observations beyond the last bucket are capped at its upper bound.
+func (h *histogramSnapshot) quantile(q float64) float64 {
+	rank := q * h.count
+	lower, below := 0.0, 0.0
+	for i, bound := range h.bounds {
+		if h.counts[i] >= rank {
+			inBucket := h.counts[i] - below
+			if inBucket <= 0 {
+				return bound
+			}
+			return lower + (bound-lower)*(rank-below)/inBucket
+		}
+		lower, below = bound, h.counts[i]
+	}
+
+	return lower
+}
@@ -0,0 +1,280 @@
+package simulating
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/iot-for-all/starling/pkg/central"
+	"github.com/iot-for-all/starling/pkg/consuming"
+	"github.com/iot-for-all/starling/pkg/models"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// defaultVerificationSampleSize is the number of devices verified when not configured.
+	defaultVerificationSampleSize = 5
+	// defaultVerificationInterval is the interval in seconds between reading back telemetry when not configured.
+	defaultVerificationInterval = 60
+	// defaultVerificationGrace is the time in seconds after which telemetry is counted as lost when not configured.
+	defaultVerificationGrace = 300
+
+	// maxVerificationRows limits the number of rows read back for a device at once.
+	maxVerificationRows = 1000
+	// maxPendingMessages limits the number of messages awaiting verification per device.
+	maxPendingMessages = 10000
+)
+
+// queryableDeviceID matches the device ids that can be quoted in a query, so an id cannot change the query.
+var queryableDeviceID = regexp.MustCompile(`^[A-Za-z0-9\-.:_]+$`)
+
+type (
+	// deliveryVerifier verifies that telemetry sent by a sample of the simulated devices arrives in IoT Central
+	// by reading it back through the query API. It reports the ingestion lag and the ratio of lost messages.
+	deliveryVerifier struct {
+		sync.Mutex
+		context    context.Context                // the context of the simulation.
+		simulation *models.Simulation             // the simulation being verified.
+		target     *models.SimulationTarget       // the target application telemetry is read back from.
+		client     *central.Client                // client of the IoT Central REST API of the target.
+		interval   time.Duration                  // interval between reading back telemetry.
+		grace      time.Duration                  // time after which telemetry not found in IoT Central is lost.
+		devices    map[string]*verifiedDevice     // sampled devices by device id.
+		totals     map[string]*verificationTotals // verified and lost messages by model id.
+	}
+
+	// verifiedDevice tracks the messages of a sampled device that have not been found in IoT Central yet.
+	verifiedDevice struct {
+		device     *device           // the sampled device.
+		templateID string            // device template of the device in IoT Central, used to query its telemetry.
+		pending    map[int]time.Time // send time of the messages awaiting verification by sequence number.
+	}
+
+	// verificationTotals counts the verified and lost messages of a model.
+	verificationTotals struct {
+		verified int // number of messages found in IoT Central.
+		lost     int // number of messages not found in IoT Central within the grace period.
+	}
+)
+
+// newDeliveryVerifier creates a verifier for a random sample of the given devices.
+func newDeliveryVerifier(ctx context.Context, simulation *models.Simulation, target *models.SimulationTarget, devices []*device) *deliveryVerifier {
+	cfg := simulation.VerifyDelivery
+	sampleSize := cfg.SampleSize
+	if sampleSize <= 0 {
+		sampleSize = defaultVerificationSampleSize
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = defaultVerificationInterval
+	}
+	grace := cfg.Grace
+	if grace <= 0 {
+		grace = defaultVerificationGrace
+	}
+
+	v := &deliveryVerifier{
+		context:    ctx,
+		simulation: simulation,
+		target:     target,
+		client:     central.NewClient(target),
+		interval:   time.Duration(interval) * time.Second,
+		grace:      time.Duration(grace) * time.Second,
+		devices:    make(map[string]*verifiedDevice),
+		totals:     make(map[string]*verificationTotals),
+	}
+
+	for _, i := range rand.Perm(len(devices)) {
+		if len(v.devices) >= sampleSize {
+			break
+		}
+		d := devices[i]
+		v.devices[d.deviceID] = &verifiedDevice{
+			device:  d,
+			pending: make(map[int]time.Time),
+		}
+		if _, ok := v.totals[d.model.ID]; !ok {
+			v.totals[d.model.ID] = &verificationTotals{}
+		}
+	}
+
+	return v
+}
+
+// recordSent remembers a message sent successfully by a device so that it can be looked up in IoT Central.
+// Messages of devices that are not part of the sample are ignored.
+func (v *deliveryVerifier) recordSent(d *device, sequenceNumber int, sentTime time.Time) {
+	v.Lock()
+	defer v.Unlock()
+
+	vd, ok := v.devices[d.deviceID]
+	if !ok || len(vd.pending) >= maxPendingMessages {
+		return
+	}
+
+	vd.pending[sequenceNumber] = sentTime
+	consuming.RecordSent(v.simulation.ID, v.target.ID, d.model.ID, d.deviceID, sequenceNumber)
+	deliverySentTotal.WithLabelValues(v.simulation.ID, v.target.ID, d.model.ID).Inc()
+}
+
+// start periodically reads back the telemetry of the sampled devices until the simulation is stopped.
+func (v *deliveryVerifier) start() {
+	log.Debug().
+		Str("simID", v.simulation.ID).
+		Int("devices", len(v.devices)).
+		Dur("interval", v.interval).
+		Dur("grace", v.grace).
+		Msg("delivery verification starting")
+
+	for {
+		select {
+		case <-v.context.Done():
+			return
+		case <-time.After(v.interval):
+			for _, vd := range v.devices {
+				if v.context.Err() != nil {
+					return
+				}
+				if err := v.verify(vd); err != nil {
+					deliveryVerificationErrorsTotal.WithLabelValues(v.simulation.ID, v.target.ID, vd.device.model.ID).Inc()
+					log.Error().
+						Err(err).
+						Str("simID", v.simulation.ID).
+						Str("deviceID", vd.device.deviceID).
+						Msg("error verifying telemetry delivery")
+				}
+			}
+		}
+	}
+}
+
+// verify looks up the pending messages of a device in IoT Central. Messages found are verified and their lag is
+// measured from sending them until IoT Central stamped them with $ts. Messages are lost when IoT Central has ingested
+// telemetry of the device sent more than the grace period after them, or when they fall out of the query window.
+func (v *deliveryVerifier) verify(vd *verifiedDevice) error {
+	v.Lock()
+	first := -1
+	for seq := range vd.pending {
+		if first < 0 || seq < first {
+			first = seq
+		}
+	}
+	v.Unlock()
+
+	if first < 0 {
+		return nil
+	}
+
+	if !queryableDeviceID.MatchString(vd.device.deviceID) {
+		return fmt.Errorf("device id '%s' cannot be queried in Central, only letters, digits, '-', '.', ':' and '_' are supported", vd.device.deviceID)
+	}
+
+	if len(vd.templateID) == 0 {
+		cd, err := v.client.GetDevice(v.context, vd.device.deviceID)
+		if err != nil {
+			return err
+		}
+		if len(cd.Template) == 0 {
+			return fmt.Errorf("device '%s' has no device template in Central", vd.device.deviceID)
+		}
+		vd.templateID = cd.Template
+	}
+
+	// only look back as far as messages can be pending
+	window := v.grace + v.interval
+	query := fmt.Sprintf("SELECT TOP %d $id, $ts, %s, %s FROM %s WHERE WITHIN_WINDOW(PT%dS) AND $id = '%s' AND %s >= %d",
+		maxVerificationRows, consuming.SequenceField, consuming.SentTimeField, vd.templateID,
+		int(window.Seconds()), vd.device.deviceID, consuming.SequenceField, first)
+	rows, err := v.client.Query(v.context, query)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	modelID := vd.device.model.ID
+
+	v.Lock()
+	defer v.Unlock()
+
+	// rows of messages verified in earlier rounds are read again, so only pending messages are observed
+	totals := v.totals[modelID]
+	verified := 0
+	observed := make(map[int]bool)
+	var ingested time.Time
+	for _, row := range rows {
+		value, ok := row[consuming.SequenceField].(float64)
+		if !ok {
+			continue
+		}
+		seq := int(value)
+		ts := ingestionTime(row)
+		if ts.After(ingested) {
+			ingested = ts
+		}
+		if observed[seq] {
+			consuming.Observe(consuming.SinkVerifier, v.simulation.ID, vd.device.deviceID, seq)
+			continue
+		}
+		sentTime, ok := vd.pending[seq]
+		if !ok {
+			continue
+		}
+		delete(vd.pending, seq)
+		observed[seq] = true
+		verified++
+		consuming.Observe(consuming.SinkVerifier, v.simulation.ID, vd.device.deviceID, seq)
+		if ts.IsZero() {
+			ts = now
+		}
+		lag := ts.Sub(sentTime)
+		if lag < 0 {
+			// the clocks of Starling and IoT Central differ
+			lag = 0
+		}
+		deliveryIngestionLag.WithLabelValues(v.simulation.ID, v.target.ID, modelID).Observe(lag.Seconds())
+	}
+
+	lost := 0
+	for seq, sentTime := range vd.pending {
+		if ingested.Sub(sentTime) > v.grace || now.Sub(sentTime) > window {
+			delete(vd.pending, seq)
+			lost++
+		}
+	}
+
+	totals.verified += verified
+	totals.lost += lost
+	deliveryVerifiedTotal.WithLabelValues(v.simulation.ID, v.target.ID, modelID).Add(float64(verified))
+	deliveryLostTotal.WithLabelValues(v.simulation.ID, v.target.ID, modelID).Add(float64(lost))
+	if totals.verified+totals.lost > 0 {
+		deliveryLossRatio.WithLabelValues(v.simulation.ID, v.target.ID, modelID).Set(float64(totals.lost) / float64(totals.verified+totals.lost))
+	}
+
+	log.Trace().
+		Str("simID", v.simulation.ID).
+		Str("deviceID", vd.device.deviceID).
+		Int("verified", verified).
+		Int("lost", lost).
+		Int("pending", len(vd.pending)).
+		Msg("verified telemetry delivery")
+
+	return nil
+}
+
+// ingestionTime returns the time IoT Central ingested a row read back by a query, zero if the row has no valid $ts.
+func ingestionTime(row map[string]interface{}) time.Time {
+	value, ok := row["$ts"].(string)
+	if !ok {
+		return time.Time{}
+	}
+
+	ts, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return ts
+}
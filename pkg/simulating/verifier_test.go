@@ -0,0 +1,175 @@
+package simulating
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iot-for-all/starling/pkg/consuming"
+	"github.com/iot-for-all/starling/pkg/models"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// centralStandIn serves the device and query APIs of IoT Central for a single device.
+type centralStandIn struct {
+	sync.Mutex
+	rows     []int     // sequence numbers of the telemetry returned by queries.
+	ingested time.Time // $ts of the telemetry returned by queries.
+	queries  []string  // queries received.
+}
+
+func (c *centralStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.Lock()
+	defer c.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/api/devices/"):
+		_ = json.NewEncoder(w).Encode(models.CentralDevice{
+			ID:       strings.TrimPrefix(r.URL.Path, "/api/devices/"),
+			Template: "dtmi:starling:test;1",
+		})
+	case r.Method == http.MethodPost && r.URL.Path == "/api/query":
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		c.queries = append(c.queries, body["query"])
+
+		results := make([]map[string]interface{}, 0, len(c.rows))
+		for _, seq := range c.rows {
+			results = append(results, map[string]interface{}{
+				"$ts":                   c.ingested.UTC().Format(time.RFC3339Nano),
+				consuming.SequenceField: float64(seq),
+			})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// newTestVerifier creates a verifier of a single device reading back telemetry from the stand-in.
+func newTestVerifier(t *testing.T, standIn *centralStandIn, deviceID string) (*deliveryVerifier, *verifiedDevice) {
+	server := httptest.NewServer(standIn)
+	t.Cleanup(server.Close)
+
+	target := &models.SimulationTarget{ID: "verifier-target", AppUrl: server.URL, AppToken: "token"}
+	model := &models.DeviceModel{ID: "verifier-model"}
+	sim := &models.Simulation{ID: "verifier-sim-" + deviceID, TargetID: target.ID, VerifyDelivery: &models.DeliveryVerification{Grace: 60}}
+	d := &device{deviceID: deviceID, model: model, target: target, simulation: sim}
+
+	v := newDeliveryVerifier(context.Background(), sim, target, []*device{d})
+	return v, v.devices[deviceID]
+}
+
+// ingestionLag returns the number and sum of the ingestion lag samples of a verifier.
+func ingestionLag(v *deliveryVerifier) (count uint64, sum float64) {
+	collect(deliveryIngestionLag, v.simulation.ID, func(labels map[string]string, m *dto.Metric) {
+		count += m.GetHistogram().GetSampleCount()
+		sum += m.GetHistogram().GetSampleSum()
+	})
+
+	return count, sum
+}
+
+func TestVerifyFound(t *testing.T) {
+	sent := time.Now().Add(-time.Minute)
+	standIn := &centralStandIn{rows: []int{1, 2, 2}, ingested: sent.Add(5 * time.Second)}
+	v, vd := newTestVerifier(t, standIn, "verifier-found")
+	vd.pending[1] = sent
+	vd.pending[2] = sent
+
+	if err := v.verify(vd); err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+
+	if len(vd.pending) != 0 {
+		t.Errorf("expected no pending messages, got %d", len(vd.pending))
+	}
+	totals := v.totals[vd.device.model.ID]
+	if totals.verified != 2 || totals.lost != 0 {
+		t.Errorf("expected 2 verified and 0 lost messages, got %d and %d", totals.verified, totals.lost)
+	}
+	// the lag is measured until IoT Central ingested the messages rather than until they were read back
+	if count, sum := ingestionLag(v); count != 2 || sum < 9.9 || sum > 10.1 {
+		t.Errorf("expected 2 lags of 5 seconds, got %d with a sum of %f", count, sum)
+	}
+	if vd.templateID != "dtmi:starling:test;1" {
+		t.Errorf("expected the template of the device to be looked up, got '%s'", vd.templateID)
+	}
+	if len(standIn.queries) != 1 || !strings.Contains(standIn.queries[0], "$id = 'verifier-found'") {
+		t.Errorf("expected one query of the device, got %v", standIn.queries)
+	}
+}
+
+func TestVerifyLost(t *testing.T) {
+	standIn := &centralStandIn{}
+	v, vd := newTestVerifier(t, standIn, "verifier-lost")
+	vd.pending[1] = time.Now().Add(-2 * (v.grace + v.interval))
+
+	if err := v.verify(vd); err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+
+	if len(vd.pending) != 0 {
+		t.Errorf("expected the lost message to no longer be pending, got %d pending", len(vd.pending))
+	}
+	totals := v.totals[vd.device.model.ID]
+	if totals.verified != 0 || totals.lost != 1 {
+		t.Errorf("expected 0 verified and 1 lost messages, got %d and %d", totals.verified, totals.lost)
+	}
+}
+
+func TestVerifyGrace(t *testing.T) {
+	standIn := &centralStandIn{rows: []int{1}, ingested: time.Now()}
+	v, vd := newTestVerifier(t, standIn, "verifier-grace")
+	vd.pending[1] = time.Now()
+	vd.pending[2] = time.Now().Add(-v.grace / 2)
+
+	if err := v.verify(vd); err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+
+	if _, ok := vd.pending[2]; !ok || len(vd.pending) != 1 {
+		t.Errorf("expected the message within the grace period to stay pending, got %v", vd.pending)
+	}
+	totals := v.totals[vd.device.model.ID]
+	if totals.verified != 1 || totals.lost != 0 {
+		t.Errorf("expected 1 verified and 0 lost messages, got %d and %d", totals.verified, totals.lost)
+	}
+}
+
+func TestVerifyLostAfterIngestion(t *testing.T) {
+	// IoT Central ingested a later message more than the grace period after the missing one was sent
+	sent := time.Now().Add(-90 * time.Second)
+	standIn := &centralStandIn{rows: []int{2}, ingested: time.Now()}
+	v, vd := newTestVerifier(t, standIn, "verifier-ingested")
+	vd.pending[1] = sent
+	vd.pending[2] = sent.Add(v.grace)
+
+	if err := v.verify(vd); err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+
+	totals := v.totals[vd.device.model.ID]
+	if len(vd.pending) != 0 || totals.verified != 1 || totals.lost != 1 {
+		t.Errorf("expected 1 verified and 1 lost message, got %d and %d with %d pending", totals.verified, totals.lost, len(vd.pending))
+	}
+}
+
+func TestVerifyRejectsUnsafeDeviceID(t *testing.T) {
+	standIn := &centralStandIn{}
+	v, vd := newTestVerifier(t, standIn, "x' OR '1' = '1")
+	vd.pending[1] = time.Now()
+
+	if err := v.verify(vd); err == nil {
+		t.Fatal("expected an error for a device id that cannot be quoted")
+	}
+	if len(standIn.queries) != 0 {
+		t.Errorf("expected no queries, got %v", standIn.queries)
+	}
+}
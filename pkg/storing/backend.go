@@ -0,0 +1,80 @@
+package storing
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/iot-for-all/starling/pkg/config"
+)
+
+const (
+	// BackendBadger stores the data in a badger database in the data directory.
+	BackendBadger = "badger"
+	// BackendMemory keeps the data in memory only, e.g. for tests.
+	BackendMemory = "memory"
+	// BackendSQLite stores the data in a SQLite database file that several instances can share.
+	BackendSQLite = "sqlite"
+)
+
+var (
+	// ErrNotFound is returned by the backends when a key does not exist.
+	ErrNotFound = errors.New("key not found")
+	// errSQLiteUnavailable is returned when opening the sqlite backend in a build without cgo.
+	errSQLiteUnavailable = errors.New("the sqlite backend is not available in this build of Starling, it needs to be built with cgo enabled")
+)
+
+type (
+	// Backend keeps the JSON documents of the stores by key. Keys are grouped by prefixes such as "simulation-",
+	// so backends must list keys in byte order.
+	Backend interface {
+		// View runs a read-only transaction.
+		View(fn func(txn Txn) error) error
+		// Update runs a read-write transaction, committing its changes only if fn succeeds.
+		Update(fn func(txn Txn) error) error
+		// Close releases the resources of the backend.
+		Close() error
+	}
+
+	// Txn reads and writes the documents of a backend within a transaction.
+	Txn interface {
+		// Get returns the value of a key, ErrNotFound if the key does not exist.
+		Get(key []byte) ([]byte, error)
+		// List hands all keys starting with the prefix to the handler in byte order, along with their values.
+		List(prefix []byte, handler func(key []byte, val []byte) error) error
+		// Set creates or updates the value of a key.
+		Set(key []byte, val []byte) error
+		// Delete deletes a key, succeeding if the key does not exist.
+		Delete(key []byte) error
+	}
+)
+
+// openBackend opens the backend selected by the configuration.
+func openBackend(cfg *config.StoreConfig) (Backend, string, error) {
+	switch backendName(cfg) {
+	case BackendBadger:
+		b, err := openBadger(cfg.DataDirectory)
+		return b, cfg.DataDirectory, err
+	case BackendMemory:
+		return newMemoryBackend(), "memory", nil
+	case BackendSQLite:
+		file := cfg.SQLiteFile
+		if len(file) == 0 {
+			file = path.Join(cfg.DataDirectory, "starling.db")
+		}
+		b, err := openSQLite(file)
+		return b, file, err
+	}
+
+	return nil, "", fmt.Errorf("unknown store backend '%s'", cfg.Backend)
+}
+
+// backendName returns the name of the configured backend.
+func backendName(cfg *config.StoreConfig) string {
+	if len(cfg.Backend) == 0 {
+		return BackendBadger
+	}
+
+	return strings.ToLower(cfg.Backend)
+}
@@ -0,0 +1,257 @@
+package storing
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testBackends opens an empty backend of every kind for a test, closing them when the test ends.
+func testBackends(t *testing.T) map[string]Backend {
+	backends := map[string]Backend{BackendMemory: newMemoryBackend()}
+
+	b, err := openBadger(t.TempDir())
+	if err != nil {
+		t.Fatalf("error opening badger backend: %v", err)
+	}
+	backends[BackendBadger] = b
+
+	s, err := openSQLite(filepath.Join(t.TempDir(), "starling.db"))
+	switch {
+	case errors.Is(err, errSQLiteUnavailable):
+		t.Log("sqlite backend is not available without cgo")
+	case err != nil:
+		t.Fatalf("error opening sqlite backend: %v", err)
+	default:
+		backends[BackendSQLite] = s
+	}
+
+	t.Cleanup(func() {
+		for name, b := range backends {
+			if err := b.Close(); err != nil {
+				t.Errorf("error closing %s backend: %v", name, err)
+			}
+		}
+	})
+	return backends
+}
+
+// setAll sets the keys to their values in a single transaction.
+func setAll(t *testing.T, b Backend, items map[string]string) {
+	err := b.Update(func(txn Txn) error {
+		for key, val := range items {
+			if err := txn.Set([]byte(key), []byte(val)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error setting keys: %v", err)
+	}
+}
+
+// get gets the value of a key in a read-only transaction, returning the error of the backend.
+func get(b Backend, key string) (string, error) {
+	var val []byte
+	err := b.View(func(txn Txn) error {
+		var err error
+		val, err = txn.Get([]byte(key))
+		return err
+	})
+
+	return string(val), err
+}
+
+// list lists the keys and values starting with the prefix in a read-only transaction.
+func list(t *testing.T, b Backend, prefix string) []string {
+	items := make([]string, 0)
+	err := b.View(func(txn Txn) error {
+		return txn.List([]byte(prefix), func(key []byte, val []byte) error {
+			items = append(items, string(key)+"="+string(val))
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("error listing '%s': %v", prefix, err)
+	}
+
+	return items
+}
+
+func TestBackendGetSet(t *testing.T) {
+	for name, b := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			setAll(t, b, map[string]string{"target-a": "1"})
+			setAll(t, b, map[string]string{"target-a": "2"})
+
+			if val, err := get(b, "target-a"); err != nil || val != "2" {
+				t.Errorf("expected the updated value '2', got '%s' (%v)", val, err)
+			}
+			if _, err := get(b, "target-b"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected ErrNotFound for a missing key, got %v", err)
+			}
+		})
+	}
+}
+
+func TestBackendList(t *testing.T) {
+	for name, b := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			setAll(t, b, map[string]string{
+				"model":      "0",
+				"model-b":    "2",
+				"model-a-2":  "3",
+				"model-a":    "1",
+				"simulation": "4",
+			})
+
+			expected := []string{"model-a=1", "model-a-2=3", "model-b=2"}
+			if items := list(t, b, "model-"); !reflect.DeepEqual(items, expected) {
+				t.Errorf("expected %v in byte order, got %v", expected, items)
+			}
+			if items := list(t, b, ""); len(items) != 5 || items[0] != "model=0" || items[4] != "simulation=4" {
+				t.Errorf("expected all keys in byte order, got %v", items)
+			}
+			if items := list(t, b, "target-"); len(items) != 0 {
+				t.Errorf("expected no keys, got %v", items)
+			}
+		})
+	}
+}
+
+func TestBackendListNil(t *testing.T) {
+	for name, b := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			setAll(t, b, map[string]string{"model-a": "1", "schema": "2", "target-a": "3"})
+
+			items := make([]string, 0)
+			err := b.View(func(txn Txn) error {
+				return txn.List(nil, func(key []byte, val []byte) error {
+					items = append(items, string(key))
+					return nil
+				})
+			})
+			if err != nil {
+				t.Fatalf("error listing all keys: %v", err)
+			}
+			if expected := []string{"model-a", "schema", "target-a"}; !reflect.DeepEqual(items, expected) {
+				t.Errorf("expected %v with a nil prefix, got %v", expected, items)
+			}
+
+			var empty bool
+			err = b.View(func(txn Txn) (err error) {
+				empty, err = isEmpty(txn)
+				return err
+			})
+			if err != nil || empty {
+				t.Errorf("expected the store not to be empty, got %v (%v)", empty, err)
+			}
+		})
+	}
+}
+
+func TestBackendListStops(t *testing.T) {
+	for name, b := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			setAll(t, b, map[string]string{"model-a": "1", "model-b": "2"})
+
+			calls := 0
+			err := b.View(func(txn Txn) error {
+				return txn.List([]byte("model-"), func(key []byte, val []byte) error {
+					calls++
+					return errStopList
+				})
+			})
+			if !errors.Is(err, errStopList) || calls != 1 {
+				t.Errorf("expected the handler error after one call, got %v after %d calls", err, calls)
+			}
+		})
+	}
+}
+
+func TestBackendDelete(t *testing.T) {
+	for name, b := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			setAll(t, b, map[string]string{"model-a": "1", "model-b": "2"})
+
+			err := b.Update(func(txn Txn) error {
+				if err := txn.Delete([]byte("model-a")); err != nil {
+					return err
+				}
+				return txn.Delete([]byte("model-missing"))
+			})
+			if err != nil {
+				t.Fatalf("error deleting keys: %v", err)
+			}
+
+			if items := list(t, b, "model-"); !reflect.DeepEqual(items, []string{"model-b=2"}) {
+				t.Errorf("expected only model-b to remain, got %v", items)
+			}
+		})
+	}
+}
+
+func TestBackendReadsOwnWrites(t *testing.T) {
+	for name, b := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			setAll(t, b, map[string]string{"model-a": "1", "model-b": "2"})
+
+			err := b.Update(func(txn Txn) error {
+				if err := txn.Set([]byte("model-c"), []byte("3")); err != nil {
+					return err
+				}
+				if err := txn.Delete([]byte("model-a")); err != nil {
+					return err
+				}
+
+				if val, err := txn.Get([]byte("model-c")); err != nil || string(val) != "3" {
+					t.Errorf("expected the written value '3', got '%s' (%v)", val, err)
+				}
+				if _, err := txn.Get([]byte("model-a")); !errors.Is(err, ErrNotFound) {
+					t.Errorf("expected ErrNotFound for the deleted key, got %v", err)
+				}
+
+				var keys []string
+				err := txn.List([]byte("model-"), func(key []byte, val []byte) error {
+					keys = append(keys, string(key))
+					return nil
+				})
+				if expected := []string{"model-b", "model-c"}; !reflect.DeepEqual(keys, expected) {
+					t.Errorf("expected %v within the transaction, got %v", expected, keys)
+				}
+				return err
+			})
+			if err != nil {
+				t.Fatalf("error updating keys: %v", err)
+			}
+		})
+	}
+}
+
+func TestBackendRollback(t *testing.T) {
+	for name, b := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			setAll(t, b, map[string]string{"model-a": "1"})
+
+			failed := errors.New("failed")
+			err := b.Update(func(txn Txn) error {
+				if err := txn.Set([]byte("model-a"), []byte("changed")); err != nil {
+					return err
+				}
+				if err := txn.Set([]byte("model-b"), []byte("2")); err != nil {
+					return err
+				}
+				return failed
+			})
+			if !errors.Is(err, failed) {
+				t.Fatalf("expected the error of the transaction, got %v", err)
+			}
+
+			if items := list(t, b, "model-"); !reflect.DeepEqual(items, []string{"model-a=1"}) {
+				t.Errorf("expected the changes to be rolled back, got %v", items)
+			}
+		})
+	}
+}
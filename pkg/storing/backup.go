@@ -0,0 +1,346 @@
+package storing
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// backupFormat identifies the files written by Backup.
+	backupFormat = "starling-backup"
+	// backupVersion is the version of the backup file format written by Backup.
+	backupVersion = 1
+
+	// restoreBatchSize is the number of records restored per transaction, to stay within the transaction limits.
+	restoreBatchSize = 1000
+	// maxBackupLine is the largest record of a backup file in bytes, e.g. a large device model.
+	maxBackupLine = 64 * 1024 * 1024
+)
+
+var (
+	// ErrNotEmpty is returned when restoring a backup into a store that already has data.
+	ErrNotEmpty = errors.New("store is not empty")
+
+	// secretFields lists the fields holding secrets of the records by key prefix.
+	secretFields = map[string][]string{
+		"target-":        {"masterKey", "appToken"},
+		"targetDevices-": {"connectionString"},
+	}
+)
+
+type (
+	// BackupOptions specifies how secrets are written to a backup.
+	BackupOptions struct {
+		ExcludeSecrets bool   // leave out the keys and tokens of the targets and the cached device connection strings.
+		Passphrase     string // encrypt the secrets with a key derived from the passphrase, if not excluded.
+	}
+
+	// backupHeader is the first line of a backup file.
+	backupHeader struct {
+		Format  string    `json:"format"`         // always backupFormat.
+		Version int       `json:"version"`        // version of the file format.
+		Time    time.Time `json:"time"`           // when the backup was taken.
+		Secrets string    `json:"secrets"`        // how secrets are included: plain, encrypted or excluded.
+		Salt    []byte    `json:"salt,omitempty"` // salt of the key derived from the passphrase, for encrypted secrets.
+		Schema  int       `json:"schema"`         // schema version of the records, 0 for backups taken before schema versions.
+	}
+
+	// backupRecord is a document of the store in a backup file.
+	backupRecord struct {
+		Key   string          `json:"key"`   // key of the document.
+		Value json.RawMessage `json:"value"` // the JSON document.
+	}
+)
+
+// Backup writes a consistent snapshot of all stores to the writer as JSON lines, a header followed by one line per document.
+func Backup(w io.Writer, opts BackupOptions) error {
+	header := backupHeader{Format: backupFormat, Version: backupVersion, Time: time.Now().UTC(), Secrets: "plain"}
+	var gcm cipher.AEAD
+	switch {
+	case opts.ExcludeSecrets:
+		header.Secrets = "excluded"
+	case len(opts.Passphrase) > 0:
+		header.Secrets = "encrypted"
+		header.Salt = make([]byte, 16)
+		if _, err := rand.Read(header.Salt); err != nil {
+			return err
+		}
+		var err error
+		if gcm, err = newCipher(opts.Passphrase, header.Salt); err != nil {
+			return err
+		}
+	}
+
+	writer := bufio.NewWriter(w)
+	encoder := json.NewEncoder(writer)
+	err := backend.View(func(txn Txn) error {
+		schema, _, err := readSchema(txn)
+		if err != nil {
+			return err
+		}
+		header.Schema = schema.Version
+		if err = encoder.Encode(header); err != nil {
+			return err
+		}
+
+		return txn.List(nil, func(key []byte, val []byte) error {
+			if string(key) == string(schemaKey) {
+				// the schema version is part of the header
+				return nil
+			}
+			fields, secret := secretFieldsOf(string(key))
+			if secret && opts.ExcludeSecrets && strings.HasPrefix(string(key), "targetDevices-") {
+				// a cached device is of no use without its connection string
+				return nil
+			}
+
+			value := append(json.RawMessage{}, val...)
+			if secret && (opts.ExcludeSecrets || gcm != nil) {
+				var err error
+				value, err = transformSecrets(value, fields, func(secret string) (string, error) {
+					if opts.ExcludeSecrets {
+						return "", nil
+					}
+					return encryptSecret(gcm, secret)
+				})
+				if err != nil {
+					return fmt.Errorf("error processing secrets of %s: %w", key, err)
+				}
+			}
+
+			return encoder.Encode(backupRecord{Key: string(key), Value: value})
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return writer.Flush()
+}
+
+// Restore reads a backup written by Backup into the stores, which must be empty. Encrypted secrets are decrypted
+// with the passphrase.
+func Restore(r io.Reader, passphrase string) (int, error) {
+	var empty bool
+	err := backend.View(func(txn Txn) (err error) {
+		empty, err = isEmpty(txn)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if !empty {
+		return 0, ErrNotEmpty
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxBackupLine)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return 0, err
+		}
+		return 0, fmt.Errorf("backup is empty")
+	}
+
+	var header backupHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Format != backupFormat {
+		return 0, fmt.Errorf("not a Starling backup")
+	}
+	if header.Version > backupVersion {
+		return 0, fmt.Errorf("backup version %d is newer than the supported version %d, upgrade Starling to restore it", header.Version, backupVersion)
+	}
+	if header.Schema > schemaVersion() {
+		return 0, fmt.Errorf("backup schema version %d is newer than the supported version %d, upgrade Starling to restore it", header.Schema, schemaVersion())
+	}
+
+	var gcm cipher.AEAD
+	if header.Secrets == "encrypted" {
+		if len(passphrase) == 0 {
+			return 0, fmt.Errorf("backup has encrypted secrets, a passphrase is required to restore it")
+		}
+		if gcm, err = newCipher(passphrase, header.Salt); err != nil {
+			return 0, err
+		}
+	}
+
+	restored := 0
+	keys := make([]string, 0)
+	batch := make([]backupRecord, 0, restoreBatchSize)
+	flush := func() error {
+		err := backend.Update(func(txn Txn) error {
+			for _, record := range batch {
+				if err := txn.Set([]byte(record.Key), record.Value); err != nil {
+					return fmt.Errorf("error restoring %s: %w", record.Key, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, record := range batch {
+			keys = append(keys, record.Key)
+		}
+		restored += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+	// records are committed in batches, so a failed restore deletes the records restored so far to allow a retry
+	fail := func(err error) (int, error) {
+		if rollbackErr := deleteRestored(keys); rollbackErr != nil {
+			return restored, fmt.Errorf("%w, and deleting the %d records restored so far failed: %v", err, restored, rollbackErr)
+		}
+		return 0, err
+	}
+
+	for scanner.Scan() {
+		var record backupRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return fail(fmt.Errorf("error reading backup record %d: %w", restored+len(batch)+1, err))
+		}
+
+		if fields, secret := secretFieldsOf(record.Key); secret && gcm != nil {
+			record.Value, err = transformSecrets(record.Value, fields, func(secret string) (string, error) {
+				return decryptSecret(gcm, secret)
+			})
+			if err != nil {
+				return fail(fmt.Errorf("error decrypting secrets of %s, is the passphrase correct? %w", record.Key, err))
+			}
+		}
+
+		batch = append(batch, record)
+		if len(batch) == restoreBatchSize {
+			if err := flush(); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fail(err)
+	}
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			return fail(err)
+		}
+	}
+
+	// upgrade the records of older backups to the current schema
+	err = backend.Update(func(txn Txn) error {
+		return writeSchema(txn, schemaRecord{Version: header.Schema})
+	})
+	if err == nil {
+		err = migrate(false)
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	return restored, nil
+}
+
+// deleteRestored deletes the records of a failed restore along with the schema record, leaving the stores empty.
+func deleteRestored(keys []string) error {
+	keys = append(keys, string(schemaKey))
+	for start := 0; start < len(keys); start += restoreBatchSize {
+		end := start + restoreBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		err := backend.Update(func(txn Txn) error {
+			return deleteKeys(txn, keys[start:end])
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// secretFieldsOf returns the secret fields of the document with the given key.
+func secretFieldsOf(key string) ([]string, bool) {
+	for prefix, fields := range secretFields {
+		if strings.HasPrefix(key, prefix) {
+			return fields, true
+		}
+	}
+
+	return nil, false
+}
+
+// transformSecrets replaces the non-empty secret fields of a JSON document with the result of the transformation.
+func transformSecrets(value json.RawMessage, fields []string, transform func(secret string) (string, error)) (json.RawMessage, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(value, &doc); err != nil {
+		return nil, err
+	}
+
+	for _, field := range fields {
+		var secret string
+		if raw, ok := doc[field]; !ok || json.Unmarshal(raw, &secret) != nil || len(secret) == 0 {
+			continue
+		}
+		transformed, err := transform(secret)
+		if err != nil {
+			return nil, err
+		}
+		if doc[field], err = json.Marshal(transformed); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(doc)
+}
+
+// newCipher creates the AES-GCM cipher of the key derived from the passphrase and salt.
+func newCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// encryptSecret encrypts a secret, returning the nonce and cipher text encoded as base64.
+func encryptSecret(gcm cipher.AEAD, secret string) (string, error) {
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(secret), nil)), nil
+}
+
+// decryptSecret decrypts a secret encrypted by encryptSecret.
+func decryptSecret(gcm cipher.AEAD, encrypted string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", err
+	}
+	if len(raw) < gcm.NonceSize() {
+		return "", fmt.Errorf("encrypted secret is too short")
+	}
+
+	secret, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(secret), nil
+}
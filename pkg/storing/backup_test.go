@@ -0,0 +1,76 @@
+package storing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// useBackend makes the stores use the backend for the duration of a test.
+func useBackend(t *testing.T, b Backend) {
+	previous := backend
+	backend = b
+	t.Cleanup(func() { backend = previous })
+}
+
+func TestBackupRestore(t *testing.T) {
+	source := newMemoryBackend()
+	useBackend(t, source)
+	setAll(t, source, map[string]string{
+		"target-t1":             `{"id":"t1","appToken":"app-token"}`,
+		"simulation-s1":         `{"id":"s1","status":"ready"}`,
+		"targetDevices-t1-dev1": `{"deviceId":"dev1","connectionString":"device-key"}`,
+	})
+
+	var buf bytes.Buffer
+	if err := Backup(&buf, BackupOptions{Passphrase: "passphrase"}); err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+	if strings.Contains(buf.String(), "device-key") || strings.Contains(buf.String(), "app-token") {
+		t.Fatal("expected the secrets to be encrypted")
+	}
+
+	useBackend(t, newMemoryBackend())
+	restored, err := Restore(bytes.NewReader(buf.Bytes()), "passphrase")
+	if err != nil || restored != 3 {
+		t.Fatalf("expected 3 records to be restored, got %d (%v)", restored, err)
+	}
+	if val, err := get(backend, "targetDevices-t1-dev1"); err != nil || !strings.Contains(val, "device-key") {
+		t.Errorf("expected the decrypted connection string, got '%s' (%v)", val, err)
+	}
+
+	if _, err = Restore(bytes.NewReader(buf.Bytes()), "passphrase"); !errors.Is(err, ErrNotEmpty) {
+		t.Errorf("expected ErrNotEmpty restoring into a store with data, got %v", err)
+	}
+}
+
+func TestRestoreRollsBack(t *testing.T) {
+	useBackend(t, newMemoryBackend())
+
+	// the broken record follows a full batch, which is committed before the failure
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf(`{"format":"%s","version":%d,"secrets":"plain","schema":%d}`+"\n", backupFormat, backupVersion, schemaVersion()))
+	for i := 0; i < restoreBatchSize+10; i++ {
+		buf.WriteString(fmt.Sprintf(`{"key":"deviceModel-m%d","value":{"id":"m%d"}}`+"\n", i, i))
+	}
+	buf.WriteString("not json\n")
+
+	restored, err := Restore(&buf, "")
+	if err == nil {
+		t.Fatal("expected the broken record to fail the restore")
+	}
+	if restored != 0 {
+		t.Errorf("expected no records to remain restored, got %d", restored)
+	}
+
+	var empty bool
+	err = backend.View(func(txn Txn) (err error) {
+		empty, err = isEmpty(txn)
+		return err
+	})
+	if err != nil || !empty {
+		t.Errorf("expected the store to be empty after the failed restore (%v)", err)
+	}
+}
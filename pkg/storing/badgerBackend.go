@@ -0,0 +1,87 @@
+package storing
+
+import (
+	"errors"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+type (
+	// badgerBackend keeps the documents in a badger database.
+	badgerBackend struct {
+		db *badger.DB
+	}
+
+	// badgerTxn is a transaction of a badger database.
+	badgerTxn struct {
+		txn *badger.Txn
+	}
+)
+
+// openBadger opens the badger database in the directory.
+func openBadger(dir string) (*badgerBackend, error) {
+	// TODO: Open with correct badger options
+	opts := badger.DefaultOptions(dir)
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &badgerBackend{db: db}, nil
+}
+
+func (b *badgerBackend) View(fn func(txn Txn) error) error {
+	return b.db.View(func(txn *badger.Txn) error {
+		return fn(&badgerTxn{txn: txn})
+	})
+}
+
+func (b *badgerBackend) Update(fn func(txn Txn) error) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		return fn(&badgerTxn{txn: txn})
+	})
+}
+
+func (b *badgerBackend) Close() error {
+	return b.db.Close()
+}
+
+func (t *badgerTxn) Get(key []byte) ([]byte, error) {
+	item, err := t.txn.Get(key)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return item.ValueCopy(nil)
+}
+
+func (t *badgerTxn) List(prefix []byte, handler func(key []byte, val []byte) error) error {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchSize = 10
+
+	it := t.txn.NewIterator(opts)
+	defer it.Close()
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+		err := item.Value(func(v []byte) error {
+			return handler(item.Key(), v)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *badgerTxn) Set(key []byte, val []byte) error {
+	return t.txn.Set(key, val)
+}
+
+func (t *badgerTxn) Delete(key []byte) error {
+	return t.txn.Delete(key)
+}
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 
-	"github.com/dgraph-io/badger/v3"
 	"github.com/iot-for-all/starling/pkg/models"
 )
 
@@ -19,7 +18,7 @@ func (s *deviceConfigs) Get(simulationID string, configID string) (*models.Simul
 	var item models.SimulationDeviceConfig
 	err := s.store.get([]byte(fmt.Sprintf("deviceConfig-%s-%s", simulationID, configID)), &item)
 
-	if err != nil && errors.Is(err, badger.ErrKeyNotFound) {
+	if err != nil && errors.Is(err, ErrNotFound) {
 		return nil, nil
 	}
 
@@ -41,7 +40,10 @@ func (s *deviceConfigs) List(simulationID string) ([]*models.SimulationDeviceCon
 			return fmt.Errorf("failed to deserialize simulation device %s: %w", k, err)
 		}
 
-		items = append(items, &cfg)
+		// the prefix also matches the configs of simulations whose id extends this one, e.g. load and load-2
+		if string(k) == deviceConfigKey(simulationID, cfg.ID) {
+			items = append(items, &cfg)
+		}
 		return nil
 	})
 
@@ -52,15 +54,44 @@ func (s *deviceConfigs) List(simulationID string) ([]*models.SimulationDeviceCon
 	return items, nil
 }
 
-// Set create or updates the device config
+// Set create or updates the device config, failing with a ConflictError if the simulation or model does not exist, or
+// if another device config of the simulation uses the model.
 func (s *deviceConfigs) Set(simulationID string, config *models.SimulationDeviceConfig) error {
-	return s.store.set([]byte(fmt.Sprintf("deviceConfig-%s-%s", simulationID, config.ID)), config)
+	return s.store.backend.Update(func(txn Txn) error {
+		found, err := exists(txn, fmt.Sprintf("simulation-%s", simulationID))
+		if err != nil {
+			return err
+		}
+		if !found {
+			return conflict("device config '%s' references simulation '%s' which does not exist", config.ID, simulationID)
+		}
+
+		if err = checkModels(txn, fmt.Sprintf("device config '%s'", config.ID), []string{config.ModelID}); err != nil {
+			return err
+		}
+
+		existing, err := listDeviceConfigs(txn, simulationID)
+		if err != nil {
+			return err
+		}
+		configs := []*models.SimulationDeviceConfig{config}
+		for _, cfg := range existing {
+			if cfg.ID != config.ID {
+				configs = append(configs, cfg)
+			}
+		}
+		if err = checkConfigModels(simulationID, configs); err != nil {
+			return err
+		}
+
+		return setJSON(txn, fmt.Sprintf("deviceConfig-%s-%s", simulationID, config.ID), config)
+	})
 }
 
 // Delete deletes an existing device config
 func (s *deviceConfigs) Delete(simulationID string, configID string) error {
 	err := s.store.delete([]byte(fmt.Sprintf("deviceConfig-%s-%s", simulationID, configID)))
-	if err != nil && errors.Is(err, badger.ErrKeyNotFound) {
+	if err != nil && errors.Is(err, ErrNotFound) {
 		return nil
 	}
 
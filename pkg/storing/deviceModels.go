@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 
-	"github.com/dgraph-io/badger/v3"
 	"github.com/iot-for-all/starling/pkg/models"
 )
 
@@ -17,7 +16,7 @@ type deviceModels struct {
 func (m *deviceModels) Get(id string) (*models.DeviceModel, error) {
 	var model models.DeviceModel
 	err := m.store.get([]byte(fmt.Sprintf("deviceModel-%s", id)), &model)
-	if err != nil && errors.Is(err, badger.ErrKeyNotFound) {
+	if err != nil && errors.Is(err, ErrNotFound) {
 		return nil, nil
 	}
 
@@ -55,16 +54,108 @@ func (m *deviceModels) Set(item *models.DeviceModel) error {
 	return m.store.set([]byte(fmt.Sprintf("deviceModel-%s", item.ID)), item)
 }
 
-// Delete deletes an existing device model.
-func (m *deviceModels) Delete(id string) error {
-	err := m.store.delete([]byte(fmt.Sprintf("deviceModel-%s", id)))
-	if err != nil && errors.Is(err, badger.ErrKeyNotFound) {
-		return nil
-	}
+// Delete deletes an existing device model and removes it from the models of all targets in a single transaction.
+// Device configs of simulations using the model are deleted too with cascade, otherwise they make the delete fail with
+// a ConflictError.
+func (m *deviceModels) Delete(id string, cascade bool) error {
+	return m.store.backend.Update(func(txn Txn) error {
+		sims, err := listSimulations(txn, func(sim *models.Simulation) bool {
+			return true
+		})
+		if err != nil {
+			return err
+		}
 
-	if err != nil {
-		return err
-	}
+		// device config keys only identify the simulation, so look for the model in the configs of each simulation
+		users := make([]models.Simulation, 0)
+		keys := make([]string, 0)
+		modelConfigs := make(map[string]*models.SimulationDeviceConfig, len(sims))
+		for _, sim := range sims {
+			configs, err := listDeviceConfigs(txn, sim.ID)
+			if err != nil {
+				return err
+			}
 
-	return nil
+			used := false
+			for key, cfg := range configs {
+				if cfg.ModelID == id {
+					keys = append(keys, key)
+					modelConfigs[sim.ID] = cfg
+					used = true
+				}
+			}
+			if used {
+				users = append(users, sim)
+			}
+		}
+
+		if len(users) > 0 && !cascade {
+			ids := make([]string, len(users))
+			for i, sim := range users {
+				ids[i] = sim.ID
+			}
+			return conflict("device model '%s' is used by simulations %s, remove it from their device configs first or delete the model with cascade", id, quoteIDs(ids))
+		}
+		if err = checkReady(users); err != nil {
+			return err
+		}
+
+		// devices of the model still provisioned in a target application would be left without their model
+		devices, err := listTargetDevices(txn, "")
+		if err != nil {
+			return err
+		}
+		provisioned := 0
+		for _, device := range devices {
+			if device.ModelID == id {
+				provisioned++
+				continue
+			}
+			for _, sim := range sims {
+				cfg, ok := modelConfigs[sim.ID]
+				if !ok {
+					cfg = &models.SimulationDeviceConfig{ModelID: id}
+				}
+				if len(device.ModelID) == 0 && device.BelongsToConfig(sim.ID, cfg) {
+					provisioned++
+					break
+				}
+			}
+		}
+		if provisioned > 0 {
+			return conflict("device model '%s' still has %d provisioned devices, delete them from their simulations first", id, provisioned)
+		}
+
+		// remove the model from the targets it is configured for
+		targetModels := make([]models.SimulationTargetModels, 0)
+		err = txn.List([]byte("targetModels-"), func(key []byte, val []byte) error {
+			var tm models.SimulationTargetModels
+			if err := json.Unmarshal(val, &tm); err != nil {
+				return fmt.Errorf("failed to deserialize target models %s: %w", key, err)
+			}
+
+			remaining := make([]string, 0, len(tm.Models))
+			for _, modelID := range tm.Models {
+				if modelID != id {
+					remaining = append(remaining, modelID)
+				}
+			}
+			if len(remaining) < len(tm.Models) {
+				tm.Models = remaining
+				targetModels = append(targetModels, tm)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, tm := range targetModels {
+			if err = setJSON(txn, fmt.Sprintf("targetModels-%s", tm.TargetID), &tm); err != nil {
+				return err
+			}
+		}
+
+		return deleteKeys(txn, append(keys, fmt.Sprintf("deviceModel-%s", id)))
+	})
 }
@@ -0,0 +1,211 @@
+package storing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/iot-for-all/starling/pkg/models"
+)
+
+// ConflictError is returned when a change would leave records referencing records that do not exist, such as
+// deleting a target that simulations still use without cascading the delete.
+type ConflictError struct {
+	msg string
+}
+
+func (e *ConflictError) Error() string {
+	return e.msg
+}
+
+// conflict creates a ConflictError with a formatted message.
+func conflict(format string, args ...interface{}) error {
+	return &ConflictError{msg: fmt.Sprintf(format, args...)}
+}
+
+// quoteIDs formats ids for a conflict message.
+func quoteIDs(ids []string) string {
+	sort.Strings(ids)
+	return "'" + strings.Join(ids, "', '") + "'"
+}
+
+// exists checks whether a key exists within a transaction.
+func exists(txn Txn, key string) (bool, error) {
+	_, err := txn.Get([]byte(key))
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// getJSON gets the value of a key within a transaction, returning false if the key does not exist.
+func getJSON(txn Txn, key string, target interface{}) (bool, error) {
+	val, err := txn.Get([]byte(key))
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err = json.Unmarshal(val, target); err != nil {
+		return false, fmt.Errorf("error de-serializing value for %s from store", key)
+	}
+
+	return true, nil
+}
+
+// setJSON creates or updates the value of a key within a transaction.
+func setJSON(txn Txn, key string, item interface{}) error {
+	val, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("failed to serialize %s: %w", key, err)
+	}
+
+	if err = txn.Set([]byte(key), val); err != nil {
+		return fmt.Errorf("failed to save %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// deleteKeys deletes the keys within a transaction.
+func deleteKeys(txn Txn, keys []string) error {
+	for _, key := range keys {
+		if err := txn.Delete([]byte(key)); err != nil {
+			return fmt.Errorf("failed to delete key %s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// deviceConfigKey returns the key of a device config of a simulation.
+func deviceConfigKey(simulationID string, configID string) string {
+	return fmt.Sprintf("deviceConfig-%s-%s", simulationID, configID)
+}
+
+// targetDeviceKey returns the key of a cached device of a target.
+func targetDeviceKey(targetID string, deviceID string) string {
+	return fmt.Sprintf("targetDevices-%s-%s", targetID, deviceID)
+}
+
+// listDeviceConfigs lists the device configs of a simulation by key. The key prefix of a simulation also matches the
+// configs of simulations whose id starts with it followed by a dash, e.g. load and load-2, so keys are matched exactly.
+func listDeviceConfigs(txn Txn, simulationID string) (map[string]*models.SimulationDeviceConfig, error) {
+	configs := map[string]*models.SimulationDeviceConfig{}
+	err := txn.List([]byte(deviceConfigKey(simulationID, "")), func(key []byte, val []byte) error {
+		var cfg models.SimulationDeviceConfig
+		if err := json.Unmarshal(val, &cfg); err != nil {
+			return fmt.Errorf("failed to deserialize device config %s: %w", key, err)
+		}
+
+		if string(key) == deviceConfigKey(simulationID, cfg.ID) {
+			configs[string(key)] = &cfg
+		}
+		return nil
+	})
+
+	return configs, err
+}
+
+// listTargetDevices lists the cached devices of a target, or of all targets if the target id is empty, by key.
+// The key prefix of a target also matches the devices of targets whose id starts with it followed by a dash,
+// e.g. t and t-2, so devices are matched by their target id.
+func listTargetDevices(txn Txn, targetID string) (map[string]*models.SimulationTargetDevice, error) {
+	prefix := "targetDevices-"
+	if len(targetID) > 0 {
+		prefix = targetDeviceKey(targetID, "")
+	}
+
+	devices := map[string]*models.SimulationTargetDevice{}
+	err := txn.List([]byte(prefix), func(key []byte, val []byte) error {
+		var device models.SimulationTargetDevice
+		if err := json.Unmarshal(val, &device); err != nil {
+			return fmt.Errorf("failed to deserialize device %s: %w", key, err)
+		}
+
+		if len(targetID) == 0 || device.TargetID == targetID {
+			devices[string(key)] = &device
+		}
+		return nil
+	})
+
+	return devices, err
+}
+
+// listSimulations lists the simulations matching the filter within a transaction.
+func listSimulations(txn Txn, filter func(sim *models.Simulation) bool) ([]models.Simulation, error) {
+	items := make([]models.Simulation, 0)
+	err := txn.List([]byte("simulation-"), func(key []byte, val []byte) error {
+		var sim models.Simulation
+		if err := json.Unmarshal(val, &sim); err != nil {
+			return fmt.Errorf("failed to deserialize simulation %s: %w", key, err)
+		}
+
+		if filter(&sim) {
+			items = append(items, sim)
+		}
+		return nil
+	})
+
+	return items, err
+}
+
+// checkReady refuses to delete simulations that are not ready, since they are running or being changed by a job.
+func checkReady(sims []models.Simulation) error {
+	for _, sim := range sims {
+		if sim.Status != models.SimulationStatusReady {
+			return conflict("simulation '%s' cannot be deleted while it is in '%s' status", sim.ID, sim.Status)
+		}
+	}
+
+	return nil
+}
+
+// deleteSimulation deletes a simulation along with its device configs within a transaction.
+func deleteSimulation(txn Txn, simID string) error {
+	configs, err := listDeviceConfigs(txn, simID)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(configs)+1)
+	for key := range configs {
+		keys = append(keys, key)
+	}
+
+	return deleteKeys(txn, append(keys, fmt.Sprintf("simulation-%s", simID)))
+}
+
+// checkConfigModels refuses device configs of a simulation that share a model, since the devices of a simulation are
+// provisioned and owned per model and the configs would name the same devices.
+func checkConfigModels(simulationID string, configs []*models.SimulationDeviceConfig) error {
+	seen := make(map[string]string, len(configs))
+	for _, cfg := range configs {
+		if other, ok := seen[cfg.ModelID]; ok && other != cfg.ID {
+			return conflict("device configs '%s' and '%s' of simulation '%s' both use device model '%s', a simulation can have one device config per model", other, cfg.ID, simulationID, cfg.ModelID)
+		}
+		seen[cfg.ModelID] = cfg.ID
+	}
+
+	return nil
+}
+
+// checkModels checks that the device models exist within a transaction.
+func checkModels(txn Txn, referrer string, modelIDs []string) error {
+	for _, modelID := range modelIDs {
+		found, err := exists(txn, fmt.Sprintf("deviceModel-%s", modelID))
+		if err != nil {
+			return err
+		}
+		if !found {
+			return conflict("%s references device model '%s' which does not exist", referrer, modelID)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package storing
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/iot-for-all/starling/pkg/models"
+)
+
+// seedRecords stores the records of two targets and two simulations whose ids extend the ids of the others.
+func seedRecords(t *testing.T) *store {
+	useBackend(t, newMemoryBackend())
+	setAll(t, backend, map[string]string{
+		"target-t":                 `{"id":"t"}`,
+		"target-t-2":               `{"id":"t-2"}`,
+		"deviceModel-m":            `{"id":"m"}`,
+		"simulation-load":          `{"id":"load","targetId":"t","status":"ready"}`,
+		"simulation-load-2":        `{"id":"load-2","targetId":"t-2","status":"ready"}`,
+		"deviceConfig-load-m":      `{"id":"m","modelId":"m"}`,
+		"deviceConfig-load-2-m":    `{"id":"m","modelId":"m"}`,
+		"targetDevices-t-dev1":     `{"targetId":"t","deviceId":"dev1","simulationId":"load","modelId":"m"}`,
+		"targetDevices-t-2-dev1":   `{"targetId":"t-2","deviceId":"dev1","simulationId":"load-2","modelId":"m"}`,
+		"targetModels-t":           `{"targetId":"t","models":["m"]}`,
+		"targetModels-t-2":         `{"targetId":"t-2","models":["m"]}`,
+		"targetDevices-t-2-legacy": `{"targetId":"t-2","deviceId":"load-2-t-2-m-1"}`,
+	})
+
+	return &store{backend: backend}
+}
+
+// keys lists the stored keys starting with the prefix.
+func keys(t *testing.T, prefix string) []string {
+	items := make([]string, 0)
+	err := backend.View(func(txn Txn) error {
+		return txn.List([]byte(prefix), func(key []byte, val []byte) error {
+			items = append(items, string(key))
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("error listing '%s': %v", prefix, err)
+	}
+
+	return items
+}
+
+func TestDeleteTargetMatchesExactly(t *testing.T) {
+	st := seedRecords(t)
+	targets := &targets{store: st}
+
+	simIDs, err := targets.Delete("t", true)
+	if err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(simIDs, []string{"load"}) {
+		t.Errorf("expected only simulation load to be deleted, got %v", simIDs)
+	}
+	if expected := []string{"targetDevices-t-2-dev1", "targetDevices-t-2-legacy"}; !reflect.DeepEqual(keys(t, "targetDevices-"), expected) {
+		t.Errorf("expected the devices of t-2 to remain, got %v", keys(t, "targetDevices-"))
+	}
+	if expected := []string{"deviceConfig-load-2-m"}; !reflect.DeepEqual(keys(t, "deviceConfig-"), expected) {
+		t.Errorf("expected the configs of load-2 to remain, got %v", keys(t, "deviceConfig-"))
+	}
+}
+
+func TestDeleteAllTargetDevicesMatchesExactly(t *testing.T) {
+	st := seedRecords(t)
+	devices := &targetDevices{store: st}
+
+	if err := devices.DeleteAll("t"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+
+	if expected := []string{"targetDevices-t-2-dev1", "targetDevices-t-2-legacy"}; !reflect.DeepEqual(keys(t, "targetDevices-"), expected) {
+		t.Errorf("expected the devices of t-2 to remain, got %v", keys(t, "targetDevices-"))
+	}
+	if items, err := devices.List("t"); err != nil || len(items) != 0 {
+		t.Errorf("expected no devices of t, got %v (%v)", items, err)
+	}
+}
+
+func TestDeleteSimulationMatchesExactly(t *testing.T) {
+	st := seedRecords(t)
+	simulations := &simulations{store: st}
+	configs := &deviceConfigs{store: st}
+
+	if items, err := configs.List("load"); err != nil || len(items) != 1 {
+		t.Fatalf("expected one config of load, got %v (%v)", items, err)
+	}
+
+	var conflictErr *ConflictError
+	if err := simulations.Delete("load", false); !errors.As(err, &conflictErr) {
+		t.Fatalf("expected a conflict for the provisioned devices, got %v", err)
+	}
+	if err := simulations.Delete("load", true); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+
+	if expected := []string{"deviceConfig-load-2-m"}; !reflect.DeepEqual(keys(t, "deviceConfig-"), expected) {
+		t.Errorf("expected the configs of load-2 to remain, got %v", keys(t, "deviceConfig-"))
+	}
+	if expected := []string{"targetDevices-t-2-dev1", "targetDevices-t-2-legacy"}; !reflect.DeepEqual(keys(t, "targetDevices-"), expected) {
+		t.Errorf("expected the devices of load-2 to remain, got %v", keys(t, "targetDevices-"))
+	}
+}
+
+func TestDeleteModelWithProvisionedDevices(t *testing.T) {
+	st := seedRecords(t)
+	deviceModels := &deviceModels{store: st}
+
+	var conflictErr *ConflictError
+	if err := deviceModels.Delete("m", true); !errors.As(err, &conflictErr) {
+		t.Fatalf("expected a conflict for the provisioned devices, got %v", err)
+	}
+
+	// the legacy device of load-2 is matched to the model by its id
+	setAll(t, backend, map[string]string{
+		"targetDevices-t-dev1":   `{"targetId":"t","deviceId":"dev1","simulationId":"load","modelId":"other"}`,
+		"targetDevices-t-2-dev1": `{"targetId":"t-2","deviceId":"dev1","simulationId":"load-2","modelId":"other"}`,
+	})
+	if err := deviceModels.Delete("m", true); !errors.As(err, &conflictErr) {
+		t.Fatalf("expected a conflict for the legacy device, got %v", err)
+	}
+
+	err := backend.Update(func(txn Txn) error {
+		return txn.Delete([]byte("targetDevices-t-2-legacy"))
+	})
+	if err != nil {
+		t.Fatalf("error deleting the legacy device: %v", err)
+	}
+	if err = deviceModels.Delete("m", true); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if items := keys(t, "deviceConfig-"); len(items) != 0 {
+		t.Errorf("expected the configs of the model to be deleted, got %v", items)
+	}
+}
+
+func TestDeviceConfigsOfOneModel(t *testing.T) {
+	st := seedRecords(t)
+	simulations := &simulations{store: st}
+	configs := &deviceConfigs{store: st}
+
+	var conflictErr *ConflictError
+	err := configs.Set("load", &models.SimulationDeviceConfig{ID: "m-2", ModelID: "m"})
+	if !errors.As(err, &conflictErr) {
+		t.Errorf("expected a conflict for a second config of the model, got %v", err)
+	}
+	if err = configs.Set("load", &models.SimulationDeviceConfig{ID: "m", ModelID: "m", DeviceCount: 2}); err != nil {
+		t.Errorf("expected the config of the model to be updated, got %v", err)
+	}
+
+	sim := &models.Simulation{ID: "load", TargetID: "t", Status: models.SimulationStatusReady}
+	err = simulations.Save(sim, []*models.SimulationDeviceConfig{{ID: "a", ModelID: "m"}, {ID: "b", ModelID: "m"}})
+	if !errors.As(err, &conflictErr) {
+		t.Errorf("expected a conflict for two configs of the model, got %v", err)
+	}
+	if expected := []string{"deviceConfig-load-2-m", "deviceConfig-load-m"}; !reflect.DeepEqual(keys(t, "deviceConfig-"), expected) {
+		t.Errorf("expected the configs to be unchanged, got %v", keys(t, "deviceConfig-"))
+	}
+}
+
+func TestListByModelMatchesLegacyConfigIDs(t *testing.T) {
+	st := seedRecords(t)
+	setAll(t, backend, map[string]string{
+		"deviceConfig-sim-cfg":          `{"id":"cfg","modelId":"m"}`,
+		"targetDevices-t-sim-t-cfg-1":   `{"targetId":"t","deviceId":"sim-t-cfg-1"}`,
+		"targetDevices-t-sim-t-m-2":     `{"targetId":"t","deviceId":"sim-t-m-2"}`,
+		"targetDevices-t-sim-t-other-1": `{"targetId":"t","deviceId":"sim-t-other-1"}`,
+	})
+	devices := &targetDevices{store: st}
+
+	items, err := devices.ListByModel("t", "sim", "m")
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	ids := make([]string, 0, len(items))
+	for _, d := range items {
+		ids = append(ids, d.DeviceID)
+	}
+	if expected := []string{"sim-t-cfg-1", "sim-t-m-2"}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected the devices named after the config and the model, got %v", ids)
+	}
+}
@@ -0,0 +1,68 @@
+package storing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/iot-for-all/starling/pkg/models"
+)
+
+type jobs struct {
+	store *store
+}
+
+// Get gets a job by its id.
+func (j *jobs) Get(id string) (*models.Job, error) {
+	var item models.Job
+	err := j.store.get([]byte(fmt.Sprintf("job-%s", id)), &item)
+	if err != nil && errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// List lists all existing jobs.
+func (j *jobs) List() ([]models.Job, error) {
+	items := make([]models.Job, 0)
+	prefix := []byte("job-")
+	err := j.store.list(prefix, func(k []byte, v []byte) error {
+		var job models.Job
+		err := json.Unmarshal(v, &job)
+		if err != nil {
+			return fmt.Errorf("failed to deserialize job %s: %w", k, err)
+		}
+
+		items = append(items, job)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// Set creates or updates a job.
+func (j *jobs) Set(item *models.Job) error {
+	return j.store.set([]byte(fmt.Sprintf("job-%s", item.ID)), item)
+}
+
+// Delete deletes an existing job.
+func (j *jobs) Delete(id string) error {
+	err := j.store.delete([]byte(fmt.Sprintf("job-%s", id)))
+	if err != nil && errors.Is(err, ErrNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
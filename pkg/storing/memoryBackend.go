@@ -0,0 +1,123 @@
+package storing
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// errReadOnly is returned when writing in a read-only transaction of the memory backend.
+var errReadOnly = errors.New("transaction is read-only")
+
+type (
+	// memoryBackend keeps the documents in memory, they are lost when Starling exits.
+	memoryBackend struct {
+		sync.RWMutex
+		items map[string][]byte // values by key.
+	}
+
+	// memoryTxn is a transaction of the memory backend. Writes are kept aside until the transaction commits.
+	memoryTxn struct {
+		items   map[string][]byte // committed values by key.
+		writes  map[string][]byte // values written by the transaction by key, nil for read-only transactions.
+		deletes map[string]bool   // keys deleted by the transaction.
+	}
+)
+
+// newMemoryBackend creates an empty memory backend.
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{items: map[string][]byte{}}
+}
+
+func (b *memoryBackend) View(fn func(txn Txn) error) error {
+	b.RLock()
+	defer b.RUnlock()
+
+	return fn(&memoryTxn{items: b.items})
+}
+
+func (b *memoryBackend) Update(fn func(txn Txn) error) error {
+	b.Lock()
+	defer b.Unlock()
+
+	txn := &memoryTxn{items: b.items, writes: map[string][]byte{}, deletes: map[string]bool{}}
+	if err := fn(txn); err != nil {
+		return err
+	}
+
+	for key := range txn.deletes {
+		delete(b.items, key)
+	}
+	for key, val := range txn.writes {
+		b.items[key] = val
+	}
+
+	return nil
+}
+
+func (b *memoryBackend) Close() error {
+	return nil
+}
+
+func (t *memoryTxn) Get(key []byte) ([]byte, error) {
+	k := string(key)
+	if t.deletes[k] {
+		return nil, ErrNotFound
+	}
+	if val, ok := t.writes[k]; ok {
+		return val, nil
+	}
+	if val, ok := t.items[k]; ok {
+		return val, nil
+	}
+
+	return nil, ErrNotFound
+}
+
+func (t *memoryTxn) List(prefix []byte, handler func(key []byte, val []byte) error) error {
+	p := string(prefix)
+	var keys []string
+	for key := range t.items {
+		if _, written := t.writes[key]; !written && !t.deletes[key] && strings.HasPrefix(key, p) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range t.writes {
+		if strings.HasPrefix(key, p) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		val, _ := t.Get([]byte(key))
+		if err := handler([]byte(key), val); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *memoryTxn) Set(key []byte, val []byte) error {
+	if t.writes == nil {
+		return errReadOnly
+	}
+
+	k := string(key)
+	delete(t.deletes, k)
+	t.writes[k] = append([]byte{}, val...)
+	return nil
+}
+
+func (t *memoryTxn) Delete(key []byte) error {
+	if t.writes == nil {
+		return errReadOnly
+	}
+
+	k := string(key)
+	delete(t.writes, k)
+	t.deletes[k] = true
+	return nil
+}
@@ -0,0 +1,281 @@
+package storing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// migrationBatchSize is the number of records upgraded per transaction, to stay within the transaction limits.
+	migrationBatchSize = 1000
+)
+
+var (
+	// schemaKey is the key of the schema record. It does not start with the prefix of any store.
+	schemaKey = []byte("schema")
+	// errStopList stops listing records early.
+	errStopList = errors.New("stop listing")
+)
+
+type (
+	// schemaRecord tracks the schema version of the stored records and the progress of a migration.
+	schemaRecord struct {
+		Version   int       `json:"version"`             // version of the last migration applied.
+		Migrating int       `json:"migrating,omitempty"` // version of the migration in progress, if any.
+		After     string    `json:"after,omitempty"`     // last key upgraded by the migration in progress.
+		Time      time.Time `json:"time"`                // when the record was last changed.
+	}
+
+	// migration upgrades the records starting with a key prefix to a schema version.
+	migration struct {
+		version     int    // schema version after the migration, one more than the previous migration.
+		description string // what the migration changes, for the logs.
+		prefix      string // key prefix of the records to upgrade.
+		// upgrade changes a record in place, returning false if it did not need changes. Records already upgraded
+		// must be left unchanged, as they are upgraded again when a backup of a partly migrated database is restored.
+		upgrade func(doc map[string]json.RawMessage) (bool, error)
+	}
+)
+
+// migrations lists the migrations in order of their versions. Add a migration whenever a stored record changes in a way
+// older records cannot be read as is, such as a renamed field or a new field whose zero value is not a good default.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "replace the created and stopped statuses of simulations with ready",
+		prefix:      "simulation-",
+		upgrade: func(doc map[string]json.RawMessage) (bool, error) {
+			var status string
+			if raw, ok := doc["status"]; !ok || json.Unmarshal(raw, &status) != nil {
+				return false, nil
+			}
+			if status != "created" && status != "stopped" {
+				return false, nil
+			}
+
+			doc["status"] = json.RawMessage(`"ready"`)
+			return true, nil
+		},
+	},
+}
+
+// schemaVersion returns the version of the schema this Starling writes.
+func schemaVersion() int {
+	if len(migrations) == 0 {
+		return 0
+	}
+
+	return migrations[len(migrations)-1].version
+}
+
+// migrate upgrades the stored records to the current schema version. Each migration commits its changes in batches and
+// records its progress, so that a migration that was interrupted resumes where it stopped. A dry run logs the changes
+// without applying them.
+func migrate(dryRun bool) error {
+	var schema schemaRecord
+	var stored bool
+	err := backend.View(func(txn Txn) (err error) {
+		schema, stored, err = readSchema(txn)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !stored && schema.Version == schemaVersion():
+		// start tracking the schema of a new database
+		return backend.Update(func(txn Txn) error {
+			return writeSchema(txn, schema)
+		})
+	case schema.Version > schemaVersion():
+		return fmt.Errorf("database schema version %d is newer than the version %d supported by this Starling", schema.Version, schemaVersion())
+	case schema.Version == schemaVersion():
+		log.Debug().Msgf("database schema is up to date at version %d", schema.Version)
+		return nil
+	case dryRun:
+		return dryRunMigrations(schema.Version)
+	}
+
+	from := schema.Version
+	for _, m := range migrations {
+		if m.version <= schema.Version {
+			continue
+		}
+
+		after := ""
+		if schema.Migrating == m.version {
+			after = schema.After
+			log.Info().Msgf("resuming schema migration %d after %s", m.version, after)
+		}
+		changed, err := runMigration(m, schema.Version, after)
+		if err != nil {
+			return fmt.Errorf("error migrating database schema to version %d: %w", m.version, err)
+		}
+		log.Info().Msgf("schema migration %d: %s, changed %d records", m.version, m.description, changed)
+		schema = schemaRecord{Version: m.version}
+	}
+
+	log.Info().Msgf("migrated database schema from version %d to %d", from, schemaVersion())
+	return nil
+}
+
+// dryRunMigrations logs the changes of the pending migrations in a read-only transaction. Later migrations see the
+// records as stored, without the changes of earlier ones.
+func dryRunMigrations(current int) error {
+	return backend.View(func(txn Txn) error {
+		for _, m := range migrations {
+			if m.version <= current {
+				continue
+			}
+			changes, _, _, err := upgradeRecords(txn, m, "", 0)
+			if err != nil {
+				return fmt.Errorf("error migrating database schema to version %d: %w", m.version, err)
+			}
+			for key := range changes {
+				log.Debug().Msgf("schema migration %d would upgrade %s", m.version, key)
+			}
+			log.Info().Msgf("schema migration %d would %s, changing %d records", m.version, m.description, len(changes))
+		}
+
+		log.Warn().Msgf("dry run, the database schema stays at version %d instead of %d", current, schemaVersion())
+		return nil
+	})
+}
+
+// runMigration upgrades the records of a migration after the given key, committing up to migrationBatchSize changes
+// per transaction along with the progress of the migration. It returns the number of records changed.
+func runMigration(m migration, previous int, after string) (int, error) {
+	changed := 0
+	for {
+		var last string
+		var complete bool
+		var batch int
+		err := backend.Update(func(txn Txn) error {
+			changes, lastKey, done, err := upgradeRecords(txn, m, after, migrationBatchSize)
+			if err != nil {
+				return err
+			}
+
+			for key, val := range changes {
+				log.Debug().Msgf("schema migration %d upgraded %s", m.version, key)
+				if err := txn.Set([]byte(key), val); err != nil {
+					return fmt.Errorf("failed to save %s: %w", key, err)
+				}
+			}
+
+			last, complete, batch = lastKey, done, len(changes)
+			if complete {
+				return writeSchema(txn, schemaRecord{Version: m.version})
+			}
+			return writeSchema(txn, schemaRecord{Version: previous, Migrating: m.version, After: last})
+		})
+		if err != nil {
+			return changed, err
+		}
+
+		changed += batch
+		if complete {
+			return changed, nil
+		}
+		after = last
+	}
+}
+
+// upgradeRecords collects the upgraded records of a migration whose keys come after the given key, up to limit changes
+// if the limit is positive. It returns the changes by key, the last key examined and whether all records were examined.
+// Changes are collected before they are written, since not all backends support writing while listing.
+func upgradeRecords(txn Txn, m migration, after string, limit int) (map[string][]byte, string, bool, error) {
+	changes := map[string][]byte{}
+	last := after
+	err := txn.List([]byte(m.prefix), func(key []byte, val []byte) error {
+		if string(key) <= after {
+			return nil
+		}
+		last = string(key)
+
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(val, &doc); err != nil {
+			return fmt.Errorf("error de-serializing %s: %w", key, err)
+		}
+
+		changed, err := m.upgrade(doc)
+		if err != nil {
+			return fmt.Errorf("error upgrading %s: %w", key, err)
+		}
+		if !changed {
+			return nil
+		}
+
+		upgraded, err := json.Marshal(doc)
+		if err != nil {
+			return fmt.Errorf("failed to serialize %s: %w", key, err)
+		}
+		changes[string(key)] = upgraded
+		if limit > 0 && len(changes) >= limit {
+			return errStopList
+		}
+		return nil
+	})
+	if errors.Is(err, errStopList) {
+		return changes, last, false, nil
+	}
+
+	return changes, last, err == nil, err
+}
+
+// readSchema returns the schema record of the stored records and whether it is stored. An empty database is at the
+// current version, while records stored before schema versions were tracked are at version 0.
+func readSchema(txn Txn) (schemaRecord, bool, error) {
+	var schema schemaRecord
+	val, err := txn.Get(schemaKey)
+	if err == nil {
+		if err = json.Unmarshal(val, &schema); err != nil {
+			return schema, true, fmt.Errorf("error de-serializing database schema: %w", err)
+		}
+		return schema, true, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return schema, false, err
+	}
+
+	empty, err := isEmpty(txn)
+	if err != nil || !empty {
+		return schema, false, err
+	}
+
+	schema.Version = schemaVersion()
+	return schema, false, nil
+}
+
+// writeSchema records the schema version of the stored records and the progress of a migration.
+func writeSchema(txn Txn, schema schemaRecord) error {
+	schema.Time = time.Now().UTC()
+	val, err := json.Marshal(schema)
+	if err != nil {
+		return err
+	}
+
+	return txn.Set(schemaKey, val)
+}
+
+// isEmpty checks whether no records other than the schema record are stored.
+func isEmpty(txn Txn) (bool, error) {
+	empty := true
+	err := txn.List(nil, func(key []byte, val []byte) error {
+		if string(key) == string(schemaKey) {
+			return nil
+		}
+		empty = false
+		return errStopList
+	})
+	if err != nil && !errors.Is(err, errStopList) {
+		return false, err
+	}
+
+	return empty, nil
+}
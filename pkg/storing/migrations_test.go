@@ -0,0 +1,99 @@
+package storing
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// seedSimulations stores simulations in the given status without a schema record, as stored before schema versions.
+func seedSimulations(t *testing.T, count int, status string) {
+	items := map[string]string{}
+	for i := 0; i < count; i++ {
+		items[fmt.Sprintf("simulation-s%04d", i)] = fmt.Sprintf(`{"id":"s%04d","status":"%s"}`, i, status)
+	}
+	setAll(t, backend, items)
+}
+
+// statusCounts counts the stored simulations by status.
+func statusCounts(t *testing.T) map[string]int {
+	counts := map[string]int{}
+	for _, item := range list(t, backend, "simulation-") {
+		for _, status := range []string{"created", "stopped", "ready"} {
+			if strings.Contains(item, `"status":"`+status+`"`) {
+				counts[status]++
+			}
+		}
+	}
+
+	return counts
+}
+
+// storedSchema reads the schema record.
+func storedSchema(t *testing.T) schemaRecord {
+	var schema schemaRecord
+	err := backend.View(func(txn Txn) (err error) {
+		schema, _, err = readSchema(txn)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("error reading schema: %v", err)
+	}
+
+	return schema
+}
+
+func TestMigrateInBatches(t *testing.T) {
+	useBackend(t, newMemoryBackend())
+	seedSimulations(t, 2*migrationBatchSize+5, "created")
+
+	if err := migrate(false); err != nil {
+		t.Fatalf("migration failed: %v", err)
+	}
+
+	if counts := statusCounts(t); counts["ready"] != 2*migrationBatchSize+5 {
+		t.Errorf("expected all simulations to be ready, got %v", counts)
+	}
+	if schema := storedSchema(t); schema.Version != schemaVersion() || schema.Migrating != 0 {
+		t.Errorf("expected schema version %d without a migration in progress, got %+v", schemaVersion(), schema)
+	}
+}
+
+func TestMigrateResumes(t *testing.T) {
+	useBackend(t, newMemoryBackend())
+	seedSimulations(t, 10, "stopped")
+	err := backend.Update(func(txn Txn) error {
+		return writeSchema(txn, schemaRecord{Version: 0, Migrating: 1, After: "simulation-s0004"})
+	})
+	if err != nil {
+		t.Fatalf("error writing schema: %v", err)
+	}
+
+	if err = migrate(false); err != nil {
+		t.Fatalf("migration failed: %v", err)
+	}
+
+	// the records up to the recorded key are taken as migrated already
+	if counts := statusCounts(t); counts["stopped"] != 5 || counts["ready"] != 5 {
+		t.Errorf("expected the migration to resume after the recorded key, got %v", counts)
+	}
+	if schema := storedSchema(t); schema.Version != schemaVersion() {
+		t.Errorf("expected schema version %d, got %+v", schemaVersion(), schema)
+	}
+}
+
+func TestMigrateDryRun(t *testing.T) {
+	useBackend(t, newMemoryBackend())
+	seedSimulations(t, 3, "created")
+
+	if err := migrate(true); err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+
+	if counts := statusCounts(t); counts["created"] != 3 {
+		t.Errorf("expected the dry run to leave the simulations unchanged, got %v", counts)
+	}
+	if schema := storedSchema(t); schema.Version != 0 {
+		t.Errorf("expected the schema to stay at version 0, got %+v", schema)
+	}
+}
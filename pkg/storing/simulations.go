@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/dgraph-io/badger/v3"
 	"github.com/iot-for-all/starling/pkg/models"
 	"github.com/rs/zerolog/log"
 )
@@ -17,7 +16,7 @@ type simulations struct {
 func (s *simulations) Get(id string) (*models.Simulation, error) {
 	var item models.Simulation
 	err := s.store.get([]byte(fmt.Sprintf("simulation-%s", id)), &item)
-	if err != nil && errors.Is(err, badger.ErrKeyNotFound) {
+	if err != nil && errors.Is(err, ErrNotFound) {
 		return nil, nil
 	}
 
@@ -57,16 +56,85 @@ func (s *simulations) Set(item *models.Simulation) error {
 	return s.store.set([]byte(fmt.Sprintf("simulation-%s", item.ID)), item)
 }
 
-// Delete deletes an existing simulation
-func (s *simulations) Delete(id string) error {
-	err := s.store.delete([]byte(fmt.Sprintf("simulation-%s", id)))
-	if err != nil && errors.Is(err, badger.ErrKeyNotFound) {
+// Save creates or updates a simulation changed through the APIs, failing with a ConflictError if its target does not
+// exist. Unless configs is nil, the device configs of the simulation are replaced in the same transaction, failing if
+// any of their models does not exist or two of them use the same model.
+func (s *simulations) Save(item *models.Simulation, configs []*models.SimulationDeviceConfig) error {
+	return s.store.backend.Update(func(txn Txn) error {
+		if len(item.TargetID) > 0 {
+			found, err := exists(txn, fmt.Sprintf("target-%s", item.TargetID))
+			if err != nil {
+				return err
+			}
+			if !found {
+				return conflict("simulation '%s' references target '%s' which does not exist", item.ID, item.TargetID)
+			}
+		}
+
+		if err := setJSON(txn, fmt.Sprintf("simulation-%s", item.ID), item); err != nil {
+			return err
+		}
+		if configs == nil {
+			return nil
+		}
+		if err := checkConfigModels(item.ID, configs); err != nil {
+			return err
+		}
+
+		existing, err := listDeviceConfigs(txn, item.ID)
+		if err != nil {
+			return err
+		}
+		for key := range existing {
+			if err = txn.Delete([]byte(key)); err != nil {
+				return fmt.Errorf("failed to delete key %s: %w", key, err)
+			}
+		}
+
+		for _, cfg := range configs {
+			if err = checkModels(txn, fmt.Sprintf("simulation '%s'", item.ID), []string{cfg.ModelID}); err != nil {
+				return err
+			}
+			if err = setJSON(txn, fmt.Sprintf("deviceConfig-%s-%s", item.ID, cfg.ID), cfg); err != nil {
+				return err
+			}
+		}
+
 		return nil
-	}
+	})
+}
 
-	if err != nil {
-		return err
-	}
+// Delete deletes an existing simulation along with its device configs in a single transaction. The cached devices
+// the simulation provisioned are forgotten too with cascade, otherwise they make the delete fail with a ConflictError,
+// since they are still in the target application.
+func (s *simulations) Delete(id string, cascade bool) error {
+	return s.store.backend.Update(func(txn Txn) error {
+		var sim models.Simulation
+		found, err := getJSON(txn, fmt.Sprintf("simulation-%s", id), &sim)
+		if err != nil || !found {
+			return err
+		}
+
+		if len(sim.TargetID) > 0 {
+			devices, err := listTargetDevices(txn, sim.TargetID)
+			if err != nil {
+				return err
+			}
+			keys := make([]string, 0)
+			for key, device := range devices {
+				if device.BelongsTo(id, "") {
+					keys = append(keys, key)
+				}
+			}
 
-	return nil
+			if len(keys) > 0 && !cascade {
+				return conflict("simulation '%s' still has %d provisioned devices in target '%s', delete them first or delete the simulation with cascade", id, len(keys), sim.TargetID)
+			}
+			if err = deleteKeys(txn, keys); err != nil {
+				return err
+			}
+		}
+
+		return deleteSimulation(txn, id)
+	})
 }
@@ -0,0 +1,138 @@
+//go:build cgo
+// +build cgo
+
+package storing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	_ "github.com/mattn/go-sqlite3" // registers the sqlite3 driver
+)
+
+type (
+	// sqliteBackend keeps the documents in a table of a SQLite database file.
+	sqliteBackend struct {
+		db *sql.DB
+	}
+
+	// sqliteTxn is a transaction of a SQLite database.
+	sqliteTxn struct {
+		tx *sql.Tx
+	}
+)
+
+// openSQLite opens the SQLite database file, creating the file and its table if needed.
+func openSQLite(file string) (Backend, error) {
+	if err := os.MkdirAll(filepath.Dir(file), 0744); err != nil {
+		return nil, fmt.Errorf("error creating database directory: %w", err)
+	}
+
+	// wait for the locks of other instances sharing the file instead of failing right away
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_busy_timeout=10000&_txlock=immediate", file))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS documents (key BLOB PRIMARY KEY, value BLOB NOT NULL)")
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("error creating documents table: %w", err)
+	}
+
+	return &sqliteBackend{db: db}, nil
+}
+
+func (b *sqliteBackend) View(fn func(txn Txn) error) error {
+	tx, err := b.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	return fn(&sqliteTxn{tx: tx})
+}
+
+func (b *sqliteBackend) Update(fn func(txn Txn) error) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err = fn(&sqliteTxn{tx: tx}); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (b *sqliteBackend) Close() error {
+	return b.db.Close()
+}
+
+func (t *sqliteTxn) Get(key []byte) ([]byte, error) {
+	var val []byte
+	err := t.tx.QueryRow("SELECT value FROM documents WHERE key = ?", key).Scan(&val)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+
+	return val, err
+}
+
+func (t *sqliteTxn) List(prefix []byte, handler func(key []byte, val []byte) error) error {
+	var rows *sql.Rows
+	var err error
+	// a nil prefix would be bound as NULL, which no key compares to, so an empty prefix has no bounds
+	if len(prefix) == 0 {
+		rows, err = t.tx.Query("SELECT key, value FROM documents ORDER BY key")
+	} else if end := prefixEnd(prefix); end != nil {
+		rows, err = t.tx.Query("SELECT key, value FROM documents WHERE key >= ? AND key < ? ORDER BY key", prefix, end)
+	} else {
+		rows, err = t.tx.Query("SELECT key, value FROM documents WHERE key >= ? ORDER BY key", prefix)
+	}
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key, val []byte
+		if err := rows.Scan(&key, &val); err != nil {
+			return err
+		}
+		if err := handler(key, val); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (t *sqliteTxn) Set(key []byte, val []byte) error {
+	_, err := t.tx.Exec("INSERT INTO documents (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value", key, val)
+	return err
+}
+
+func (t *sqliteTxn) Delete(key []byte) error {
+	_, err := t.tx.Exec("DELETE FROM documents WHERE key = ?", key)
+	return err
+}
+
+// prefixEnd returns the first key after all keys starting with the prefix, nil if there is no such key.
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !cgo
+// +build !cgo
+
+package storing
+
+// openSQLite fails as the SQLite driver is written in C, so Starling needs to be built with cgo to use it.
+func openSQLite(file string) (Backend, error) {
+	return nil, errSQLiteUnavailable
+}
@@ -5,38 +5,42 @@ import (
 	"fmt"
 	"github.com/iot-for-all/starling/pkg/config"
 
-	"github.com/dgraph-io/badger/v3"
 	"github.com/rs/zerolog/log"
 )
 
 var (
-	db            *badger.DB     // application database
+	backend       Backend        // application database
 	DeviceModels  *deviceModels  // DeviceModels store
 	Simulations   *simulations   // Simulations store
 	DeviceConfigs *deviceConfigs // DeviceConfigs store
 	Targets       *targets       // Targets store
 	TargetModels  *targetModels  // TargetModels store
 	TargetDevices *targetDevices // TargetDevices store
+	Jobs          *jobs          // Jobs store
 )
 
 type store struct {
-	db *badger.DB
+	backend Backend
 }
 
-// Open initializes and opens the database
+// Open initializes and opens the database using the configured backend
 func Open(cfg *config.StoreConfig) error {
-	// TODO: Open with correct badger options
-	dbFile := fmt.Sprintf("%s", cfg.DataDirectory)
-	opts := badger.DefaultOptions(dbFile)
-	//b, _ := json.MarshalIndent(opts, "", "  ")
-	//fmt.Printf("%s\n", b)
-	d, err := badger.Open(opts)
+	b, location, err := openBackend(cfg)
 	if err != nil {
 		return err
 	}
 
-	db = d
-	store := store{db: db}
+	backend = b
+	log.Info().Msgf("initialized %s database from %s", backendName(cfg), location)
+
+	// upgrade the records stored by older versions before the stores use them
+	if err = migrate(cfg.MigrationDryRun); err != nil {
+		_ = backend.Close()
+		backend = nil
+		return err
+	}
+
+	store := store{backend: backend}
 
 	DeviceModels = &deviceModels{store: &store}
 	Simulations = &simulations{store: &store}
@@ -44,15 +48,15 @@ func Open(cfg *config.StoreConfig) error {
 	Targets = &targets{store: &store}
 	TargetModels = &targetModels{store: &store}
 	TargetDevices = &targetDevices{store: &store}
+	Jobs = &jobs{store: &store}
 
-	log.Info().Msgf("initialized database from %s", dbFile)
 	return nil
 }
 
 // Close closes the open database handle
 func Close() error {
-	if db != nil {
-		return db.Close()
+	if backend != nil {
+		return backend.Close()
 	}
 
 	return nil
@@ -60,19 +64,15 @@ func Close() error {
 
 // get gets the value of a key
 func (s *store) get(key []byte, target interface{}) error {
-	return s.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get(key)
+	return s.backend.View(func(txn Txn) error {
+		v, err := txn.Get(key)
 		if err != nil {
 			return err
 		}
 
-		err = item.Value(func(v []byte) error {
-			if err := json.Unmarshal(v, target); err != nil {
-				return fmt.Errorf("error de-serializing value for %s from store", key)
-			}
-
-			return nil
-		})
+		if err := json.Unmarshal(v, target); err != nil {
+			return fmt.Errorf("error de-serializing value for %s from store", key)
+		}
 
 		return nil
 	})
@@ -80,23 +80,9 @@ func (s *store) get(key []byte, target interface{}) error {
 
 // list lists all existing rows that match the key prefix
 func (s *store) list(prefix []byte, handler func(key []byte, val []byte) error) error {
-	return s.db.View(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions
-		opts.PrefetchSize = 10
-
-		it := txn.NewIterator(opts)
-
-		defer it.Close()
-
-		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
-			item := it.Item()
-			err := item.Value(func(v []byte) error {
-				return handler(item.Key(), v)
-			})
-
-			if err != nil {
-				return fmt.Errorf("failure reading items for key %s, %w", prefix, err)
-			}
+	return s.backend.View(func(txn Txn) error {
+		if err := txn.List(prefix, handler); err != nil {
+			return fmt.Errorf("failure reading items for key %s, %w", prefix, err)
 		}
 
 		return nil
@@ -105,7 +91,7 @@ func (s *store) list(prefix []byte, handler func(key []byte, val []byte) error)
 
 // set create or updates the specified value
 func (s *store) set(key []byte, target interface{}) error {
-	return s.db.Update(func(txn *badger.Txn) error {
+	return s.backend.Update(func(txn Txn) error {
 		val, err := json.Marshal(target)
 		if err != nil {
 			return fmt.Errorf("failed to serialize %s: %w", key, err)
@@ -121,7 +107,7 @@ func (s *store) set(key []byte, target interface{}) error {
 
 // delete deletes the value for the specified key
 func (s *store) delete(key []byte) error {
-	return s.db.Update(func(txn *badger.Txn) error {
+	return s.backend.Update(func(txn Txn) error {
 		err := txn.Delete(key)
 		if err != nil {
 			return fmt.Errorf("failed to delete key %s: %w", key, err)
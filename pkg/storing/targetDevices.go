@@ -4,7 +4,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/dgraph-io/badger/v3"
+	"sort"
+
 	"github.com/iot-for-all/starling/pkg/models"
 )
 
@@ -23,7 +24,10 @@ func (t *targetDevices) List(targetId string) ([]models.SimulationTargetDevice,
 			return fmt.Errorf("failed to deserialize device %s: %w", k, err)
 		}
 
-		items = append(items, device)
+		// the prefix also matches the devices of targets whose id extends this one, e.g. t and t-2
+		if device.TargetID == targetId {
+			items = append(items, device)
+		}
 		return nil
 	})
 
@@ -34,25 +38,46 @@ func (t *targetDevices) List(targetId string) ([]models.SimulationTargetDevice,
 	return items, nil
 }
 
-// List lists all devices in a target from the store.
+// ListByTargetIdSimId lists all devices in a target that were provisioned by the simulation.
 func (t *targetDevices) ListByTargetIdSimId(targetId string, simId string) ([]models.SimulationTargetDevice, error) {
-	items := make([]models.SimulationTargetDevice, 0)
-	prefix := []byte(fmt.Sprintf("targetDevices-%s-%s-%s", targetId, simId, targetId))
-	err := t.store.list(prefix, func(k []byte, v []byte) error {
-		var device models.SimulationTargetDevice
-		err := json.Unmarshal(v, &device)
-		if err != nil {
-			return fmt.Errorf("failed to deserialize device %s: %w", k, err)
-		}
-
-		items = append(items, device)
-		return nil
-	})
+	return t.ListByModel(targetId, simId, "")
+}
 
+// ListByModel lists the devices of a model in a target that were provisioned by the simulation, ordered by their index.
+// Devices cached before ownership was recorded are also matched by the id of the device config of the model.
+func (t *targetDevices) ListByModel(targetId string, simId string, modelId string) ([]models.SimulationTargetDevice, error) {
+	devices, err := t.List(targetId)
 	if err != nil {
 		return nil, err
 	}
 
+	cfg := &models.SimulationDeviceConfig{ModelID: modelId}
+	if len(modelId) > 0 {
+		err = t.store.backend.View(func(txn Txn) error {
+			configs, err := listDeviceConfigs(txn, simId)
+			for _, c := range configs {
+				if c.ModelID == modelId {
+					cfg = c
+				}
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	items := make([]models.SimulationTargetDevice, 0)
+	for _, device := range devices {
+		if device.BelongsToConfig(simId, cfg) {
+			items = append(items, device)
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].DeviceIndex() < items[j].DeviceIndex()
+	})
+
 	return items, nil
 }
 
@@ -61,7 +86,7 @@ func (t *targetDevices) Get(targetId string, deviceId string) (*models.Simulatio
 	var item models.SimulationTargetDevice
 
 	err := t.store.get([]byte(fmt.Sprintf("targetDevices-%s-%s", targetId, deviceId)), &item)
-	if err != nil && errors.Is(err, badger.ErrKeyNotFound) {
+	if err != nil && errors.Is(err, ErrNotFound) {
 		return nil, nil
 	}
 
@@ -80,7 +105,7 @@ func (t *targetDevices) Set(item *models.SimulationTargetDevice) error {
 // Delete deletes device in a target.
 func (t *targetDevices) Delete(targetId string, deviceId string) error {
 	err := t.store.delete([]byte(fmt.Sprintf("targetDevices-%s-%s", targetId, deviceId)))
-	if err != nil && errors.Is(err, badger.ErrKeyNotFound) {
+	if err != nil && errors.Is(err, ErrNotFound) {
 		return nil
 	}
 
@@ -91,16 +116,19 @@ func (t *targetDevices) Delete(targetId string, deviceId string) error {
 	return nil
 }
 
-// DeleteAll deletes all devices in a target.
+// DeleteAll deletes all devices in a target in a single transaction.
 func (t *targetDevices) DeleteAll(targetId string) error {
-	err := t.store.delete([]byte(fmt.Sprintf("targetDevices-%s-", targetId)))
-	if err != nil && errors.Is(err, badger.ErrKeyNotFound) {
-		return nil
-	}
+	return t.store.backend.Update(func(txn Txn) error {
+		devices, err := listTargetDevices(txn, targetId)
+		if err != nil {
+			return err
+		}
 
-	if err != nil {
-		return err
-	}
+		keys := make([]string, 0, len(devices))
+		for key := range devices {
+			keys = append(keys, key)
+		}
 
-	return nil
+		return deleteKeys(txn, keys)
+	})
 }
@@ -3,7 +3,6 @@ package storing
 import (
 	"errors"
 	"fmt"
-	"github.com/dgraph-io/badger/v3"
 	"github.com/iot-for-all/starling/pkg/models"
 )
 
@@ -16,7 +15,7 @@ func (t *targetModels) Get(targetId string) (*models.SimulationTargetModels, err
 	var item models.SimulationTargetModels
 
 	err := t.store.get([]byte(fmt.Sprintf("targetModels-%s", targetId)), &item)
-	if err != nil && errors.Is(err, badger.ErrKeyNotFound) {
+	if err != nil && errors.Is(err, ErrNotFound) {
 		return nil, nil
 	}
 
@@ -27,15 +26,30 @@ func (t *targetModels) Get(targetId string) (*models.SimulationTargetModels, err
 	return &item, nil
 }
 
-// Set creates or updates the models configured for a target.
+// Set creates or updates the models configured for a target, failing with a ConflictError if the target or any of
+// the models does not exist.
 func (t *targetModels) Set(item *models.SimulationTargetModels) error {
-	return t.store.set([]byte(fmt.Sprintf("targetModels-%s", item.TargetID)), item)
+	return t.store.backend.Update(func(txn Txn) error {
+		found, err := exists(txn, fmt.Sprintf("target-%s", item.TargetID))
+		if err != nil {
+			return err
+		}
+		if !found {
+			return conflict("models cannot be configured for target '%s' which does not exist", item.TargetID)
+		}
+
+		if err = checkModels(txn, fmt.Sprintf("target '%s'", item.TargetID), item.Models); err != nil {
+			return err
+		}
+
+		return setJSON(txn, fmt.Sprintf("targetModels-%s", item.TargetID), item)
+	})
 }
 
 // Delete deletes models configured for a target.
 func (t *targetModels) Delete(targetId string) error {
 	err := t.store.delete([]byte(fmt.Sprintf("targetModels-%s", targetId)))
-	if err != nil && errors.Is(err, badger.ErrKeyNotFound) {
+	if err != nil && errors.Is(err, ErrNotFound) {
 		return nil
 	}
 
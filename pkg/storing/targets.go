@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/dgraph-io/badger/v3"
 	"github.com/iot-for-all/starling/pkg/models"
 )
 
@@ -16,7 +15,7 @@ type targets struct {
 func (t *targets) Get(id string) (*models.SimulationTarget, error) {
 	var item models.SimulationTarget
 	err := t.store.get([]byte(fmt.Sprintf("target-%s", id)), &item)
-	if err != nil && errors.Is(err, badger.ErrKeyNotFound) {
+	if err != nil && errors.Is(err, ErrNotFound) {
 		return nil, nil
 	}
 
@@ -54,16 +53,50 @@ func (t *targets) Set(item *models.SimulationTarget) error {
 	return t.store.set([]byte(fmt.Sprintf("target-%s", item.ID)), item)
 }
 
-// Delete deletes an existing target
-func (t *targets) Delete(id string) error {
-	err := t.store.delete([]byte(fmt.Sprintf("target-%s", id)))
-	if err != nil && errors.Is(err, badger.ErrKeyNotFound) {
-		return nil
-	}
+// Delete deletes an existing target along with its models and cached devices in a single transaction. Simulations
+// using the target are deleted too with cascade, otherwise they make the delete fail with a ConflictError. It returns
+// the ids of the deleted simulations.
+func (t *targets) Delete(id string, cascade bool) ([]string, error) {
+	simIDs := make([]string, 0)
+	err := t.store.backend.Update(func(txn Txn) error {
+		sims, err := listSimulations(txn, func(sim *models.Simulation) bool {
+			return sim.TargetID == id
+		})
+		if err != nil {
+			return err
+		}
 
+		for _, sim := range sims {
+			simIDs = append(simIDs, sim.ID)
+		}
+		if len(sims) > 0 && !cascade {
+			return conflict("target '%s' is used by simulations %s, delete them first or delete the target with cascade", id, quoteIDs(simIDs))
+		}
+		if err = checkReady(sims); err != nil {
+			return err
+		}
+
+		for _, simID := range simIDs {
+			if err = deleteSimulation(txn, simID); err != nil {
+				return err
+			}
+		}
+
+		devices, err := listTargetDevices(txn, id)
+		if err != nil {
+			return err
+		}
+
+		keys := []string{fmt.Sprintf("targetModels-%s", id), fmt.Sprintf("target-%s", id)}
+		for key := range devices {
+			keys = append(keys, key)
+		}
+
+		return deleteKeys(txn, keys)
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return simIDs, nil
 }
@@ -0,0 +1,160 @@
+package tracing
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/iot-for-all/starling/pkg/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// instrumentationName identifies the spans created by Starling.
+	instrumentationName = "github.com/iot-for-all/starling"
+
+	// ExporterOTLP exports the spans to an OpenTelemetry collector using OTLP over HTTP.
+	ExporterOTLP = "otlp"
+	// ExporterFile writes the spans to a local file as JSON lines for offline use.
+	ExporterFile = "file"
+
+	// deviceKey is the attribute identifying the simulated device of a span.
+	deviceKey = attribute.Key("starling.device")
+)
+
+// deviceSampler samples the root spans of simulated devices by their device id, so that all the operations of a
+// fraction of the devices are traced rather than a fraction of the operations of every device. Root spans that do not
+// belong to a device are sampled by their trace id.
+type deviceSampler struct {
+	bound    uint64           // devices whose id hashes below the bound are sampled.
+	fallback sdktrace.Sampler // sampler of the spans without a device.
+}
+
+// newDeviceSampler creates a sampler tracing the given fraction of the devices.
+func newDeviceSampler(ratio float64) sdktrace.Sampler {
+	bound := uint64(0)
+	switch {
+	case ratio >= 1:
+		bound = math.MaxUint64
+	case ratio > 0:
+		bound = uint64(ratio * math.MaxUint64)
+	}
+
+	return &deviceSampler{bound: bound, fallback: sdktrace.TraceIDRatioBased(ratio)}
+}
+
+// ShouldSample samples the span if its device is part of the sampled fraction.
+func (s *deviceSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	for _, attr := range p.Attributes {
+		if attr.Key != deviceKey {
+			continue
+		}
+
+		// hash the id so that devices named in sequence are spread evenly
+		sum := sha256.Sum256([]byte(attr.Value.AsString()))
+		decision := sdktrace.Drop
+		if s.bound == math.MaxUint64 || binary.BigEndian.Uint64(sum[:8]) < s.bound {
+			decision = sdktrace.RecordAndSample
+		}
+		return sdktrace.SamplingResult{
+			Decision:   decision,
+			Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+		}
+	}
+
+	return s.fallback.ShouldSample(p)
+}
+
+// Description describes the sampler.
+func (s *deviceSampler) Description() string {
+	return fmt.Sprintf("DeviceSampler{%s}", s.fallback.Description())
+}
+
+// Init sets up the global tracer provider exporting the sampled spans as configured. Tracing stays a no-op
+// unless enabled. The returned function flushes the pending spans and stops exporting them.
+func Init(ctx context.Context, cfg *config.TracingConfig) (func(context.Context) error, error) {
+	if !cfg.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var exporter sdktrace.SpanExporter
+	var file *os.File
+	var err error
+	switch strings.ToLower(cfg.Exporter) {
+	case "", ExporterOTLP:
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	case ExporterFile:
+		if err = os.MkdirAll(filepath.Dir(cfg.File), 0744); err != nil {
+			return nil, fmt.Errorf("error creating trace file directory: %w", err)
+		}
+		file, err = os.OpenFile(cfg.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("error opening trace file: %w", err)
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter '%s'", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating trace exporter: %w", err)
+	}
+
+	serviceName := cfg.ServiceName
+	if len(serviceName) == 0 {
+		serviceName = "starling"
+	}
+
+	// each operation of a device is its own trace, so roots are sampled by device to trace a fraction of the devices
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(newDeviceSampler(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			_ = file.Close()
+		}
+		return err
+	}, nil
+}
+
+// Tracer returns the tracer creating the spans of Starling.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start starts a span for an operation of a simulated device.
+func Start(ctx context.Context, name string, simulationID string, targetID string, modelID string, deviceID string) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(
+		attribute.String("starling.sim", simulationID),
+		attribute.String("starling.target", targetID),
+		attribute.String("starling.model", modelID),
+		deviceKey.String(deviceID),
+	))
+}
+
+// Fail records the error on the span and marks it as failed.
+func Fail(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,62 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// sampled returns whether the sampler samples a root span with the attributes and trace id.
+func sampled(s sdktrace.Sampler, traceID byte, attrs ...attribute.KeyValue) bool {
+	result := s.ShouldSample(sdktrace.SamplingParameters{
+		ParentContext: context.Background(),
+		TraceID:       trace.TraceID{traceID},
+		Name:          "connect",
+		Attributes:    attrs,
+	})
+
+	return result.Decision == sdktrace.RecordAndSample
+}
+
+func TestDeviceSamplerSamplesDevices(t *testing.T) {
+	s := newDeviceSampler(0.5)
+
+	traced := 0
+	for i := 0; i < 1000; i++ {
+		device := deviceKey.String(fmt.Sprintf("sim-target-model-%d", i))
+		first := sampled(s, 0x00, device)
+		// every operation of the device is its own trace with a different trace id
+		for traceID := byte(1); traceID < 8; traceID++ {
+			if sampled(s, traceID<<5, device) != first {
+				t.Fatalf("expected all operations of device %d to be sampled alike", i)
+			}
+		}
+		if first {
+			traced++
+		}
+	}
+
+	if traced < 400 || traced > 600 {
+		t.Errorf("expected about half of the devices to be traced, got %d of 1000", traced)
+	}
+}
+
+func TestDeviceSamplerRatios(t *testing.T) {
+	device := deviceKey.String("sim-target-model-1")
+	if !sampled(newDeviceSampler(1), 0xff, device) {
+		t.Error("expected all devices to be traced with a ratio of 1")
+	}
+	if sampled(newDeviceSampler(0), 0x00, device) {
+		t.Error("expected no devices to be traced with a ratio of 0")
+	}
+
+	// spans without a device are sampled by their trace id
+	s := newDeviceSampler(0.5)
+	if !sampled(s, 0x00) || sampled(s, 0xff) {
+		t.Error("expected spans without a device to be sampled by their trace id")
+	}
+}
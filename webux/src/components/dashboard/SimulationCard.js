@@ -88,6 +88,13 @@ const SimulationCard = (props) => {
         simStatusBadge = <div className="float-left">
             <span className="text-dark" title={msg}><Icon prefix="fe" name="check" /></span>
         </div>;
+    } else if (sim.status === "deletingDevices") {
+        statusColor = "danger";
+        simStatusName = "Devices Deleting";
+        const msg = "No devices are connected as simulation is not running.";
+        simStatusBadge = <div className="float-left">
+            <span className="text-dark" title={msg}><Icon prefix="fe" name="check" /></span>
+        </div>;
     }
     const textStatusColor = "text-" + statusColor;
 
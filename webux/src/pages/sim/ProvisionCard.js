@@ -67,6 +67,14 @@ const ProvisionCard = (props) => {
     }
 
     const title = "Provision devices - " + sim.name;
+    const failureRows = sim && sim.provisioningFailures && sim.provisioningFailures.map((failure, index) => {
+        return <Table.Row key={index}>
+            <Table.Col><span title={failure.message}>{failure.reason}</span></Table.Col>
+            <Table.Col>{failure.errorType}</Table.Col>
+            <Table.Col>{failure.count}</Table.Col>
+            <Table.Col>{new Date(failure.lastTime).toLocaleString()}</Table.Col>
+        </Table.Row>
+    });
     const deviceRows = sim && sim.devices.map((device, index) => {
         //const fieldName = device.id + "SimulatedCount";
         const fieldName = `devices[${index}]`;
@@ -167,6 +175,29 @@ const ProvisionCard = (props) => {
                                         {deviceRows}
                                     </Table.Body>
                                 </Table>
+
+                                {failureRows && failureRows.length > 0 && <>
+                                    <h4>Provisioning Failures</h4>
+                                    <Text className="small">Most frequent reasons devices of this simulation failed provisioning.</Text>
+                                    <Table
+                                        cards={true}
+                                        striped={true}
+                                        responsive={true}
+                                        className="table-vcenter fillerTable"
+                                    >
+                                        <Table.Header>
+                                            <Table.Row>
+                                                <Table.ColHeader>Reason</Table.ColHeader>
+                                                <Table.ColHeader>Error Type</Table.ColHeader>
+                                                <Table.ColHeader>Count</Table.ColHeader>
+                                                <Table.ColHeader>Last Failure</Table.ColHeader>
+                                            </Table.Row>
+                                        </Table.Header>
+                                        <Table.Body>
+                                            {failureRows}
+                                        </Table.Body>
+                                    </Table>
+                                </>}
                             </Grid.Col>
                         </Grid.Row>
                     </Form.FieldSet>
@@ -283,6 +283,9 @@ const SimCard = (props) => {
     } else if (sim.status === "deleting") {
         simStatusName = "Deleting";
         statusColor = "danger";
+    } else if (sim.status === "deletingDevices") {
+        simStatusName = "Devices Deleting";
+        statusColor = "danger";
     }
     const textStatusColor = "text-" + statusColor;
     return <>